@@ -15,16 +15,19 @@ func main() {
 	}
 	defer conn.Close()
 
-	for _, v := range []string{"method_call", "method_return", "error", "signal"} {
-		call := conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0,
-			"eavesdrop='true',type='"+v+"'")
-		if call.Err != nil {
-			fmt.Fprintln(os.Stderr, "Failed to add match:", call.Err)
-			os.Exit(1)
+	c := make(chan *dbus.Message, 10)
+	if err := conn.BecomeMonitor(c); err != nil {
+		// Older buses don't support monitors, but allow eavesdropping.
+		for _, v := range []string{"method_call", "method_return", "error", "signal"} {
+			call := conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0,
+				"eavesdrop='true',type='"+v+"'")
+			if call.Err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to add match:", call.Err)
+				os.Exit(1)
+			}
 		}
+		conn.Eavesdrop(c)
 	}
-	c := make(chan *dbus.Message, 10)
-	conn.Eavesdrop(c)
 	fmt.Println("Listening for everything")
 	for v := range c {
 		fmt.Println(v)
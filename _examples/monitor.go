@@ -21,16 +21,11 @@ func main() {
 		"type='method_return',member='Notify',path='/org/freedesktop/Notifications',interface='org.freedesktop.Notifications'",
 		"type='error',member='Notify',path='/org/freedesktop/Notifications',interface='org.freedesktop.Notifications'",
 	}
-	var flag uint = 0
-
-	call := conn.BusObject().Call("org.freedesktop.DBus.Monitoring.BecomeMonitor", 0, rules, flag)
-	if call.Err != nil {
-		fmt.Fprintln(os.Stderr, "Failed to become monitor:", call.Err)
+	c := make(chan *dbus.Message, 10)
+	if err := conn.BecomeMonitor(c, rules...); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to become monitor:", err)
 		os.Exit(1)
 	}
-
-	c := make(chan *dbus.Message, 10)
-	conn.Eavesdrop(c)
 	fmt.Println("Monitoring notifications")
 	for v := range c {
 		fmt.Println(v)
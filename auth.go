@@ -52,6 +52,16 @@ type Auth interface {
 // connections, this method must be called before sending any messages to the
 // bus. Auth must not be called on shared connections.
 func (conn *Conn) Auth(methods []Auth) error {
+	if err := conn.authenticate(methods); err != nil {
+		return err
+	}
+	go conn.inWorker()
+	return nil
+}
+
+// authenticate runs the authentication protocol on the transport of conn.
+func (conn *Conn) authenticate(methods []Auth) error {
+	conn.auth = methods
 	if methods == nil {
 		uid := strconv.Itoa(os.Getuid())
 		methods = []Auth{AuthExternal(uid), AuthCookieSha1(uid, getHomeDir())}
@@ -111,12 +121,7 @@ func (conn *Conn) Auth(methods []Auth) error {
 							return errors.New("dbus: authentication protocol error")
 						}
 					}
-					err = authWriteLine(conn.transport, []byte("BEGIN"))
-					if err != nil {
-						return err
-					}
-					go conn.inWorker()
-					return nil
+					return authWriteLine(conn.transport, []byte("BEGIN"))
 				}
 			}
 		}
@@ -14,3 +14,24 @@ func (a *authAnonymous) FirstData() (name, resp []byte, status AuthStatus) {
 func (a *authAnonymous) HandleData(data []byte) (resp []byte, status AuthStatus) {
 	return nil, AuthError
 }
+
+// ServerAuthAnonymous returns a ServerAuth that accepts every peer with the
+// ANONYMOUS mechanism.
+func ServerAuthAnonymous() ServerAuth {
+	return serverAuthAnonymous{}
+}
+
+type serverAuthAnonymous struct{}
+
+func (a serverAuthAnonymous) Name() string {
+	return "ANONYMOUS"
+}
+
+func (a serverAuthAnonymous) Start(conn *Conn) ServerAuthConversation {
+	return a
+}
+
+func (a serverAuthAnonymous) HandleData(data []byte) ([]byte, AuthStatus) {
+	// The optional trace information sent by the peer is ignored.
+	return nil, AuthOk
+}
@@ -2,6 +2,8 @@ package dbus
 
 import (
 	"encoding/hex"
+	"os"
+	"strconv"
 )
 
 // AuthExternal returns an Auth that authenticates as the given user with the
@@ -24,3 +26,54 @@ func (a authExternal) FirstData() ([]byte, []byte, AuthStatus) {
 func (a authExternal) HandleData(b []byte) ([]byte, AuthStatus) {
 	return nil, AuthError
 }
+
+// ServerAuthExternal returns a ServerAuth that authenticates peers with the
+// EXTERNAL mechanism, using the credentials of the peer process as reported
+// by the operating system. Only peers running as one of the given user IDs
+// are accepted; if none are given, only peers running as the same user as
+// the server are accepted.
+func ServerAuthExternal(uids ...string) ServerAuth {
+	if len(uids) == 0 {
+		uids = []string{strconv.Itoa(os.Getuid())}
+	}
+	return serverAuthExternal{uids}
+}
+
+type serverAuthExternal struct {
+	uids []string
+}
+
+func (a serverAuthExternal) Name() string {
+	return "EXTERNAL"
+}
+
+func (a serverAuthExternal) Start(conn *Conn) ServerAuthConversation {
+	return &serverAuthExternalConv{a, conn}
+}
+
+type serverAuthExternalConv struct {
+	serverAuthExternal
+	conn *Conn
+}
+
+func (c *serverAuthExternalConv) HandleData(data []byte) ([]byte, AuthStatus) {
+	user := make([]byte, hex.DecodedLen(len(data)))
+	if _, err := hex.Decode(user, data); err != nil {
+		return nil, AuthError
+	}
+	_, uid, err := c.conn.PeerCredentials()
+	if err != nil {
+		return nil, AuthError
+	}
+	peer := strconv.FormatUint(uint64(uid), 10)
+	// An empty authorization identity means "whoever the credentials say".
+	if len(user) != 0 && string(user) != peer {
+		return nil, AuthError
+	}
+	for _, v := range c.uids {
+		if v == peer {
+			return nil, AuthOk
+		}
+	}
+	return nil, AuthError
+}
@@ -0,0 +1,182 @@
+package dbus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// maxAuthLineLength is the maximum length of a line of the authentication
+// protocol that is accepted from a peer.
+const maxAuthLineLength = 16384
+
+// ServerAuth defines the behaviour of the server side of an authentication
+// mechanism. A ServerAuth is shared by all peers of a Server; the state of a
+// single authentication conversation is kept by the ServerAuthConversation
+// returned by Start.
+type ServerAuth interface {
+	// Return the name of the mechanism, as announced to peers in REJECTED.
+	Name() string
+
+	// Start a new authentication conversation with the peer at the other end
+	// of conn. As the peer is not authenticated yet, conn can't be used to
+	// send or receive messages; it can be queried for PeerCredentials.
+	Start(conn *Conn) ServerAuthConversation
+}
+
+// ServerAuthConversation is a single authentication conversation of a server
+// side authentication mechanism.
+type ServerAuthConversation interface {
+	// Process the given data, which is the initial response of the AUTH
+	// command first and the argument of a DATA command afterwards, and return
+	// the challenge to send to the peer and the next status. AuthOk
+	// authenticates the peer, AuthContinue sends resp as a DATA command and
+	// AuthError rejects the peer.
+	HandleData(data []byte) (resp []byte, status AuthStatus)
+}
+
+// credentialsTransport is implemented by transports that can report the
+// credentials of the process at the other end of the connection.
+type credentialsTransport interface {
+	peerCredentials() (pid, uid uint32, err error)
+}
+
+// PeerCredentials returns the process ID and user ID of the process at the
+// other end of the connection, as reported by the operating system. An error
+// is returned if the transport doesn't support querying them.
+func (conn *Conn) PeerCredentials() (pid, uid uint32, err error) {
+	ct, ok := conn.transport.(credentialsTransport)
+	if !ok {
+		return 0, 0, errors.New("dbus: transport does not support peer credentials")
+	}
+	return ct.peerCredentials()
+}
+
+type serverAuthState byte
+
+const (
+	waitingForAuth serverAuthState = iota
+	waitingForAuthData
+	waitingForBegin
+)
+
+// serverAuth runs the server side of the authentication protocol on a
+// connection that was accepted by a Server, trying the given mechanisms and
+// announcing guid to the peer on success.
+func (conn *Conn) serverAuth(guid string, methods []ServerAuth) error {
+	var b [1]byte
+	if _, err := io.ReadFull(conn.transport, b[:]); err != nil {
+		return err
+	}
+	if b[0] != 0 {
+		return errors.New("dbus: authentication protocol error")
+	}
+	rejected := [][]byte{[]byte("REJECTED")}
+	for _, m := range methods {
+		rejected = append(rejected, []byte(m.Name()))
+	}
+
+	var conv ServerAuthConversation
+	state := waitingForAuth
+	for {
+		s, err := authReadLineRaw(conn.transport)
+		if err != nil {
+			return err
+		}
+		var reply [][]byte
+		switch {
+		case state == waitingForAuth && string(s[0]) == "AUTH":
+			if len(s) < 2 || len(s) > 3 {
+				reply = rejected
+				break
+			}
+			conv = nil
+			for _, m := range methods {
+				if m.Name() == string(s[1]) {
+					conv = m.Start(conn)
+					break
+				}
+			}
+			switch {
+			case conv == nil:
+				reply = rejected
+			case len(s) == 2:
+				// No initial response; ask for it with an empty challenge.
+				reply = [][]byte{[]byte("DATA")}
+				state = waitingForAuthData
+			default:
+				reply, state = conn.serverAuthData(conv, s[2], guid, rejected)
+			}
+		case state == waitingForAuthData && string(s[0]) == "DATA":
+			if len(s) > 2 {
+				reply = [][]byte{[]byte("ERROR")}
+				break
+			}
+			var data []byte
+			if len(s) == 2 {
+				data = s[1]
+			}
+			reply, state = conn.serverAuthData(conv, data, guid, rejected)
+		case state == waitingForBegin && string(s[0]) == "BEGIN":
+			conn.uuid = guid
+			return nil
+		case state == waitingForBegin && string(s[0]) == "NEGOTIATE_UNIX_FD":
+			if conn.transport.SupportsUnixFDs() {
+				conn.EnableUnixFDs()
+				conn.unixFD = true
+				reply = [][]byte{[]byte("AGREE_UNIX_FD")}
+			} else {
+				reply = [][]byte{[]byte("ERROR"), []byte("Unix FD passing not supported")}
+			}
+		case string(s[0]) == "CANCEL" || string(s[0]) == "ERROR":
+			conv = nil
+			state = waitingForAuth
+			reply = rejected
+		default:
+			reply = [][]byte{[]byte("ERROR")}
+		}
+		if err = authWriteLine(conn.transport, reply...); err != nil {
+			return err
+		}
+	}
+}
+
+// serverAuthData passes data to conv and returns the line to send to the peer
+// and the next state.
+func (conn *Conn) serverAuthData(conv ServerAuthConversation, data []byte, guid string, rejected [][]byte) ([][]byte, serverAuthState) {
+	resp, status := conv.HandleData(data)
+	switch status {
+	case AuthOk:
+		return [][]byte{[]byte("OK"), []byte(guid)}, waitingForBegin
+	case AuthContinue:
+		if len(resp) == 0 {
+			return [][]byte{[]byte("DATA")}, waitingForAuthData
+		}
+		return [][]byte{[]byte("DATA"), resp}, waitingForAuthData
+	default:
+		return rejected, waitingForAuth
+	}
+}
+
+// authReadLineRaw reads a line of the authentication protocol from in and
+// separates it into its fields. Unlike authReadLine, it never reads past the
+// end of the line, so that messages sent by the peer directly after BEGIN
+// are not lost.
+func authReadLineRaw(in io.Reader) ([][]byte, error) {
+	var data []byte
+	var b [1]byte
+	for {
+		if _, err := io.ReadFull(in, b[:]); err != nil {
+			return nil, err
+		}
+		data = append(data, b[0])
+		if b[0] == '\n' {
+			break
+		}
+		if len(data) > maxAuthLineLength {
+			return nil, errors.New("dbus: authentication line too long")
+		}
+	}
+	data = bytes.TrimSuffix(data, []byte("\r\n"))
+	return bytes.Split(data, []byte{' '}), nil
+}
@@ -5,8 +5,13 @@ import (
 	"bytes"
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/subtle"
 	"encoding/hex"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 )
 
 // AuthCookieSha1 returns an Auth that authenticates as the given user with the
@@ -100,3 +105,172 @@ func (a authCookieSha1) generateChallenge() []byte {
 	hex.Encode(enc, b)
 	return enc
 }
+
+const (
+	// cookieContext is the keyring context used by ServerAuthCookieSha1.
+	cookieContext = "org_freedesktop_general"
+
+	// New cookies are created once all cookies in the keyring are older
+	// than cookieRenewAge; cookies older than cookieMaxAge are removed.
+	cookieRenewAge = 5 * 60
+	cookieMaxAge   = 7 * 60
+)
+
+// ServerAuthCookieSha1 returns a ServerAuth that authenticates peers with the
+// DBUS_COOKIE_SHA1 mechanism, using the keyring in the .dbus-keyrings
+// directory below home, which should be the home directory of the user the
+// server runs as. Since peers must be able to read the keyring, only peers
+// authenticating as the same user ID as the server are accepted.
+func ServerAuthCookieSha1(home string) ServerAuth {
+	return serverAuthCookieSha1{home}
+}
+
+type serverAuthCookieSha1 struct {
+	home string
+}
+
+func (a serverAuthCookieSha1) Name() string {
+	return "DBUS_COOKIE_SHA1"
+}
+
+func (a serverAuthCookieSha1) Start(conn *Conn) ServerAuthConversation {
+	return &serverAuthCookieSha1Conv{serverAuthCookieSha1: a}
+}
+
+type serverAuthCookieSha1Conv struct {
+	serverAuthCookieSha1
+	challenge []byte
+	cookie    []byte
+}
+
+func (c *serverAuthCookieSha1Conv) HandleData(data []byte) ([]byte, AuthStatus) {
+	b := make([]byte, hex.DecodedLen(len(data)))
+	if _, err := hex.Decode(b, data); err != nil {
+		return nil, AuthError
+	}
+	if c.challenge == nil {
+		if string(b) != strconv.Itoa(os.Getuid()) {
+			return nil, AuthError
+		}
+		id, cookie, err := c.keyringCookie()
+		if err != nil {
+			return nil, AuthError
+		}
+		c.cookie = cookie
+		c.challenge = authCookieSha1{}.generateChallenge()
+		if c.challenge == nil {
+			return nil, AuthError
+		}
+		resp := bytes.Join([][]byte{[]byte(cookieContext), []byte(id), c.challenge}, []byte{' '})
+		enc := make([]byte, hex.EncodedLen(len(resp)))
+		hex.Encode(enc, resp)
+		return enc, AuthContinue
+	}
+	s := bytes.Split(b, []byte{' '})
+	if len(s) != 2 {
+		return nil, AuthError
+	}
+	hash := sha1.New()
+	hash.Write(bytes.Join([][]byte{c.challenge, s[0], c.cookie}, []byte{':'}))
+	want := make([]byte, 2*hash.Size())
+	hex.Encode(want, hash.Sum(nil))
+	if subtle.ConstantTimeCompare(want, s[1]) != 1 {
+		return nil, AuthError
+	}
+	return nil, AuthOk
+}
+
+// keyringCookie returns the ID and content of a recent cookie from the
+// keyring, creating a new cookie and pruning expired ones if necessary.
+func (a serverAuthCookieSha1) keyringCookie() (string, []byte, error) {
+	dir := filepath.Join(a.home, ".dbus-keyrings")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", nil, err
+	}
+	path := filepath.Join(dir, cookieContext)
+	unlock, err := lockKeyring(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer unlock()
+
+	now := time.Now().Unix()
+	var lines [][]byte
+	var maxID uint64
+	var id string
+	var cookie []byte
+	if content, err := ioutil.ReadFile(path); err == nil {
+		for _, line := range bytes.Split(content, []byte{'\n'}) {
+			b := bytes.Split(line, []byte{' '})
+			if len(b) != 3 {
+				continue
+			}
+			n, err1 := strconv.ParseUint(string(b[0]), 10, 32)
+			created, err2 := strconv.ParseInt(string(b[1]), 10, 64)
+			if err1 != nil || err2 != nil || created > now || now-created > cookieMaxAge {
+				continue
+			}
+			if n > maxID {
+				maxID = n
+			}
+			if now-created < cookieRenewAge {
+				id, cookie = string(b[0]), b[2]
+			}
+			lines = append(lines, line)
+		}
+	} else if !os.IsNotExist(err) {
+		return "", nil, err
+	}
+	if cookie != nil {
+		return id, cookie, nil
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	id = strconv.FormatUint(maxID+1, 10)
+	cookie = make([]byte, hex.EncodedLen(len(b)))
+	hex.Encode(cookie, b)
+	line := []byte(id + " " + strconv.FormatInt(now, 10) + " " + string(cookie))
+	lines = append(lines, line)
+
+	tmp := path + "." + id + ".tmp"
+	content := append(bytes.Join(lines, []byte{'\n'}), '\n')
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return "", nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", nil, err
+	}
+	return id, cookie, nil
+}
+
+// lockKeyring acquires the lock file of the keyring at path, as done by the
+// reference implementation, and returns a function that releases it. Stale
+// lock files are removed after a few seconds of waiting.
+func lockKeyring(path string) (func(), error) {
+	lock := path + ".lock"
+	for i := 0; ; i++ {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if i == 32 {
+			// Whoever held the lock presumably died.
+			if err := os.Remove(lock); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			continue
+		}
+		if i > 32 {
+			return nil, err
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
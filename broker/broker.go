@@ -0,0 +1,353 @@
+// Package broker implements a message bus that routes messages between many
+// connections, providing the org.freedesktop.DBus interface in the same way
+// as dbus-daemon does.
+//
+// A Broker takes its peers from one or more dbus.Servers:
+//
+//	srv, err := dbus.Listen("unix:tmpdir=/tmp")
+//	if err != nil {
+//		panic(err)
+//	}
+//	b := broker.New()
+//	go b.Serve(srv)
+//	conn, err := dbus.Connect(srv.Address())
+package broker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/yaamai/dbus/v5"
+)
+
+const (
+	busName = "org.freedesktop.DBus"
+	busPath = dbus.ObjectPath("/org/freedesktop/DBus")
+)
+
+// Broker is a message bus. It assigns unique names to its peers, manages the
+// ownership of well-known names and routes messages between peers according
+// to their destination and the match rules installed by the peers.
+type Broker struct {
+	mu     sync.Mutex
+	id     string
+	nextID uint64
+	closed bool
+	peers  map[*peer]struct{}
+	unique map[string]*peer
+	names  map[string][]*nameOwner
+}
+
+// New returns a new Broker without any peers.
+func New() *Broker {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return &Broker{
+		id:     hex.EncodeToString(b),
+		nextID: 1,
+		peers:  make(map[*peer]struct{}),
+		unique: make(map[string]*peer),
+		names:  make(map[string][]*nameOwner),
+	}
+}
+
+// Serve accepts peers on srv and adds them to the bus until accepting fails,
+// for example because srv was closed. The error of the failed Accept is
+// returned.
+func (b *Broker) Serve(srv *dbus.Server) error {
+	for {
+		p := newPeer(b)
+		conn, err := srv.Accept(dbus.WithRawMessageHandler(p.handleMessage))
+		if err != nil {
+			return err
+		}
+		b.addPeer(p, conn)
+	}
+}
+
+// Close disconnects all peers. Servers passed to Serve are not closed.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	peers := make([]*peer, 0, len(b.peers))
+	for p := range b.peers {
+		peers = append(peers, p)
+	}
+	b.mu.Unlock()
+	for _, p := range peers {
+		p.conn.Close()
+	}
+	return nil
+}
+
+func (b *Broker) addPeer(p *peer, conn *dbus.Conn) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		conn.Close()
+		return
+	}
+	p.conn = conn
+	b.peers[p] = struct{}{}
+	b.mu.Unlock()
+	close(p.ready)
+	go p.run()
+	go func() {
+		<-conn.Context().Done()
+		b.removePeer(p)
+	}()
+}
+
+// removePeer removes a disconnected peer from the bus, passing on the names
+// it owned to the next peers in their queues.
+func (b *Broker) removePeer(p *peer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p.close()
+	delete(b.peers, p)
+	if p.name == "" {
+		return
+	}
+	for name := range b.names {
+		b.dropName(p, name)
+	}
+	delete(b.unique, p.name)
+	b.signal(nil, "NameOwnerChanged", p.name, p.name, "")
+}
+
+// route routes a message received from p. b.mu must be locked.
+func (b *Broker) route(p *peer, msg *dbus.Message) {
+	msg.Headers[dbus.FieldSender] = dbus.MakeVariant(p.name)
+	dest := headerString(msg, dbus.FieldDestination)
+	var recipients []*peer
+	switch dest {
+	case busName:
+		recipients = b.eavesdroppers(msg, nil)
+	case "":
+		recipients = b.subscribers(msg)
+	default:
+		owner := b.owner(dest)
+		if owner == nil {
+			if msg.Type == dbus.TypeMethodCall {
+				b.replyError(p, msg, "org.freedesktop.DBus.Error.ServiceUnknown",
+					"The name "+dest+" was not provided by any .service files")
+			}
+			closeFDs(msg)
+			return
+		}
+		recipients = append(b.eavesdroppers(msg, owner), owner)
+	}
+
+	done := fdCloser(msg, len(recipients))
+	for _, r := range recipients {
+		r.enqueue(delivery{copyMessage(msg), true, done})
+	}
+	if dest == busName && msg.Type == dbus.TypeMethodCall {
+		b.handleDriverCall(p, msg)
+	}
+}
+
+// subscribers returns the peers that have a match rule for msg, which has no
+// destination.
+func (b *Broker) subscribers(msg *dbus.Message) []*peer {
+	var out []*peer
+	for p := range b.peers {
+		for _, r := range p.rules {
+			if r.MatchesOwner(msg, b.ownsName) {
+				out = append(out, p)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// eavesdroppers returns the peers other than dest that have an eavesdropping
+// match rule for msg.
+func (b *Broker) eavesdroppers(msg *dbus.Message, dest *peer) []*peer {
+	var out []*peer
+	for p := range b.peers {
+		if p == dest {
+			continue
+		}
+		for _, r := range p.rules {
+			if r.Eavesdrop && r.MatchesOwner(msg, b.ownsName) {
+				out = append(out, p)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// owner returns the peer that owns the given unique or well-known name.
+func (b *Broker) owner(name string) *peer {
+	if len(name) > 0 && name[0] == ':' {
+		return b.unique[name]
+	}
+	if q := b.names[name]; len(q) > 0 {
+		return q[0].peer
+	}
+	return nil
+}
+
+// ownsName returns whether the peer with the given unique name owns name.
+func (b *Broker) ownsName(unique, name string) bool {
+	if name == busName {
+		return unique == busName
+	}
+	p := b.owner(name)
+	return p != nil && p.name == unique
+}
+
+// reply sends a method reply for call to p.
+func (b *Broker) reply(p *peer, call *dbus.Message, values ...interface{}) {
+	if call.Flags&dbus.FlagNoReplyExpected != 0 {
+		return
+	}
+	msg := &dbus.Message{
+		Type: dbus.TypeMethodReply,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldSender:      dbus.MakeVariant(busName),
+			dbus.FieldDestination: dbus.MakeVariant(p.name),
+			dbus.FieldReplySerial: dbus.MakeVariant(call.Serial()),
+		},
+		Body: values,
+	}
+	if len(values) > 0 {
+		msg.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(values...))
+	}
+	p.enqueue(delivery{msg: msg})
+}
+
+// replyError sends an error reply for call to p.
+func (b *Broker) replyError(p *peer, call *dbus.Message, name, text string) {
+	if call.Flags&dbus.FlagNoReplyExpected != 0 {
+		return
+	}
+	msg := &dbus.Message{
+		Type: dbus.TypeError,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldSender:      dbus.MakeVariant(busName),
+			dbus.FieldReplySerial: dbus.MakeVariant(call.Serial()),
+			dbus.FieldErrorName:   dbus.MakeVariant(name),
+			dbus.FieldSignature:   dbus.MakeVariant(dbus.SignatureOf(text)),
+		},
+		Body: []interface{}{text},
+	}
+	if p.name != "" {
+		msg.Headers[dbus.FieldDestination] = dbus.MakeVariant(p.name)
+	}
+	p.enqueue(delivery{msg: msg})
+}
+
+// signal emits a signal of the org.freedesktop.DBus interface. If dest is
+// nil, the signal is broadcast to all peers with a matching rule; otherwise,
+// it is only sent to dest.
+func (b *Broker) signal(dest *peer, member string, values ...interface{}) {
+	msg := &dbus.Message{
+		Type: dbus.TypeSignal,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldSender:    dbus.MakeVariant(busName),
+			dbus.FieldPath:      dbus.MakeVariant(busPath),
+			dbus.FieldInterface: dbus.MakeVariant(busName),
+			dbus.FieldMember:    dbus.MakeVariant(member),
+			dbus.FieldSignature: dbus.MakeVariant(dbus.SignatureOf(values...)),
+		},
+		Body: values,
+	}
+	var recipients []*peer
+	if dest == nil {
+		recipients = b.subscribers(msg)
+	} else {
+		msg.Headers[dbus.FieldDestination] = dbus.MakeVariant(dest.name)
+		recipients = append(b.eavesdroppers(msg, dest), dest)
+	}
+	for _, p := range recipients {
+		p.enqueue(delivery{msg: copyMessage(msg)})
+	}
+}
+
+// newUniqueName returns the next unique connection name. b.mu must be locked.
+func (b *Broker) newUniqueName() string {
+	name := ":1." + strconv.FormatUint(b.nextID, 10)
+	b.nextID++
+	return name
+}
+
+// copyMessage returns a copy of msg that can be sent independently of msg.
+func copyMessage(msg *dbus.Message) *dbus.Message {
+	m := *msg
+	m.Headers = make(map[dbus.HeaderField]dbus.Variant, len(msg.Headers))
+	for k, v := range msg.Headers {
+		m.Headers[k] = v
+	}
+	m.Body = append([]interface{}(nil), msg.Body...)
+	return &m
+}
+
+// fdCloser returns a function that closes the file descriptors received with
+// msg after it was called n times, or nil if msg carries no file descriptors.
+// If n is 0, the file descriptors are closed immediately.
+func fdCloser(msg *dbus.Message, n int) func() {
+	if _, ok := msg.Headers[dbus.FieldUnixFDs]; !ok {
+		return nil
+	}
+	if n == 0 {
+		closeFDs(msg)
+		return nil
+	}
+	var mu sync.Mutex
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		n--
+		if n == 0 {
+			closeFDs(msg)
+		}
+	}
+}
+
+func headerString(msg *dbus.Message, field dbus.HeaderField) string {
+	s, _ := msg.Headers[field].Value().(string)
+	return s
+}
+
+// closeFDs closes the file descriptors that were received with msg.
+func closeFDs(msg *dbus.Message) {
+	for _, v := range msg.Body {
+		closeValueFDs(reflect.ValueOf(v))
+	}
+}
+
+// closeValueFDs closes the file descriptors in v, which is a value decoded from
+// a message, wherever they are nested.
+func closeValueFDs(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Int32:
+		if fd, ok := v.Interface().(dbus.UnixFD); ok {
+			os.NewFile(uintptr(fd), "").Close()
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			closeValueFDs(v.Index(i))
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			closeValueFDs(k)
+			closeValueFDs(v.MapIndex(k))
+		}
+	case reflect.Interface:
+		closeValueFDs(v.Elem())
+	case reflect.Struct:
+		if variant, ok := v.Interface().(dbus.Variant); ok {
+			closeValueFDs(reflect.ValueOf(variant.Value()))
+		}
+	}
+}
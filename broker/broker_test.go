@@ -0,0 +1,266 @@
+package broker
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/yaamai/dbus/v5"
+)
+
+type echo struct{}
+
+func (echo) Echo(s string) (string, *dbus.Error) {
+	return s, nil
+}
+
+func startBroker(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "dbus-broker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := dbus.Listen("unix:tmpdir=" + dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	b := New()
+	go b.Serve(srv)
+	return srv.Address(), func() {
+		srv.Close()
+		b.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestBrokerHello(t *testing.T) {
+	address, stop := startBroker(t)
+	defer stop()
+
+	c1 := connect(t, address)
+	defer c1.Close()
+	c2 := connect(t, address)
+	defer c2.Close()
+
+	if c1.Names()[0] == c2.Names()[0] {
+		t.Errorf("both connections got unique name %s", c1.Names()[0])
+	}
+	var names []string
+	if err := c1.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for _, name := range names {
+		if name == c1.Names()[0] || name == c2.Names()[0] || name == busName {
+			found++
+		}
+	}
+	if found != 3 {
+		t.Errorf("ListNames returned %v", names)
+	}
+}
+
+func TestBrokerMethodCall(t *testing.T) {
+	address, stop := startBroker(t)
+	defer stop()
+
+	srv := connect(t, address)
+	defer srv.Close()
+	if err := srv.Export(echo{}, "/org/godbus/test", "org.godbus.test"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := srv.RequestName("org.godbus.test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("RequestName returned %v", reply)
+	}
+
+	client := connect(t, address)
+	defer client.Close()
+	var s string
+	err = client.Object("org.godbus.test", "/org/godbus/test").Call("org.godbus.test.Echo", 0, "hello").Store(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "hello" {
+		t.Errorf("got %q, want %q", s, "hello")
+	}
+
+	err = client.Object("org.godbus.missing", "/").Call("org.godbus.test.Echo", 0, "hello").Err
+	if e, ok := err.(dbus.Error); !ok || e.Name != errServiceUnknown {
+		t.Errorf("call to missing name returned %v", err)
+	}
+}
+
+func TestBrokerNameQueue(t *testing.T) {
+	address, stop := startBroker(t)
+	defer stop()
+
+	c1 := connect(t, address)
+	defer c1.Close()
+	c2 := connect(t, address)
+	defer c2.Close()
+	watcher := connect(t, address)
+	defer watcher.Close()
+
+	signals := make(chan *dbus.Signal, 10)
+	watcher.Signal(signals)
+	err := watcher.AddMatchSignal(
+		dbus.WithMatchInterface(busName),
+		dbus.WithMatchMember("NameOwnerChanged"),
+		dbus.WithMatchArg(0, "org.godbus.queue"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const name = "org.godbus.queue"
+	for _, tc := range []struct {
+		conn  *dbus.Conn
+		flags dbus.RequestNameFlags
+		want  dbus.RequestNameReply
+	}{
+		{c1, dbus.NameFlagAllowReplacement, dbus.RequestNameReplyPrimaryOwner},
+		{c1, dbus.NameFlagAllowReplacement, dbus.RequestNameReplyAlreadyOwner},
+		{c2, dbus.NameFlagDoNotQueue, dbus.RequestNameReplyExists},
+		{c2, 0, dbus.RequestNameReplyInQueue},
+	} {
+		reply, err := tc.conn.RequestName(name, tc.flags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply != tc.want {
+			t.Errorf("RequestName returned %v, want %v", reply, tc.want)
+		}
+	}
+
+	var owners []string
+	if err := watcher.BusObject().Call("org.freedesktop.DBus.ListQueuedOwners", 0, name).Store(&owners); err != nil {
+		t.Fatal(err)
+	}
+	if len(owners) != 2 || owners[0] != c1.Names()[0] || owners[1] != c2.Names()[0] {
+		t.Errorf("ListQueuedOwners returned %v", owners)
+	}
+
+	// Closing the primary owner passes the name on to the next in the queue.
+	c1.Close()
+	for _, want := range [][]string{
+		{"", c1.Names()[0]},
+		{c1.Names()[0], c2.Names()[0]},
+	} {
+		select {
+		case sig := <-signals:
+			if sig.Body[1] != want[0] || sig.Body[2] != want[1] {
+				t.Errorf("got NameOwnerChanged %v, want %v", sig.Body, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for NameOwnerChanged")
+		}
+	}
+
+	reply, err := c2.ReleaseName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != dbus.ReleaseNameReplyReleased {
+		t.Errorf("ReleaseName returned %v", reply)
+	}
+	var has bool
+	if err := watcher.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, name).Store(&has); err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Error("name still has an owner after being released")
+	}
+}
+
+func TestBrokerMatchRules(t *testing.T) {
+	address, stop := startBroker(t)
+	defer stop()
+
+	sender := connect(t, address)
+	defer sender.Close()
+	receiver := connect(t, address)
+	defer receiver.Close()
+
+	signals := make(chan *dbus.Signal, 10)
+	receiver.Signal(signals)
+	rule := []dbus.MatchOption{
+		dbus.WithMatchInterface("org.godbus.test"),
+		dbus.WithMatchMember("Wanted"),
+	}
+	if err := receiver.AddMatchSignal(rule...); err != nil {
+		t.Fatal(err)
+	}
+	sender.Emit("/org/godbus/test", "org.godbus.test.Unwanted", "x")
+	sender.Emit("/org/godbus/test", "org.godbus.test.Wanted", "y")
+
+	select {
+	case sig := <-signals:
+		if sig.Name != "org.godbus.test.Wanted" || sig.Sender != sender.Names()[0] {
+			t.Errorf("got signal %s from %s", sig.Name, sig.Sender)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for signal")
+	}
+
+	if err := receiver.RemoveMatchSignal(rule...); err != nil {
+		t.Fatal(err)
+	}
+	err := receiver.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, "type='signal'").Err
+	if e, ok := err.(dbus.Error); !ok || e.Name != errMatchRuleNotFound {
+		t.Errorf("RemoveMatch of unknown rule returned %v", err)
+	}
+}
+
+func TestPeerQueueOverflow(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	conn, err := dbus.NewConn(c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newPeer(New())
+	p.conn = conn
+	p.maxQueue = 2
+	go p.run()
+
+	// Nobody reads from c2, so the first message blocks the peer and the
+	// following ones fill its queue.
+	done := make(chan struct{}, 4)
+	for i := 0; i < 4; i++ {
+		msg := &dbus.Message{
+			Type: dbus.TypeSignal,
+			Headers: map[dbus.HeaderField]dbus.Variant{
+				dbus.FieldPath:      dbus.MakeVariant(dbus.ObjectPath("/org/godbus/test")),
+				dbus.FieldInterface: dbus.MakeVariant("org.godbus.test"),
+				dbus.FieldMember:    dbus.MakeVariant("Signal"),
+			},
+		}
+		p.enqueue(delivery{msg: msg, done: func() { done <- struct{}{} }})
+	}
+	select {
+	case <-conn.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer not disconnected after its queue overflowed")
+	}
+	for i := 0; i < 4; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of 4 deliveries finished", i)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package broker
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/yaamai/dbus/v5"
+	"github.com/yaamai/dbus/v5/introspect"
+)
+
+const (
+	errInvalidArgs       = "org.freedesktop.DBus.Error.InvalidArgs"
+	errNameHasNoOwner    = "org.freedesktop.DBus.Error.NameHasNoOwner"
+	errMatchRuleInvalid  = "org.freedesktop.DBus.Error.MatchRuleInvalid"
+	errMatchRuleNotFound = "org.freedesktop.DBus.Error.MatchRuleNotFound"
+	errUnknownMethod     = "org.freedesktop.DBus.Error.UnknownMethod"
+	errUnknownInterface  = "org.freedesktop.DBus.Error.UnknownInterface"
+	errServiceUnknown    = "org.freedesktop.DBus.Error.ServiceUnknown"
+	errAccessDenied      = "org.freedesktop.DBus.Error.AccessDenied"
+	errNotSupported      = "org.freedesktop.DBus.Error.NotSupported"
+)
+
+// introspectData is the introspection data of the bus object.
+const introspectData = `
+<node>
+	<interface name="org.freedesktop.DBus">
+		<method name="Hello">
+			<arg direction="out" type="s"/>
+		</method>
+		<method name="RequestName">
+			<arg direction="in" type="s"/>
+			<arg direction="in" type="u"/>
+			<arg direction="out" type="u"/>
+		</method>
+		<method name="ReleaseName">
+			<arg direction="in" type="s"/>
+			<arg direction="out" type="u"/>
+		</method>
+		<method name="StartServiceByName">
+			<arg direction="in" type="s"/>
+			<arg direction="in" type="u"/>
+			<arg direction="out" type="u"/>
+		</method>
+		<method name="NameHasOwner">
+			<arg direction="in" type="s"/>
+			<arg direction="out" type="b"/>
+		</method>
+		<method name="ListNames">
+			<arg direction="out" type="as"/>
+		</method>
+		<method name="ListActivatableNames">
+			<arg direction="out" type="as"/>
+		</method>
+		<method name="AddMatch">
+			<arg direction="in" type="s"/>
+		</method>
+		<method name="RemoveMatch">
+			<arg direction="in" type="s"/>
+		</method>
+		<method name="GetNameOwner">
+			<arg direction="in" type="s"/>
+			<arg direction="out" type="s"/>
+		</method>
+		<method name="ListQueuedOwners">
+			<arg direction="in" type="s"/>
+			<arg direction="out" type="as"/>
+		</method>
+		<method name="GetConnectionUnixUser">
+			<arg direction="in" type="s"/>
+			<arg direction="out" type="u"/>
+		</method>
+		<method name="GetConnectionUnixProcessID">
+			<arg direction="in" type="s"/>
+			<arg direction="out" type="u"/>
+		</method>
+		<method name="GetConnectionCredentials">
+			<arg direction="in" type="s"/>
+			<arg direction="out" type="a{sv}"/>
+		</method>
+		<method name="GetId">
+			<arg direction="out" type="s"/>
+		</method>
+		<signal name="NameOwnerChanged">
+			<arg type="s"/>
+			<arg type="s"/>
+			<arg type="s"/>
+		</signal>
+		<signal name="NameLost">
+			<arg type="s"/>
+		</signal>
+		<signal name="NameAcquired">
+			<arg type="s"/>
+		</signal>
+	</interface>
+	<interface name="org.freedesktop.DBus.Peer">
+		<method name="Ping"/>
+		<method name="GetMachineId">
+			<arg direction="out" type="s"/>
+		</method>
+	</interface>` + introspect.IntrospectDataString + `</node>`
+
+// hello handles the Hello call that every peer must send first. b.mu must be
+// locked.
+func (b *Broker) hello(p *peer, call *dbus.Message) {
+	p.name = b.newUniqueName()
+	b.unique[p.name] = p
+	b.reply(p, call, p.name)
+	b.ownerChanged(p.name, nil, p)
+}
+
+// handleDriverCall handles a method call that p sent to the bus itself. b.mu
+// must be locked.
+func (b *Broker) handleDriverCall(p *peer, call *dbus.Message) {
+	iface := headerString(call, dbus.FieldInterface)
+	member := headerString(call, dbus.FieldMember)
+	args := func(dest ...interface{}) bool {
+		if err := dbus.Store(call.Body, dest...); err != nil {
+			b.replyError(p, call, errInvalidArgs, "Invalid arguments for "+member)
+			return false
+		}
+		return true
+	}
+
+	switch iface {
+	case "", busName:
+	case "org.freedesktop.DBus.Peer":
+		switch member {
+		case "Ping":
+			b.reply(p, call)
+		case "GetMachineId":
+			b.reply(p, call, b.id)
+		default:
+			b.unknownMethod(p, call, iface, member)
+		}
+		return
+	case "org.freedesktop.DBus.Introspectable":
+		if member != "Introspect" {
+			b.unknownMethod(p, call, iface, member)
+			return
+		}
+		b.reply(p, call, strings.TrimSpace(introspect.IntrospectDeclarationString)+introspectData)
+		return
+	default:
+		b.replyError(p, call, errUnknownInterface,
+			"Interface \""+iface+"\" does not exist")
+		return
+	}
+
+	switch member {
+	case "Hello":
+		b.replyError(p, call, "org.freedesktop.DBus.Error.Failed", "Already handled an Hello message")
+	case "RequestName", "ReleaseName":
+		var (
+			name  string
+			flags uint32
+		)
+		if member == "RequestName" && !args(&name, &flags) || member == "ReleaseName" && !args(&name) {
+			return
+		}
+		if !isValidBusName(name, false) {
+			b.replyError(p, call, errInvalidArgs, "Cannot acquire or release name \""+name+"\"")
+			return
+		}
+		if name == busName {
+			b.replyError(p, call, errInvalidArgs, "Cannot acquire or release a service named "+busName)
+			return
+		}
+		if member == "RequestName" {
+			b.reply(p, call, uint32(b.requestName(p, name, dbus.RequestNameFlags(flags))))
+		} else {
+			b.reply(p, call, uint32(b.releaseName(p, name)))
+		}
+	case "StartServiceByName":
+		var (
+			name  string
+			flags uint32
+		)
+		if !args(&name, &flags) {
+			return
+		}
+		if b.owner(name) == nil && name != busName {
+			b.replyError(p, call, errServiceUnknown,
+				"The name "+name+" was not provided by any .service files")
+			return
+		}
+		// DBUS_START_REPLY_ALREADY_RUNNING
+		b.reply(p, call, uint32(2))
+	case "NameHasOwner":
+		var name string
+		if !args(&name) {
+			return
+		}
+		b.reply(p, call, name == busName || b.owner(name) != nil)
+	case "ListNames":
+		names := []string{busName}
+		for name := range b.unique {
+			names = append(names, name)
+		}
+		for name := range b.names {
+			names = append(names, name)
+		}
+		sort.Strings(names[1:])
+		b.reply(p, call, names)
+	case "ListActivatableNames":
+		b.reply(p, call, []string{busName})
+	case "AddMatch":
+		var s string
+		if !args(&s) {
+			return
+		}
+		rule, err := dbus.ParseMatchRule(s)
+		if err != nil {
+			b.replyError(p, call, errMatchRuleInvalid, "Invalid match rule: "+s)
+			return
+		}
+		p.rules = append(p.rules, rule)
+		b.reply(p, call)
+	case "RemoveMatch":
+		var s string
+		if !args(&s) {
+			return
+		}
+		rule, err := dbus.ParseMatchRule(s)
+		if err != nil {
+			b.replyError(p, call, errMatchRuleInvalid, "Invalid match rule: "+s)
+			return
+		}
+		for i, r := range p.rules {
+			if r.String() == rule.String() {
+				p.rules = append(p.rules[:i], p.rules[i+1:]...)
+				b.reply(p, call)
+				return
+			}
+		}
+		b.replyError(p, call, errMatchRuleNotFound,
+			"The given match rule wasn't found and can't be removed")
+	case "GetNameOwner":
+		var name string
+		if !args(&name) {
+			return
+		}
+		if name == busName {
+			b.reply(p, call, busName)
+			return
+		}
+		owner := b.owner(name)
+		if owner == nil {
+			b.replyError(p, call, errNameHasNoOwner,
+				"Could not get owner of name '"+name+"': no such name")
+			return
+		}
+		b.reply(p, call, owner.name)
+	case "ListQueuedOwners":
+		var name string
+		if !args(&name) {
+			return
+		}
+		if name == busName {
+			b.reply(p, call, []string{busName})
+			return
+		}
+		if b.owner(name) == nil {
+			b.replyError(p, call, errNameHasNoOwner,
+				"Could not get owners of name '"+name+"': no such name")
+			return
+		}
+		if name[0] == ':' {
+			b.reply(p, call, []string{name})
+			return
+		}
+		b.reply(p, call, b.listQueuedOwners(name))
+	case "GetConnectionUnixUser", "GetConnectionUnixProcessID", "GetConnectionCredentials":
+		var name string
+		if !args(&name) {
+			return
+		}
+		owner := b.owner(name)
+		if owner == nil {
+			b.replyError(p, call, errNameHasNoOwner,
+				"Could not get credentials of name '"+name+"': no such name")
+			return
+		}
+		pid, uid, err := owner.conn.PeerCredentials()
+		if err != nil {
+			b.replyError(p, call, errNotSupported, err.Error())
+			return
+		}
+		switch member {
+		case "GetConnectionUnixUser":
+			b.reply(p, call, uid)
+		case "GetConnectionUnixProcessID":
+			b.reply(p, call, pid)
+		default:
+			b.reply(p, call, map[string]dbus.Variant{
+				"UnixUserID": dbus.MakeVariant(uid),
+				"ProcessID":  dbus.MakeVariant(pid),
+			})
+		}
+	case "GetId":
+		b.reply(p, call, b.id)
+	case "UpdateActivationEnvironment", "ReloadConfig":
+		b.replyError(p, call, errAccessDenied, member+" is not supported by this bus")
+	default:
+		b.unknownMethod(p, call, busName, member)
+	}
+}
+
+func (b *Broker) unknownMethod(p *peer, call *dbus.Message, iface, member string) {
+	b.replyError(p, call, errUnknownMethod,
+		"Unknown method "+member+" on interface "+iface)
+}
@@ -0,0 +1,162 @@
+package broker
+
+import (
+	"strings"
+
+	"github.com/yaamai/dbus/v5"
+)
+
+// nameOwner is an entry in the queue of a well-known name. The first entry of
+// a queue is the primary owner of the name.
+type nameOwner struct {
+	peer  *peer
+	flags dbus.RequestNameFlags
+}
+
+// requestName implements org.freedesktop.DBus.RequestName. b.mu must be
+// locked.
+func (b *Broker) requestName(p *peer, name string, flags dbus.RequestNameFlags) dbus.RequestNameReply {
+	q := b.names[name]
+	if len(q) == 0 {
+		b.names[name] = []*nameOwner{{p, flags}}
+		b.ownerChanged(name, nil, p)
+		return dbus.RequestNameReplyPrimaryOwner
+	}
+	primary := q[0]
+	if primary.peer == p {
+		primary.flags = flags
+		return dbus.RequestNameReplyAlreadyOwner
+	}
+	if primary.flags&dbus.NameFlagAllowReplacement != 0 && flags&dbus.NameFlagReplaceExisting != 0 {
+		q = removeOwner(q, p)
+		if primary.flags&dbus.NameFlagDoNotQueue != 0 {
+			// The previous owner doesn't want to wait in the queue.
+			q = q[1:]
+		}
+		b.names[name] = append([]*nameOwner{{p, flags}}, q...)
+		b.ownerChanged(name, primary.peer, p)
+		return dbus.RequestNameReplyPrimaryOwner
+	}
+	if flags&dbus.NameFlagDoNotQueue != 0 {
+		b.names[name] = removeOwner(q, p)
+		return dbus.RequestNameReplyExists
+	}
+	for _, o := range q {
+		if o.peer == p {
+			o.flags = flags
+			return dbus.RequestNameReplyInQueue
+		}
+	}
+	b.names[name] = append(q, &nameOwner{p, flags})
+	return dbus.RequestNameReplyInQueue
+}
+
+// releaseName implements org.freedesktop.DBus.ReleaseName. b.mu must be
+// locked.
+func (b *Broker) releaseName(p *peer, name string) dbus.ReleaseNameReply {
+	q := b.names[name]
+	if len(q) == 0 {
+		return dbus.ReleaseNameReplyNonExistent
+	}
+	for _, o := range q {
+		if o.peer == p {
+			b.dropName(p, name)
+			return dbus.ReleaseNameReplyReleased
+		}
+	}
+	return dbus.ReleaseNameReplyNotOwner
+}
+
+// dropName removes p from the queue of name, passing on the ownership to the
+// next peer in the queue if p was the primary owner. b.mu must be locked.
+func (b *Broker) dropName(p *peer, name string) {
+	q := b.names[name]
+	if len(q) == 0 {
+		return
+	}
+	if q[0].peer != p {
+		b.names[name] = removeOwner(q, p)
+		return
+	}
+	q = q[1:]
+	if len(q) == 0 {
+		delete(b.names, name)
+		b.ownerChanged(name, p, nil)
+		return
+	}
+	b.names[name] = q
+	b.ownerChanged(name, p, q[0].peer)
+}
+
+// ownerChanged emits the signals for a change of the primary owner of name.
+// b.mu must be locked.
+func (b *Broker) ownerChanged(name string, old, new *peer) {
+	var oldName, newName string
+	if old != nil {
+		oldName = old.name
+	}
+	if new != nil {
+		newName = new.name
+	}
+	b.signal(nil, "NameOwnerChanged", name, oldName, newName)
+	if _, ok := b.peers[old]; ok {
+		b.signal(old, "NameLost", name)
+	}
+	if new != nil {
+		b.signal(new, "NameAcquired", name)
+	}
+}
+
+// listQueuedOwners returns the unique names of the peers in the queue of
+// name. b.mu must be locked.
+func (b *Broker) listQueuedOwners(name string) []string {
+	q := b.names[name]
+	out := make([]string, 0, len(q))
+	for _, o := range q {
+		out = append(out, o.peer.name)
+	}
+	return out
+}
+
+func removeOwner(q []*nameOwner, p *peer) []*nameOwner {
+	out := make([]*nameOwner, 0, len(q))
+	for _, o := range q {
+		if o.peer != p {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// isValidBusName returns whether name is a valid bus name. Unique names (which
+// start with a colon) are only accepted if unique is true.
+func isValidBusName(name string, unique bool) bool {
+	if len(name) == 0 || len(name) > 255 {
+		return false
+	}
+	if name[0] == ':' {
+		if !unique {
+			return false
+		}
+		name = name[1:]
+	}
+	elems := strings.Split(name, ".")
+	if len(elems) < 2 {
+		return false
+	}
+	for _, e := range elems {
+		if len(e) == 0 {
+			return false
+		}
+		if !unique && e[0] >= '0' && e[0] <= '9' {
+			return false
+		}
+		for _, c := range e {
+			if !(c >= '0' && c <= '9') && !(c >= 'A' && c <= 'Z') &&
+				!(c >= 'a' && c <= 'z') && c != '_' && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package broker
+
+import (
+	"sync"
+
+	"github.com/yaamai/dbus/v5"
+)
+
+// maxQueueLength is the number of messages that can be queued for a peer. As
+// with dbus-daemon's limit on outgoing bytes, peers that don't read their
+// messages fast enough are disconnected when it is exceeded.
+const maxQueueLength = 4096
+
+// peer is a connection to the bus.
+type peer struct {
+	broker *Broker
+	conn   *dbus.Conn
+
+	// closed once conn is set
+	ready chan struct{}
+
+	// the following fields are protected by broker.mu
+	name  string
+	rules []*dbus.MatchRule
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []delivery
+	maxQueue int
+	closed   bool
+}
+
+// delivery is a message queued for sending to a peer. Forwarded messages keep
+// the serial they were sent with; all others are given a new one. done, if
+// not nil, is called after the message was sent or dropped.
+type delivery struct {
+	msg     *dbus.Message
+	forward bool
+	done    func()
+}
+
+func newPeer(b *Broker) *peer {
+	p := &peer{broker: b, ready: make(chan struct{}), maxQueue: maxQueueLength}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// handleMessage is called for every message received from the peer.
+func (p *peer) handleMessage(msg *dbus.Message) {
+	<-p.ready
+	b := p.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p.name == "" {
+		if msg.Type != dbus.TypeMethodCall ||
+			headerString(msg, dbus.FieldDestination) != busName ||
+			headerString(msg, dbus.FieldMember) != "Hello" {
+			// The first message must be Hello; dbus-daemon disconnects
+			// clients that don't comply.
+			go p.conn.Close()
+			closeFDs(msg)
+			return
+		}
+		b.hello(p, msg)
+		return
+	}
+	b.route(p, msg)
+}
+
+// enqueue queues d for sending to the peer. If the queue is full, the peer is
+// disconnected.
+func (p *peer) enqueue(d delivery) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed && len(p.queue) >= p.maxQueue {
+		p.closed = true
+		p.cond.Signal()
+		go p.conn.Close()
+	}
+	if p.closed {
+		if d.done != nil {
+			d.done()
+		}
+		return
+	}
+	p.queue = append(p.queue, d)
+	p.cond.Signal()
+}
+
+// run sends the queued messages to the peer until it is closed.
+func (p *peer) run() {
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if p.closed {
+			queue := p.queue
+			p.queue = nil
+			p.mu.Unlock()
+			for _, d := range queue {
+				if d.done != nil {
+					d.done()
+				}
+			}
+			return
+		}
+		d := p.queue[0]
+		p.queue[0] = delivery{}
+		p.queue = p.queue[1:]
+		p.mu.Unlock()
+
+		if d.forward {
+			p.conn.ForwardMessage(d.msg)
+		} else {
+			p.conn.Send(d.msg, nil)
+		}
+		if d.done != nil {
+			d.done()
+		}
+	}
+}
+
+// close stops sending messages to the peer.
+func (p *peer) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.cond.Signal()
+}
@@ -3,6 +3,7 @@ package dbus
 import (
 	"context"
 	"errors"
+	"reflect"
 )
 
 var errSignature = errors.New("dbus: mismatched signature")
@@ -33,6 +34,10 @@ type Call struct {
 	// failure to make the call, ResponseSequence will be NoSequence.
 	ResponseSequence Sequence
 
+	// the unix fds received with the response that are not yet owned by
+	// the caller
+	fds []int
+
 	// tracks context and canceler
 	ctx         context.Context
 	ctxCanceler context.CancelFunc
@@ -55,12 +60,30 @@ func (c *Call) ContextCancel() {
 // Store stores the body of the reply into the provided pointers. It returns
 // an error if the signatures of the body and retvalues don't match, or if
 // the error status is not nil.
+//
+// If the body contains Unix file descriptors, Store hands them over to the
+// provided pointers, e.g. to an FD that then owns its descriptor, so it should
+// only be called once. If Store fails, the file descriptors that weren't
+// stored into an FD are closed instead. If Store is never called, the caller
+// owns the UnixFD values in Body.
 func (c *Call) Store(retvalues ...interface{}) error {
 	if c.Err != nil {
 		return c.Err
 	}
 
-	return Store(c.Body, retvalues...)
+	err := Store(c.Body, retvalues...)
+	if len(c.fds) != 0 {
+		if err != nil {
+			held := make(map[int]bool)
+			seen := make(map[uintptr]bool)
+			for _, v := range retvalues {
+				heldFDs(reflect.ValueOf(v), held, seen)
+			}
+			closeFDsExcept(c.fds, held)
+		}
+		c.fds = nil
+	}
+	return err
 }
 
 func (c *Call) done() {
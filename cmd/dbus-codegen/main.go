@@ -0,0 +1,130 @@
+// Command dbus-codegen generates Go code for D-Bus interfaces from their
+// introspection data.
+//
+// Usage:
+//
+//	dbus-codegen [flags] [file.xml ...]
+//
+// The introspection data is read from the given files, or from the standard
+// input if there are none. For every interface, a typed client, a server
+// interface and helpers for exporting it are generated; see the codegen
+// package for details.
+//
+// The flags are:
+//
+//	-package name
+//		name of the package of the generated code (required)
+//	-o file
+//		write the code to file instead of the standard output
+//	-interface name[,name...]
+//		only generate code for the given interfaces
+//	-name interface=GoName
+//		name the Go types of an interface GoName; may be repeated
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/yaamai/dbus/v5/codegen"
+	"github.com/yaamai/dbus/v5/introspect"
+)
+
+// nameFlag collects -name flags.
+type nameFlag map[string]string
+
+func (f nameFlag) String() string {
+	return ""
+}
+
+func (f nameFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return fmt.Errorf("invalid name %q, want interface=GoName", s)
+	}
+	f[s[:i]] = s[i+1:]
+	return nil
+}
+
+func main() {
+	names := make(nameFlag)
+	pkg := flag.String("package", "", "name of the package of the generated code")
+	output := flag.String("o", "", "write the code to `file` instead of the standard output")
+	ifaces := flag.String("interface", "", "comma-separated `names` of the interfaces to generate code for")
+	flag.Var(names, "name", "name the Go types of an interface (`interface=GoName`)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: dbus-codegen [flags] [file.xml ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *pkg == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := codegen.Options{Package: *pkg, Names: names}
+	if *ifaces != "" {
+		opts.Interfaces = strings.Split(*ifaces, ",")
+	}
+	var nodes []introspect.Interface
+	if flag.NArg() == 0 {
+		n, err := readNode(os.Stdin)
+		if err != nil {
+			fatal("reading standard input: %v", err)
+		}
+		nodes = append(nodes, n...)
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fatal("%v", err)
+		}
+		n, err := readNode(f)
+		f.Close()
+		if err != nil {
+			fatal("reading %s: %v", name, err)
+		}
+		nodes = append(nodes, n...)
+	}
+
+	src, err := codegen.Generate(nodes, opts)
+	if err != nil {
+		fatal("%v", err)
+	}
+	if *output == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		fatal("%v", err)
+	}
+}
+
+// readNode returns the interfaces of the introspection data read from r,
+// including those of its child nodes.
+func readNode(r io.Reader) ([]introspect.Interface, error) {
+	var node introspect.Node
+	if err := xml.NewDecoder(r).Decode(&node); err != nil {
+		return nil, err
+	}
+	var ifaces []introspect.Interface
+	var walk func(n introspect.Node)
+	walk = func(n introspect.Node) {
+		ifaces = append(ifaces, n.Interfaces...)
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	walk(node)
+	return ifaces, nil
+}
+
+func fatal(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "dbus-codegen: "+format+"\n", args...)
+	os.Exit(1)
+}
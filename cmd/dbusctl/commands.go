@@ -0,0 +1,418 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yaamai/dbus/v5"
+	"github.com/yaamai/dbus/v5/introspect"
+	"github.com/yaamai/dbus/v5/pcap"
+)
+
+// errUsage is returned by commands that were called with the wrong arguments.
+var errUsage = errors.New("usage")
+
+func runList(e *env, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	bus := e.conn.BusObject()
+	var names []string
+	if err := e.call(bus, "org.freedesktop.DBus.ListNames").Store(&names); err != nil {
+		return err
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	fmt.Fprintln(w, "NAME\tOWNER\tPID")
+	for _, name := range names {
+		owner := name
+		if !strings.HasPrefix(name, ":") {
+			if err := e.call(bus, "org.freedesktop.DBus.GetNameOwner", name).Store(&owner); err != nil {
+				owner = "-"
+			}
+		}
+		pid := "-"
+		var n uint32
+		if err := e.call(bus, "org.freedesktop.DBus.GetConnectionUnixProcessID", name).Store(&n); err == nil {
+			pid = strconv.FormatUint(uint64(n), 10)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, owner, pid)
+	}
+	return w.Flush()
+}
+
+func runTree(e *env, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errUsage
+	}
+	path := dbus.ObjectPath("/")
+	if len(args) == 2 {
+		path = dbus.ObjectPath(args[1])
+	}
+	if !path.IsValid() {
+		return fmt.Errorf("invalid object path %q", path)
+	}
+	node, err := introspect.Call(e.conn.Object(args[0], path))
+	if err != nil {
+		return err
+	}
+	var walk func(path dbus.ObjectPath, node *introspect.Node, depth int)
+	walk = func(path dbus.ObjectPath, node *introspect.Node, depth int) {
+		fmt.Printf("%s%s\n", strings.Repeat("  ", depth), path)
+		for _, child := range node.Children {
+			childPath := path + "/" + dbus.ObjectPath(child.Name)
+			if path == "/" {
+				childPath = "/" + dbus.ObjectPath(child.Name)
+			}
+			n, err := introspect.Call(e.conn.Object(args[0], childPath))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "dbusctl: %s: %v\n", childPath, err)
+				continue
+			}
+			walk(childPath, n, depth+1)
+		}
+	}
+	walk(path, node, 0)
+	return nil
+}
+
+func runIntrospect(e *env, args []string) error {
+	if len(args) != 2 && len(args) != 3 {
+		return errUsage
+	}
+	obj := e.conn.Object(args[0], dbus.ObjectPath(args[1]))
+	node, err := introspect.Call(obj)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tSIGNATURE\tRESULT/VALUE\tFLAGS")
+	found := false
+	for _, iface := range node.Interfaces {
+		if len(args) == 3 && iface.Name != args[2] {
+			continue
+		}
+		found = true
+		fmt.Fprintf(w, "%s\tinterface\t-\t-\t%s\n", iface.Name, flags(iface.Annotations))
+		for _, m := range iface.Methods {
+			var in, out string
+			for _, a := range m.Args {
+				if a.Direction == "out" {
+					out += a.Type
+				} else {
+					in += a.Type
+				}
+			}
+			fmt.Fprintf(w, ".%s\tmethod\t%s\t%s\t%s\n", m.Name, orDash(in), orDash(out), flags(m.Annotations))
+		}
+		var values map[string]dbus.Variant
+		if len(iface.Properties) > 0 {
+			e.call(obj, "org.freedesktop.DBus.Properties.GetAll", iface.Name).Store(&values)
+		}
+		for _, p := range iface.Properties {
+			value := "-"
+			if v, ok := values[p.Name]; ok {
+				value = v.String()
+			}
+			fmt.Fprintf(w, ".%s\tproperty\t%s\t%s\t%s\n", p.Name, p.Type, value, propertyFlags(iface, p))
+		}
+		for _, s := range iface.Signals {
+			var sig string
+			for _, a := range s.Args {
+				sig += a.Type
+			}
+			fmt.Fprintf(w, ".%s\tsignal\t%s\t-\t%s\n", s.Name, orDash(sig), flags(s.Annotations))
+		}
+	}
+	if len(args) == 3 && !found {
+		return fmt.Errorf("%s has no interface %s", args[1], args[2])
+	}
+	return w.Flush()
+}
+
+func runCall(e *env, args []string) error {
+	if len(args) < 4 {
+		return errUsage
+	}
+	obj := e.conn.Object(args[0], dbus.ObjectPath(args[1]))
+	types, err := e.types()
+	if err != nil {
+		return err
+	}
+	if types == nil && len(args) > 4 {
+		types = methodTypes(obj, args[2], args[3])
+	}
+	values, err := parseArgs(args[4:], types)
+	if err != nil {
+		return err
+	}
+	call := e.call(obj, args[2]+"."+args[3], values...)
+	if call.Err != nil {
+		return call.Err
+	}
+	for _, v := range call.Body {
+		fmt.Println(dbus.MakeVariant(v).String())
+	}
+	return nil
+}
+
+func runGetProperty(e *env, args []string) error {
+	if len(args) < 4 {
+		return errUsage
+	}
+	obj := e.conn.Object(args[0], dbus.ObjectPath(args[1]))
+	for _, name := range args[3:] {
+		var v dbus.Variant
+		err := e.call(obj, "org.freedesktop.DBus.Properties.Get", args[2], name).Store(&v)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		fmt.Println(v.String())
+	}
+	return nil
+}
+
+func runSetProperty(e *env, args []string) error {
+	if len(args) != 5 {
+		return errUsage
+	}
+	obj := e.conn.Object(args[0], dbus.ObjectPath(args[1]))
+	types, err := e.types()
+	if err != nil {
+		return err
+	}
+	if types == nil {
+		var v dbus.Variant
+		err := e.call(obj, "org.freedesktop.DBus.Properties.Get", args[2], args[3]).Store(&v)
+		if err == nil {
+			types = []dbus.Signature{v.Signature()}
+		}
+	}
+	values, err := parseArgs(args[4:], types)
+	if err != nil {
+		return err
+	}
+	return e.call(obj, "org.freedesktop.DBus.Properties.Set", args[2], args[3], dbus.MakeVariant(values[0])).Err
+}
+
+func runEmit(e *env, args []string) error {
+	if len(args) < 3 {
+		return errUsage
+	}
+	types, err := e.types()
+	if err != nil {
+		return err
+	}
+	values, err := parseArgs(args[3:], types)
+	if err != nil {
+		return err
+	}
+	return e.conn.Emit(dbus.ObjectPath(args[0]), args[1]+"."+args[2], values...)
+}
+
+func runMonitor(e *env, args []string) error {
+	ch := make(chan *dbus.Message, 64)
+	if err := e.conn.BecomeMonitor(ch, args...); err != nil {
+		// Buses without the monitoring interface still support
+		// eavesdropping.
+		rules := args
+		if len(rules) == 0 {
+			rules = []string{"type='signal'", "type='method_call'", "type='method_return'", "type='error'"}
+		}
+		for _, rule := range rules {
+			rule = "eavesdrop='true'," + rule
+			if err := e.call(e.conn.BusObject(), "org.freedesktop.DBus.AddMatch", rule).Err; err != nil {
+				return err
+			}
+		}
+		e.conn.Eavesdrop(ch)
+	}
+	for msg := range ch {
+		fmt.Println(msg)
+	}
+	return nil
+}
+
+func runCapture(e *env, args []string) error {
+	ch := make(chan *dbus.Message, 64)
+	if err := e.conn.BecomeMonitor(ch, args...); err != nil {
+		return err
+	}
+	w, err := pcap.NewWriter(os.Stdout)
+	if err != nil {
+		return err
+	}
+	for msg := range ch {
+		if err := w.WriteMessage(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// types returns the types given with -signature, or nil if there are none.
+func (e *env) types() ([]dbus.Signature, error) {
+	if e.signature == "" {
+		return nil, nil
+	}
+	return splitSignature(e.signature)
+}
+
+// methodTypes returns the types of the input arguments of a method according
+// to the introspection data of obj, or nil if they aren't known.
+func methodTypes(obj dbus.BusObject, iface, method string) []dbus.Signature {
+	node, err := introspect.Call(obj)
+	if err != nil {
+		return nil
+	}
+	for _, i := range node.Interfaces {
+		if i.Name != iface {
+			continue
+		}
+		for _, m := range i.Methods {
+			if m.Name != method {
+				continue
+			}
+			var types []dbus.Signature
+			for _, a := range m.Args {
+				if a.Direction == "out" {
+					continue
+				}
+				sig, err := dbus.ParseSignature(a.Type)
+				if err != nil {
+					return nil
+				}
+				types = append(types, sig)
+			}
+			return types
+		}
+	}
+	return nil
+}
+
+// parseArgs parses args in the GVariant text format as values of the given
+// types. If types is nil, the types are inferred from the text. Arguments of
+// type STRING, OBJECT_PATH and SIGNATURE that aren't quoted are taken
+// literally.
+func parseArgs(args []string, types []dbus.Signature) ([]interface{}, error) {
+	if types != nil && len(types) != len(args) {
+		return nil, fmt.Errorf("%d arguments given for %d types", len(args), len(types))
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		var sig dbus.Signature
+		if types != nil {
+			sig = types[i]
+		}
+		v, err := dbus.ParseVariant(arg, sig)
+		if err != nil {
+			switch sig.String() {
+			case "s":
+				values[i] = arg
+				continue
+			case "o":
+				values[i] = dbus.ObjectPath(arg)
+				continue
+			case "g":
+				if s, err := dbus.ParseSignature(arg); err == nil {
+					values[i] = s
+					continue
+				}
+			}
+			return nil, fmt.Errorf("argument %d: %v", i+1, err)
+		}
+		values[i] = v.Value()
+	}
+	return values, nil
+}
+
+// splitSignature splits s into its complete types.
+func splitSignature(s string) ([]dbus.Signature, error) {
+	if _, err := dbus.ParseSignature(s); err != nil {
+		return nil, err
+	}
+	types := []dbus.Signature{}
+	for s != "" {
+		n := 0
+		for s[n] == 'a' {
+			n++
+		}
+		if s[n] == '(' || s[n] == '{' {
+			depth := 0
+			for {
+				switch s[n] {
+				case '(', '{':
+					depth++
+				case ')', '}':
+					depth--
+				}
+				n++
+				if depth == 0 {
+					break
+				}
+			}
+		} else {
+			n++
+		}
+		types = append(types, dbus.ParseSignatureMust(s[:n]))
+		s = s[n:]
+	}
+	return types, nil
+}
+
+// flags returns the flags that annotations give a member, as shown by
+// introspect.
+func flags(annotations []introspect.Annotation, extra ...string) string {
+	s := extra
+	for _, a := range annotations {
+		if a.Value != "true" {
+			continue
+		}
+		switch a.Name {
+		case dbus.AnnotationDeprecated:
+			s = append(s, "deprecated")
+		case dbus.AnnotationMethodNoReply:
+			s = append(s, "no-reply")
+		}
+	}
+	if len(s) == 0 {
+		return "-"
+	}
+	return strings.Join(s, " ")
+}
+
+func propertyFlags(iface introspect.Interface, p introspect.Property) string {
+	var extra []string
+	if strings.Contains(p.Access, "write") {
+		extra = append(extra, "writable")
+	}
+	emit := "true"
+	for _, annotations := range [][]introspect.Annotation{iface.Annotations, p.Annotations} {
+		for _, a := range annotations {
+			if a.Name == dbus.AnnotationEmitsChangedSignal {
+				emit = a.Value
+			}
+		}
+	}
+	switch emit {
+	case "true":
+		extra = append(extra, "emits-change")
+	case "invalidates":
+		extra = append(extra, "emits-invalidation")
+	case "const":
+		extra = append(extra, "const")
+	}
+	return flags(p.Annotations, extra...)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
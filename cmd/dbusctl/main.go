@@ -0,0 +1,162 @@
+// Command dbusctl inspects and calls services on a D-Bus message bus, in the
+// spirit of busctl. Values are parsed and printed in the GVariant text format,
+// using ParseVariant and Variant.String of the dbus package.
+//
+// Usage:
+//
+//	dbusctl [flags] command [arguments]
+//
+// The commands are:
+//
+//	list
+//		list the names on the bus with their owners and process IDs
+//	tree destination [path]
+//		show the object tree of a service
+//	introspect destination path [interface]
+//		show the methods, properties and signals of an object
+//	call [-signature sig] destination path interface method [argument ...]
+//		call a method and print the values of the reply
+//	get-property destination path interface property ...
+//		print the values of properties
+//	set-property [-signature sig] destination path interface property value
+//		set the value of a property
+//	emit [-signature sig] path interface signal [argument ...]
+//		emit a signal
+//	monitor [rule ...]
+//		print the messages on the bus that match any of the rules
+//	capture [rule ...]
+//		like monitor, but write the messages to the standard output as a
+//		pcap file
+//
+// Arguments are parsed with the types given by -signature. Without it, call
+// takes the types from the introspection data of the object, set-property
+// from the current value of the property, and otherwise the types are
+// inferred from the text of the arguments.
+//
+// The flags are:
+//
+//	-system
+//		connect to the system bus instead of the session bus
+//	-address address
+//		connect to the bus at address
+//	-timeout duration
+//		time out method calls after duration (default 25s)
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/yaamai/dbus/v5"
+)
+
+// command is a subcommand of dbusctl.
+type command struct {
+	name  string
+	args  string
+	usage string
+	run   func(e *env, args []string) error
+
+	// signature indicates whether the command accepts -signature.
+	signature bool
+}
+
+var commands = []command{
+	{"list", "", "list the names on the bus with their owners and process IDs", runList, false},
+	{"tree", "destination [path]", "show the object tree of a service", runTree, false},
+	{"introspect", "destination path [interface]", "show the methods, properties and signals of an object", runIntrospect, false},
+	{"call", "destination path interface method [argument ...]", "call a method and print the values of the reply", runCall, true},
+	{"get-property", "destination path interface property ...", "print the values of properties", runGetProperty, false},
+	{"set-property", "destination path interface property value", "set the value of a property", runSetProperty, true},
+	{"emit", "path interface signal [argument ...]", "emit a signal", runEmit, true},
+	{"monitor", "[rule ...]", "print the messages on the bus that match any of the rules", runMonitor, false},
+	{"capture", "[rule ...]", "write the messages on the bus that match any of the rules as a pcap file", runCapture, false},
+}
+
+// env holds the state shared by all commands.
+type env struct {
+	conn      *dbus.Conn
+	timeout   time.Duration
+	signature string
+}
+
+func main() {
+	system := flag.Bool("system", false, "connect to the system bus instead of the session bus")
+	address := flag.String("address", "", "connect to the bus at `address`")
+	timeout := flag.Duration("timeout", 25*time.Second, "time out method calls after `duration`")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == flag.Arg(0) {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "dbusctl: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	e := &env{timeout: *timeout}
+	flags := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	if cmd.signature {
+		flags.StringVar(&e.signature, "signature", "", "parse the arguments as values of the types in `sig`")
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: dbusctl %s %s\n", cmd.name, cmd.args)
+		flags.PrintDefaults()
+	}
+	flags.Parse(flag.Args()[1:])
+
+	var err error
+	switch {
+	case *address != "":
+		e.conn, err = dbus.Connect(*address)
+	case *system:
+		e.conn, err = dbus.ConnectSystemBus()
+	default:
+		e.conn, err = dbus.ConnectSessionBus()
+	}
+	if err != nil {
+		fatal("%v", err)
+	}
+	err = cmd.run(e, flags.Args())
+	e.conn.Close()
+	if err == errUsage {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal("%v", err)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: dbusctl [flags] command [arguments]\n\nThe commands are:\n\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "\t%s %s\n\t\t%s\n", cmd.name, cmd.args, cmd.usage)
+	}
+	fmt.Fprintf(out, "\nThe flags are:\n\n")
+	flag.PrintDefaults()
+}
+
+// call calls method on obj, timing out after the timeout of e.
+func (e *env) call(obj dbus.BusObject, method string, args ...interface{}) *dbus.Call {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	return obj.CallWithContext(ctx, method, 0, args...)
+}
+
+func fatal(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "dbusctl: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,477 @@
+// Package codegen generates Go code for D-Bus interfaces from their
+// introspection data. For every interface, it generates a typed client for
+// remote objects, with methods for calling its methods, getting and setting
+// its properties and watching its signals, as well as a server interface that
+// can be exported with Conn.ExportMethodTableWithSpec, functions for emitting
+// its signals and a struct holding its properties for prop.Export.
+//
+// The cmd/dbus-codegen command makes the generator available on the command
+// line.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+
+	"github.com/yaamai/dbus/v5"
+	"github.com/yaamai/dbus/v5/introspect"
+)
+
+// Options controls the code that Generate generates.
+type Options struct {
+	// Package is the name of the package of the generated code.
+	Package string
+
+	// Interfaces lists the names of the interfaces to generate code for. If
+	// it is empty, code is generated for all interfaces except the standard
+	// ones, whose names start with "org.freedesktop.DBus.".
+	Interfaces []string
+
+	// Names maps interface names to the names of the generated Go types. By
+	// default, the last element of the interface name is used, so that
+	// org.freedesktop.NetworkManager.Device becomes Device.
+	Names map[string]string
+}
+
+// Generate returns the formatted source code of a Go file containing the code
+// for the given interfaces.
+func Generate(ifaces []introspect.Interface, opts Options) ([]byte, error) {
+	if opts.Package == "" {
+		return nil, fmt.Errorf("codegen: no package name given")
+	}
+	selected, err := selectInterfaces(ifaces, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{}
+	for _, iface := range selected {
+		if err := g.generateInterface(iface, goName(iface.Name, opts.Names)); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by dbus-codegen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\nimport (\n", opts.Package)
+	if g.usesContext {
+		out.WriteString("\t\"context\"\n\n")
+	}
+	out.WriteString("\t\"github.com/yaamai/dbus/v5\"\n")
+	if g.usesProp {
+		out.WriteString("\t\"github.com/yaamai/dbus/v5/prop\"\n")
+	}
+	out.WriteString(")\n")
+	out.Write(g.buf.Bytes())
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("codegen: generated invalid code: %v", err)
+	}
+	return src, nil
+}
+
+// selectInterfaces returns the interfaces that code is generated for, in the
+// order in which they are given in ifaces.
+func selectInterfaces(ifaces []introspect.Interface, opts Options) ([]introspect.Interface, error) {
+	wanted := make(map[string]bool, len(opts.Interfaces))
+	for _, name := range opts.Interfaces {
+		wanted[name] = true
+	}
+	var selected []introspect.Interface
+	seen := make(map[string]bool)
+	goNames := make(map[string]string)
+	for _, iface := range ifaces {
+		if seen[iface.Name] {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[iface.Name] ||
+			len(wanted) == 0 && strings.HasPrefix(iface.Name, "org.freedesktop.DBus.") {
+			continue
+		}
+		seen[iface.Name] = true
+		name := goName(iface.Name, opts.Names)
+		if other, ok := goNames[name]; ok {
+			return nil, fmt.Errorf("codegen: interfaces %s and %s would both be named %s", other, iface.Name, name)
+		}
+		goNames[name] = iface.Name
+		selected = append(selected, iface)
+	}
+	for name := range wanted {
+		if !seen[name] {
+			return nil, fmt.Errorf("codegen: interface %s not found", name)
+		}
+	}
+	return selected, nil
+}
+
+// goName returns the name of the Go types generated for the named interface.
+func goName(iface string, names map[string]string) string {
+	if name, ok := names[iface]; ok {
+		return name
+	}
+	return exportedName(iface[strings.LastIndex(iface, ".")+1:])
+}
+
+type generator struct {
+	buf         bytes.Buffer
+	usesContext bool
+	usesProp    bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// arg is an argument of a method or signal.
+type arg struct {
+	name   string // name of the Go parameter
+	goType string
+}
+
+// args converts the arguments of a method or signal with the given direction
+// into Go parameters with names that aren't in used yet, and adds the names
+// to used. If direction is empty, all arguments are converted.
+func args(member string, in []introspect.Arg, direction string, used map[string]bool) ([]arg, error) {
+	var out []arg
+	for i, a := range in {
+		dir := a.Direction
+		if dir == "" {
+			dir = "in"
+		}
+		if direction != "" && dir != direction {
+			continue
+		}
+		t, err := goType(a.Type)
+		if err != nil {
+			return nil, fmt.Errorf("codegen: argument %d of %s: %v", i, member, err)
+		}
+		name := argName(a.Name, i)
+		for used[name] {
+			name += "_"
+		}
+		used[name] = true
+		out = append(out, arg{name: name, goType: t})
+	}
+	return out, nil
+}
+
+func params(args []arg) string {
+	s := make([]string, len(args))
+	for i, a := range args {
+		s[i] = a.name + " " + a.goType
+	}
+	return strings.Join(s, ", ")
+}
+
+func names(args []arg) string {
+	s := make([]string, len(args))
+	for i, a := range args {
+		s[i] = a.name
+	}
+	return strings.Join(s, ", ")
+}
+
+func annotation(annotations []introspect.Annotation, name string) (string, bool) {
+	for _, a := range annotations {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// deprecated prints a deprecation notice if annotations mark an element as
+// deprecated.
+func (g *generator) deprecated(annotations []introspect.Annotation) {
+	if v, _ := annotation(annotations, dbus.AnnotationDeprecated); v == "true" {
+		g.printf("//\n// Deprecated: deprecated in the D-Bus interface.\n")
+	}
+}
+
+func (g *generator) generateInterface(iface introspect.Interface, name string) error {
+	// Check the arguments before anything is generated, so that errors
+	// don't leave incomplete code behind.
+	methodArgs := make([][2][]arg, len(iface.Methods))
+	members := make(map[string]string)
+	claim := func(goName, member string) error {
+		if other, ok := members[goName]; ok {
+			return fmt.Errorf("codegen: %s and %s of %s would both be named %s", other, member, iface.Name, goName)
+		}
+		members[goName] = member
+		return nil
+	}
+	claim("Object", "the accessor of the remote object")
+	for i, m := range iface.Methods {
+		used := make(map[string]bool)
+		in, err := args(m.Name, m.Args, "in", used)
+		if err != nil {
+			return err
+		}
+		out, err := args(m.Name, m.Args, "out", used)
+		if err != nil {
+			return err
+		}
+		methodArgs[i] = [2][]arg{in, out}
+		if err := claim(exportedName(m.Name), "method "+m.Name); err != nil {
+			return err
+		}
+	}
+	propTypes := make([]string, len(iface.Properties))
+	for i, p := range iface.Properties {
+		t, err := goType(p.Type)
+		if err != nil {
+			return fmt.Errorf("codegen: property %s of %s: %v", p.Name, iface.Name, err)
+		}
+		propTypes[i] = t
+		if strings.Contains(p.Access, "read") {
+			if err := claim("Get"+exportedName(p.Name), "property "+p.Name); err != nil {
+				return err
+			}
+		}
+		if strings.Contains(p.Access, "write") {
+			if err := claim("Set"+exportedName(p.Name), "property "+p.Name); err != nil {
+				return err
+			}
+		}
+	}
+	signalArgs := make([][]arg, len(iface.Signals))
+	for i, s := range iface.Signals {
+		a, err := args(s.Name, s.Args, "", make(map[string]bool))
+		if err != nil {
+			return err
+		}
+		signalArgs[i] = a
+		if err := claim("Watch"+exportedName(s.Name), "signal "+s.Name); err != nil {
+			return err
+		}
+	}
+	if len(iface.Methods)+len(iface.Properties)+len(iface.Signals) > 0 {
+		g.usesContext = true
+	}
+
+	g.printf("\n// %sInterface is the name of the %s interface.\n", name, iface.Name)
+	g.printf("const %sInterface = %s\n", name, strconv.Quote(iface.Name))
+
+	// client
+	g.printf("\n// %s is a client for the %s interface of a remote object.\n", name, iface.Name)
+	g.deprecated(iface.Annotations)
+	g.printf("type %s struct {\n\tconn *dbus.Conn\n\tobj dbus.BusObject\n}\n", name)
+	g.printf("\n// New%s returns a client for the %s interface of obj, which must be an\n// object on conn.\n", name, iface.Name)
+	g.printf("func New%[1]s(conn *dbus.Conn, obj dbus.BusObject) *%[1]s {\n\treturn &%[1]s{conn, obj}\n}\n", name)
+	g.printf("\n// Object returns the remote object.\nfunc (c *%s) Object() dbus.BusObject {\n\treturn c.obj\n}\n", name)
+	for i, m := range iface.Methods {
+		g.generateClientMethod(name, m, methodArgs[i][0], methodArgs[i][1])
+	}
+	for i, p := range iface.Properties {
+		g.generateClientProperty(name, p, propTypes[i])
+	}
+	for i, s := range iface.Signals {
+		g.generateClientSignal(name, s, signalArgs[i])
+	}
+
+	// server
+	g.printf("\n// %[1]sServer is the server side of the %[2]s interface. Use\n// Export%[1]s to export it.\n", name, iface.Name)
+	g.printf("type %sServer interface {\n", name)
+	for i, m := range iface.Methods {
+		out := methodArgs[i][1]
+		results := make([]string, 0, len(out)+1)
+		for _, a := range out {
+			results = append(results, a.name+" "+a.goType)
+		}
+		results = append(results, "err *dbus.Error")
+		g.printf("\t// %s implements %s.%s.\n", exportedName(m.Name), iface.Name, m.Name)
+		g.printf("\t%s(%s) (%s)\n", exportedName(m.Name), params(methodArgs[i][0]), strings.Join(results, ", "))
+	}
+	g.printf("}\n")
+	g.generateSpec(name, iface, methodArgs)
+	g.printf("\n// Export%[1]s exports v as the %[2]s interface on path.\n", name, iface.Name)
+	g.printf("func Export%[1]s(conn *dbus.Conn, path dbus.ObjectPath, v %[1]sServer) error {\n", name)
+	g.printf("\treturn conn.ExportMethodTableWithSpec(map[string]interface{}{\n")
+	for _, m := range iface.Methods {
+		g.printf("\t\t%s: v.%s,\n", strconv.Quote(m.Name), exportedName(m.Name))
+	}
+	g.printf("\t}, %[1]sSpec, path, %[1]sInterface)\n}\n", name)
+	for i, s := range iface.Signals {
+		g.printf("\n// Emit%[1]s%[2]s emits the %[3]s signal of the %[4]s interface on path.\n",
+			name, exportedName(s.Name), s.Name, iface.Name)
+		g.deprecated(s.Annotations)
+		g.printf("func Emit%s%s(conn *dbus.Conn, path dbus.ObjectPath", name, exportedName(s.Name))
+		if len(signalArgs[i]) > 0 {
+			g.printf(", %s", params(signalArgs[i]))
+		}
+		g.printf(") error {\n\treturn conn.Emit(path, %sInterface+%s", name, strconv.Quote("."+s.Name))
+		if len(signalArgs[i]) > 0 {
+			g.printf(", %s", names(signalArgs[i]))
+		}
+		g.printf(")\n}\n")
+	}
+	if len(iface.Properties) > 0 {
+		g.generateServerProperties(name, iface, propTypes)
+	}
+	return nil
+}
+
+func (g *generator) generateClientMethod(name string, m introspect.Method, in, out []arg) {
+	method := exportedName(m.Name)
+	g.printf("\n// %s calls %s on the object.\n", method, m.Name)
+	g.deprecated(m.Annotations)
+	flags := "0"
+	if v, _ := annotation(m.Annotations, dbus.AnnotationMethodNoReply); v == "true" {
+		flags = "dbus.FlagNoReplyExpected"
+	}
+	call := fmt.Sprintf("c.obj.CallWithContext(ctx, %sInterface+%s, %s", name, strconv.Quote("."+m.Name), flags)
+	if len(in) > 0 {
+		call += ", " + names(in)
+	}
+	call += ")"
+	g.printf("func (c *%s) %s(ctx context.Context", name, method)
+	if len(in) > 0 {
+		g.printf(", %s", params(in))
+	}
+	if len(out) == 0 {
+		g.printf(") error {\n\treturn %s.Err\n}\n", call)
+		return
+	}
+	ptrs := make([]string, len(out))
+	for i, a := range out {
+		ptrs[i] = "&" + a.name
+	}
+	g.printf(") (%s, err error) {\n", params(out))
+	g.printf("\terr = %s.Store(%s)\n\treturn\n}\n", call, strings.Join(ptrs, ", "))
+}
+
+func (g *generator) generateClientProperty(name string, p introspect.Property, goType string) {
+	prop := exportedName(p.Name)
+	if strings.Contains(p.Access, "read") {
+		g.printf("\n// Get%s returns the value of the %s property of the object.\n", prop, p.Name)
+		g.deprecated(p.Annotations)
+		g.printf("func (c *%s) Get%s(ctx context.Context) (v %s, err error) {\n", name, prop, goType)
+		g.printf("\terr = c.obj.CallWithContext(ctx, \"org.freedesktop.DBus.Properties.Get\", 0, %sInterface, %s).Store(&v)\n",
+			name, strconv.Quote(p.Name))
+		g.printf("\treturn\n}\n")
+	}
+	if strings.Contains(p.Access, "write") {
+		g.printf("\n// Set%s sets the %s property of the object.\n", prop, p.Name)
+		g.deprecated(p.Annotations)
+		g.printf("func (c *%s) Set%s(ctx context.Context, v %s) error {\n", name, prop, goType)
+		g.printf("\treturn c.obj.CallWithContext(ctx, \"org.freedesktop.DBus.Properties.Set\", 0, %sInterface, %s, dbus.MakeVariant(v)).Err\n",
+			name, strconv.Quote(p.Name))
+		g.printf("}\n")
+	}
+}
+
+func (g *generator) generateClientSignal(name string, s introspect.Signal, args []arg) {
+	signal := exportedName(s.Name)
+	g.printf("\n// Watch%s calls fn with the arguments of every %s signal of the object\n", signal, s.Name)
+	g.printf("// until ctx is done or the returned subscription is closed.\n")
+	g.deprecated(s.Annotations)
+	g.printf("func (c *%s) Watch%s(ctx context.Context, fn func(%s)) (*dbus.Subscription, error) {\n", name, signal, params(args))
+	g.printf("\tsub, err := c.conn.Subscribe(ctx,\n")
+	g.printf("\t\tdbus.WithMatchSender(c.obj.Destination()),\n")
+	g.printf("\t\tdbus.WithMatchObjectPath(c.obj.Path()),\n")
+	g.printf("\t\tdbus.WithMatchInterface(%sInterface),\n", name)
+	g.printf("\t\tdbus.WithMatchMember(%s),\n", strconv.Quote(s.Name))
+	g.printf("\t)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+	if len(args) == 0 {
+		g.printf("\tgo func() {\n\t\tfor range sub.C {\n\t\t\tfn()\n")
+	} else {
+		g.printf("\tgo func() {\n\t\tfor sig := range sub.C {\n")
+		ptrs := make([]string, len(args))
+		for i, a := range args {
+			g.printf("\t\t\tvar %s %s\n", a.name, a.goType)
+			ptrs[i] = "&" + a.name
+		}
+		g.printf("\t\t\tif dbus.Store(sig.Body, %s) == nil {\n\t\t\t\tfn(%s)\n\t\t\t}\n", strings.Join(ptrs, ", "), names(args))
+	}
+	g.printf("\t\t}\n\t}()\n\treturn sub, nil\n}\n")
+}
+
+// generateSpec generates the dbus.InterfaceSpec that describes iface.
+func (g *generator) generateSpec(name string, iface introspect.Interface, methodArgs [][2][]arg) {
+	g.printf("\n// %sSpec describes the %s interface for exporting it.\n", name, iface.Name)
+	g.printf("var %sSpec = dbus.InterfaceSpec{\n", name)
+	if len(iface.Methods) > 0 {
+		g.printf("\tMethods: map[string]dbus.MethodSpec{\n")
+		for _, m := range iface.Methods {
+			g.printf("\t\t%s: {\n", strconv.Quote(m.Name))
+			g.printf("\t\t\tArgs: []dbus.ArgSpec{\n")
+			for _, a := range m.Args {
+				dir := a.Direction
+				if dir == "" {
+					dir = "in"
+				}
+				g.printf("\t\t\t\t{Name: %s, Type: dbus.ParseSignatureMust(%s), Direction: %s},\n",
+					strconv.Quote(a.Name), strconv.Quote(a.Type), strconv.Quote(dir))
+			}
+			g.printf("\t\t\t},\n")
+			g.annotations("\t\t\t", m.Annotations)
+			g.printf("\t\t},\n")
+		}
+		g.printf("\t},\n")
+	}
+	if len(iface.Signals) > 0 {
+		g.printf("\tSignals: []dbus.SignalSpec{\n")
+		for _, s := range iface.Signals {
+			g.printf("\t\t{\n\t\t\tName: %s,\n", strconv.Quote(s.Name))
+			if len(s.Args) > 0 {
+				g.printf("\t\t\tArgs: []dbus.ArgSpec{\n")
+				for _, a := range s.Args {
+					g.printf("\t\t\t\t{Name: %s, Type: dbus.ParseSignatureMust(%s), Direction: \"out\"},\n",
+						strconv.Quote(a.Name), strconv.Quote(a.Type))
+				}
+				g.printf("\t\t\t},\n")
+			}
+			g.annotations("\t\t\t", s.Annotations)
+			g.printf("\t\t},\n")
+		}
+		g.printf("\t},\n")
+	}
+	g.annotations("\t", iface.Annotations)
+	g.printf("}\n")
+}
+
+func (g *generator) annotations(indent string, annotations []introspect.Annotation) {
+	if len(annotations) == 0 {
+		return
+	}
+	g.printf("%sAnnotations: []dbus.Annotation{\n", indent)
+	for _, a := range annotations {
+		g.printf("%s\t{Name: %s, Value: %s},\n", indent, strconv.Quote(a.Name), strconv.Quote(a.Value))
+	}
+	g.printf("%s},\n", indent)
+}
+
+// generateServerProperties generates the struct that holds the properties of
+// iface for prop.Export.
+func (g *generator) generateServerProperties(name string, iface introspect.Interface, propTypes []string) {
+	g.usesProp = true
+	g.printf("\n// %sProperties holds the values of the properties of the %s\n// interface.\n", name, iface.Name)
+	g.printf("type %sProperties struct {\n", name)
+	for i, p := range iface.Properties {
+		g.printf("\t%s %s\n", exportedName(p.Name), propTypes[i])
+	}
+	g.printf("}\n")
+	g.printf("\n// Props returns the properties with the values of p, for use with\n// prop.Export.\n")
+	g.printf("func (p %sProperties) Props() map[string]*prop.Prop {\n", name)
+	g.printf("\treturn map[string]*prop.Prop{\n")
+	for _, p := range iface.Properties {
+		emit, ok := annotation(p.Annotations, dbus.AnnotationEmitsChangedSignal)
+		if !ok {
+			emit, _ = annotation(iface.Annotations, dbus.AnnotationEmitsChangedSignal)
+		}
+		switch emit {
+		case "false", "const":
+			emit = "prop.EmitFalse"
+		case "invalidates":
+			emit = "prop.EmitInvalidates"
+		default:
+			emit = "prop.EmitTrue"
+		}
+		g.printf("\t\t%s: {Value: p.%s, Writable: %v, Emit: %s},\n",
+			strconv.Quote(p.Name), exportedName(p.Name), strings.Contains(p.Access, "write"), emit)
+	}
+	g.printf("\t}\n}\n")
+}
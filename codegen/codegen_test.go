@@ -0,0 +1,91 @@
+package codegen
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/yaamai/dbus/v5/introspect"
+)
+
+func readInterfaces(t *testing.T, data []byte) []introspect.Interface {
+	var node introspect.Node
+	if err := xml.Unmarshal(data, &node); err != nil {
+		t.Fatal(err)
+	}
+	return node.Interfaces
+}
+
+// TestGenerateExample checks that the generated code in internal/gentest,
+// which is tested there, is up to date.
+func TestGenerateExample(t *testing.T) {
+	data, err := ioutil.ReadFile("internal/gentest/example.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile("internal/gentest/gentest.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Generate(readInterfaces(t, data), Options{Package: "gentest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("internal/gentest/gentest.go is out of date, run go generate")
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, tc := range []struct {
+		xml  string
+		opts Options
+		err  string
+	}{
+		{
+			`<node><interface name="a.Foo"/><interface name="b.Foo"/></node>`,
+			Options{Package: "p"},
+			"would both be named Foo",
+		},
+		{
+			`<node><interface name="a.Foo"/></node>`,
+			Options{Package: "p", Interfaces: []string{"a.Bar"}},
+			"interface a.Bar not found",
+		},
+		{
+			`<node><interface name="a.Foo"><method name="M"><arg type="a" direction="in"/></method></interface></node>`,
+			Options{Package: "p"},
+			"argument 0 of M",
+		},
+		{
+			`<node><interface name="a.Foo"><method name="GetX"/><property name="X" type="s" access="read"/></interface></node>`,
+			Options{Package: "p"},
+			"would both be named GetX",
+		},
+	} {
+		_, err := Generate(readInterfaces(t, []byte(tc.xml)), tc.opts)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Generate(%s) returned %v, want error containing %q", tc.xml, err, tc.err)
+		}
+	}
+}
+
+func TestGoType(t *testing.T) {
+	for sig, want := range map[string]string{
+		"s":       "string",
+		"ao":      "[]dbus.ObjectPath",
+		"a{sv}":   "map[string]dbus.Variant",
+		"a{sas}":  "map[string][]string",
+		"(ia(s))": "struct{ V0 int32; V1 []struct{ V0 string } }",
+	} {
+		got, err := goType(sig)
+		if err != nil || got != want {
+			t.Errorf("goType(%q) = %q, %v; want %q", sig, got, err, want)
+		}
+	}
+	if _, err := goType("si"); err == nil {
+		t.Error("goType accepted multiple types")
+	}
+}
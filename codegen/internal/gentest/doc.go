@@ -0,0 +1,5 @@
+// Package gentest contains the code generated for example.xml, which is used
+// to test the generator.
+package gentest
+
+//go:generate go run ../../../cmd/dbus-codegen -package gentest -o gentest.go example.xml
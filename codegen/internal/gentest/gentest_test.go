@@ -0,0 +1,119 @@
+package gentest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yaamai/dbus/v5"
+	"github.com/yaamai/dbus/v5/prop"
+)
+
+type device struct {
+	name   string
+	poked  chan struct{}
+	values []int32
+}
+
+func (d *device) Rename(newName string) (string, *dbus.Error) {
+	old := d.name
+	d.name = newName
+	return old, nil
+}
+
+func (d *device) Sum(values []int32) (sum int64, stats struct {
+	V0 int32
+	V1 uint32
+}, err *dbus.Error) {
+	for _, v := range values {
+		sum += int64(v)
+	}
+	stats.V1 = uint32(len(values))
+	return sum, stats, nil
+}
+
+func (d *device) Poke() *dbus.Error {
+	d.poked <- struct{}{}
+	return nil
+}
+
+func (d *device) Reset() *dbus.Error {
+	return nil
+}
+
+func TestGeneratedCode(t *testing.T) {
+	srv, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const path = "/org/godbus/example/dev0"
+	d := &device{name: "dev0", poked: make(chan struct{}, 1)}
+	if err := ExportDevice(srv, path, d); err != nil {
+		t.Fatal(err)
+	}
+	props := DeviceProperties{Name: "dev0"}
+	_, err = prop.Export(srv, path, map[string]map[string]*prop.Prop{DeviceInterface: props.Props()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := NewDevice(conn, conn.Object(srv.Names()[0], path))
+
+	renamed := make(chan string, 1)
+	sub, err := c.WatchRenamed(ctx, func(name string, typeArg uint32) {
+		renamed <- name
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	old, err := c.Rename(ctx, "dev1")
+	if err != nil || old != "dev0" {
+		t.Errorf("Rename returned %q, %v", old, err)
+	}
+	sum, stats, err := c.Sum(ctx, []int32{1, 2, 3})
+	if err != nil || sum != 6 || stats.V1 != 3 {
+		t.Errorf("Sum returned %d, %v, %v", sum, stats, err)
+	}
+	if err := c.Poke(ctx); err != nil {
+		t.Errorf("Poke returned %v", err)
+	}
+	select {
+	case <-d.poked:
+	case <-ctx.Done():
+		t.Error("Poke wasn't called")
+	}
+
+	if name, err := c.GetName(ctx); err != nil || name != "dev0" {
+		t.Errorf("GetName returned %q, %v", name, err)
+	}
+	options := map[string]dbus.Variant{"verbose": dbus.MakeVariant(true)}
+	if err := c.SetOptions(ctx, options); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.GetOptions(ctx); err != nil || got["verbose"].Value() != true {
+		t.Errorf("GetOptions returned %v, %v", got, err)
+	}
+
+	if err := EmitDeviceRenamed(srv, path, "dev1", 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case name := <-renamed:
+		if name != "dev1" {
+			t.Errorf("got Renamed(%q), want dev1", name)
+		}
+	case <-ctx.Done():
+		t.Error("timed out waiting for Renamed")
+	}
+}
@@ -0,0 +1,136 @@
+package codegen
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"strings"
+	"unicode"
+
+	"github.com/yaamai/dbus/v5"
+)
+
+// goType returns the Go type that values of the D-Bus type sig are stored in.
+// Structs are represented as anonymous Go structs with the fields V0, V1 and so
+// on.
+func goType(sig string) (string, error) {
+	if _, err := dbus.ParseSignature(sig); err != nil {
+		return "", err
+	}
+	t, rest := goTypeOf(sig)
+	if rest != "" {
+		return "", fmt.Errorf("codegen: %q is not a single complete type", sig)
+	}
+	return t, nil
+}
+
+// goTypeOf returns the Go type of the first complete type in sig, which must
+// be a valid signature, and the rest of sig.
+func goTypeOf(sig string) (string, string) {
+	switch sig[0] {
+	case 'y':
+		return "byte", sig[1:]
+	case 'b':
+		return "bool", sig[1:]
+	case 'n':
+		return "int16", sig[1:]
+	case 'q':
+		return "uint16", sig[1:]
+	case 'i':
+		return "int32", sig[1:]
+	case 'u':
+		return "uint32", sig[1:]
+	case 'x':
+		return "int64", sig[1:]
+	case 't':
+		return "uint64", sig[1:]
+	case 'd':
+		return "float64", sig[1:]
+	case 'h':
+		return "dbus.UnixFD", sig[1:]
+	case 's':
+		return "string", sig[1:]
+	case 'o':
+		return "dbus.ObjectPath", sig[1:]
+	case 'g':
+		return "dbus.Signature", sig[1:]
+	case 'v':
+		return "dbus.Variant", sig[1:]
+	case 'a':
+		if sig[1] == '{' {
+			key, rest := goTypeOf(sig[2:])
+			elem, rest := goTypeOf(rest)
+			return "map[" + key + "]" + elem, rest[1:]
+		}
+		elem, rest := goTypeOf(sig[1:])
+		return "[]" + elem, rest
+	case '(':
+		var fields []string
+		rest := sig[1:]
+		for rest[0] != ')' {
+			var field string
+			field, rest = goTypeOf(rest)
+			fields = append(fields, fmt.Sprintf("V%d %s", len(fields), field))
+		}
+		return "struct{ " + strings.Join(fields, "; ") + " }", rest[1:]
+	}
+	panic("codegen: invalid signature " + sig)
+}
+
+// exportedName returns name, which is the name of a D-Bus member or the last
+// element of an interface name, as an exported Go identifier.
+func exportedName(name string) string {
+	s := camelCase(name)
+	if s == "" {
+		return "X"
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// reservedNames are used by the generated code and can't be used for
+// arguments.
+var reservedNames = map[string]bool{
+	"c": true, "ctx": true, "err": true, "fn": true, "sig": true, "sub": true,
+	"conn": true, "path": true, "dbus": true, "prop": true, "context": true,
+}
+
+// argName returns the name of the Go parameter for an argument with the given
+// D-Bus name at position i. Names that can't be used are replaced.
+func argName(name string, i int) string {
+	s := camelCase(name)
+	if s == "" {
+		return fmt.Sprintf("arg%d", i)
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	s = string(r)
+	if token.Lookup(s).IsKeyword() || types.Universe.Lookup(s) != nil || reservedNames[s] {
+		s += "Arg"
+	}
+	return s
+}
+
+// camelCase removes the characters of name that can't be part of an
+// identifier and capitalizes the letters that follow them, so that
+// "invalidated_properties" becomes "invalidatedProperties".
+func camelCase(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = b.Len() > 0
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteRune('_')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -45,14 +45,24 @@ type Conn struct {
 	serialGen     SerialGenerator
 	inInt         Interceptor
 	outInt        Interceptor
+	rawHandler    func(msg *Message)
 	auth          []Auth
+	address       string
+	reconnect     *ReconnectPolicy
 
 	names      *nameTracker
 	calls      *callTracker
+	subs       *subscriptionTracker
 	outHandler *outputHandler
 
+	// only used by inWorker, which may be restarted after reconnecting
+	sequenceGen *sequenceGenerator
+
 	eavesdropped    chan<- *Message
 	eavesdroppedLck sync.Mutex
+
+	monitor    *monitor
+	monitorLck sync.Mutex
 }
 
 // SessionBus returns a shared connection to the session bus, connecting to it
@@ -171,7 +181,12 @@ func Dial(address string, opts ...ConnOption) (*Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	return newConn(tr, opts...)
+	conn, err := newConn(tr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	conn.address = address
+	return conn, nil
 }
 
 // DialHandler establishes a new private connection to the message bus specified by address, using the supplied handlers.
@@ -235,6 +250,19 @@ func WithOutgoingInterceptor(interceptor Interceptor) ConnOption {
 	}
 }
 
+// WithRawMessageHandler causes all incoming messages to be passed to handler
+// without further processing, as with Eavesdrop, except that no message is
+// ever discarded. handler is called from the goroutine reading from the
+// connection, in the order in which messages are received, so it should not
+// block for long. This is intended for implementing message routers such as
+// bus daemons.
+func WithRawMessageHandler(handler func(msg *Message)) ConnOption {
+	return func(conn *Conn) error {
+		conn.rawHandler = handler
+		return nil
+	}
+}
+
 // WithContext overrides  the default context for the connection.
 func WithContext(ctx context.Context) ConnOption {
 	return func(conn *Conn) error {
@@ -264,6 +292,9 @@ func newConn(tr transport, opts ...ConnOption) (*Conn, error) {
 			return nil, err
 		}
 	}
+	if conn.reconnect != nil {
+		conn.transport = &reconnectTransport{tr: tr, connected: true}
+	}
 	if conn.ctx == nil {
 		conn.ctx = context.Background()
 	}
@@ -274,6 +305,7 @@ func newConn(tr transport, opts ...ConnOption) (*Conn, error) {
 	}()
 
 	conn.calls = newCallTracker()
+	conn.sequenceGen = newSequenceGenerator()
 	if conn.handler == nil {
 		conn.handler = NewDefaultHandler()
 	}
@@ -285,6 +317,7 @@ func newConn(tr transport, opts ...ConnOption) (*Conn, error) {
 	}
 	conn.outHandler = &outputHandler{conn: conn}
 	conn.names = newNameTracker()
+	conn.subs = newSubscriptionTracker()
 	conn.busObj = conn.Object("org.freedesktop.DBus", "/org/freedesktop/DBus")
 	return conn, nil
 }
@@ -296,14 +329,16 @@ func (conn *Conn) BusObject() BusObject {
 }
 
 // Close closes the connection. Any blocked operations will return with errors
-// and the channels passed to Eavesdrop and Signal are closed. This method must
-// not be called on shared connections.
+// and the channels passed to Eavesdrop and Signal as well as those of
+// subscriptions are closed. This method must not be called on shared
+// connections.
 func (conn *Conn) Close() error {
 	conn.closeOnce.Do(func() {
 		conn.outHandler.close()
 		if term, ok := conn.signalHandler.(Terminator); ok {
 			term.Terminate()
 		}
+		conn.subs.terminate()
 
 		if term, ok := conn.handler.(Terminator); ok {
 			term.Terminate()
@@ -316,6 +351,7 @@ func (conn *Conn) Close() error {
 		conn.eavesdroppedLck.Unlock()
 
 		conn.cancelCtx()
+		conn.closeMonitor()
 
 		conn.closeErr = conn.transport.Close()
 	})
@@ -363,14 +399,18 @@ func (conn *Conn) Hello() error {
 // inWorker runs in an own goroutine, reading incoming messages from the
 // transport and dispatching them appropiately.
 func (conn *Conn) inWorker() {
-	sequenceGen := newSequenceGenerator()
+	sequenceGen := conn.sequenceGen
 	for {
 		msg, err := conn.ReadMessage()
 		if err != nil {
 			if _, ok := err.(InvalidMessageError); !ok {
-				// Some read error occurred (usually EOF); we can't really do
+				// Some read error occurred (usually EOF); unless the
+				// connection can be reestablished, we can't really do
 				// anything but to shut down all stuff and returns errors to all
 				// pending replies.
+				if conn.handleDisconnect(sequenceGen, err) {
+					return
+				}
 				conn.Close()
 				conn.calls.finalizeAllWithError(sequenceGen, err)
 				return
@@ -378,11 +418,22 @@ func (conn *Conn) inWorker() {
 			// invalid messages are ignored
 			continue
 		}
+		if conn.rawHandler != nil {
+			if conn.inInt != nil {
+				conn.inInt(msg)
+			}
+			conn.rawHandler(msg)
+			continue
+		}
+		if conn.monitorMessage(msg) {
+			continue
+		}
 		conn.eavesdroppedLck.Lock()
 		if conn.eavesdropped != nil {
 			select {
 			case conn.eavesdropped <- msg:
 			default:
+				msg.closeFDs()
 			}
 			conn.eavesdroppedLck.Unlock()
 			continue
@@ -395,6 +446,7 @@ func (conn *Conn) inWorker() {
 		if !found {
 			// Eavesdropped a message, but no channel for it is registered.
 			// Ignore it.
+			msg.closeFDs()
 			continue
 		}
 
@@ -422,6 +474,7 @@ func (conn *Conn) handleSignal(sequence Sequence, msg *Message) {
 	// as per http://dbus.freedesktop.org/doc/dbus-specification.html ,
 	// sender is optional for signals.
 	sender, _ := msg.Headers[FieldSender].value.(string)
+	var owner *NameOwner
 	if iface == "org.freedesktop.DBus" && sender == "org.freedesktop.DBus" {
 		if member == "NameLost" {
 			// If we lost the name on the bus, remove it from our
@@ -430,7 +483,7 @@ func (conn *Conn) handleSignal(sequence Sequence, msg *Message) {
 			if !ok {
 				panic("Unable to read the lost name")
 			}
-			conn.names.loseName(name)
+			owner = conn.names.loseName(name)
 		} else if member == "NameAcquired" {
 			// If we acquired the name on the bus, add it to our
 			// tracking list.
@@ -438,7 +491,7 @@ func (conn *Conn) handleSignal(sequence Sequence, msg *Message) {
 			if !ok {
 				panic("Unable to read the acquired name")
 			}
-			conn.names.acquireName(name)
+			owner = conn.names.acquireName(name)
 		}
 	}
 	signal := &Signal{
@@ -448,6 +501,10 @@ func (conn *Conn) handleSignal(sequence Sequence, msg *Message) {
 		Body:     msg.Body,
 		Sequence: sequence,
 	}
+	if owner != nil {
+		owner.queue.deliver(signal)
+	}
+	conn.subs.handleSignal(msg, signal)
 	conn.signalHandler.DeliverSignal(iface, member, signal)
 }
 
@@ -463,7 +520,7 @@ func (conn *Conn) Object(dest string, path ObjectPath) BusObject {
 	return &Object{conn, dest, path}
 }
 
-func (conn *Conn) sendMessageAndIfClosed(msg *Message, ifClosed func()) {
+func (conn *Conn) sendMessageAndIfClosed(msg *Message, ifClosed func()) error {
 	if conn.outInt != nil {
 		conn.outInt(msg)
 	}
@@ -474,6 +531,7 @@ func (conn *Conn) sendMessageAndIfClosed(msg *Message, ifClosed func()) {
 	} else if msg.Type != TypeMethodCall {
 		conn.serialGen.RetireSerial(msg.serial)
 	}
+	return err
 }
 
 // Send sends the given message to the message bus. You usually don't need to
@@ -492,13 +550,19 @@ func (conn *Conn) SendWithContext(ctx context.Context, msg *Message, ch chan *Ca
 }
 
 func (conn *Conn) send(ctx context.Context, msg *Message, ch chan *Call) *Call {
+	return conn.sendWithSerial(ctx, msg, ch, conn.getSerial())
+}
+
+// sendWithSerial acts like send, but sends msg with the given serial, which
+// must have been obtained from getSerial.
+func (conn *Conn) sendWithSerial(ctx context.Context, msg *Message, ch chan *Call, serial uint32) *Call {
 	if ctx == nil {
 		panic("nil context")
 	}
 
 	var call *Call
 	ctx, canceler := context.WithCancel(ctx)
-	msg.serial = conn.getSerial()
+	msg.serial = serial
 	if msg.Type == TypeMethodCall && msg.Flags&FlagNoReplyExpected == 0 {
 		if ch == nil {
 			ch = make(chan *Call, 5)
@@ -534,6 +598,24 @@ func (conn *Conn) send(ctx context.Context, msg *Message, ch chan *Call) *Call {
 	return call
 }
 
+// ForwardMessage sends msg as it is, keeping its serial and all of its
+// headers. Unlike Send, no serial is allocated and no reply is awaited. This
+// is intended for passing on messages that were received on another
+// connection, for example by a bus daemon.
+func (conn *Conn) ForwardMessage(msg *Message) error {
+	if conn.outInt != nil {
+		conn.outInt(msg)
+	}
+	var closed bool
+	err := conn.outHandler.sendAndIfClosed(msg, func() {
+		closed = true
+	})
+	if closed {
+		return ErrClosed
+	}
+	return err
+}
+
 // sendError creates an error message corresponding to the parameters and sends
 // it to conn.out.
 func (conn *Conn) sendError(err error, dest string, serial uint32) {
@@ -584,22 +666,34 @@ func (conn *Conn) sendReply(dest string, serial uint32, values ...interface{}) {
 }
 
 // AddMatchSignal registers the given match rule to receive broadcast
-// signals based on their contents.
+// signals based on their contents. An error is returned if an option is
+// invalid; options with keys that this package doesn't know are passed on to
+// the bus as they are.
 func (conn *Conn) AddMatchSignal(options ...MatchOption) error {
 	options = append([]MatchOption{withMatchType("signal")}, options...)
-	return conn.busObj.Call(
-		"org.freedesktop.DBus.AddMatch", 0,
-		formatMatchOptions(options),
-	).Store()
+	if _, err := newMatchRule(options, false); err != nil {
+		return err
+	}
+	rule := formatMatchOptions(options)
+	err := conn.busObj.Call("org.freedesktop.DBus.AddMatch", 0, rule).Store()
+	if err == nil {
+		conn.subs.recordSignalRule(rule, 1)
+	}
+	return err
 }
 
 // RemoveMatchSignal removes the first rule that matches previously registered with AddMatchSignal.
 func (conn *Conn) RemoveMatchSignal(options ...MatchOption) error {
 	options = append([]MatchOption{withMatchType("signal")}, options...)
-	return conn.busObj.Call(
-		"org.freedesktop.DBus.RemoveMatch", 0,
-		formatMatchOptions(options),
-	).Store()
+	if _, err := newMatchRule(options, false); err != nil {
+		return err
+	}
+	rule := formatMatchOptions(options)
+	err := conn.busObj.Call("org.freedesktop.DBus.RemoveMatch", 0, rule).Store()
+	if err == nil {
+		conn.subs.recordSignalRule(rule, -1)
+	}
+	return err
 }
 
 // Signal registers the given channel to be passed all received signal messages.
@@ -731,6 +825,7 @@ type outputHandler struct {
 	sendLck sync.Mutex
 	closed  struct {
 		isClosed bool
+		readOnly bool
 		lck      sync.RWMutex
 	}
 }
@@ -744,11 +839,21 @@ func (h *outputHandler) sendAndIfClosed(msg *Message, ifClosed func()) error {
 		}
 		return nil
 	}
+	if h.closed.readOnly {
+		return ErrMonitor
+	}
 	h.sendLck.Lock()
 	defer h.sendLck.Unlock()
 	return h.conn.SendMessage(msg)
 }
 
+// setReadOnly makes all further sends fail with ErrMonitor.
+func (h *outputHandler) setReadOnly() {
+	h.closed.lck.Lock()
+	defer h.closed.lck.Unlock()
+	h.closed.readOnly = true
+}
+
 func (h *outputHandler) close() {
 	h.closed.lck.Lock()
 	defer h.closed.lck.Unlock()
@@ -787,28 +892,116 @@ func (gen *serialGenerator) RetireSerial(serial uint32) {
 }
 
 type nameTracker struct {
-	lck    sync.RWMutex
-	unique string
-	names  map[string]struct{}
+	lck       sync.RWMutex
+	unique    string
+	names     map[string]struct{}
+	requested map[string]RequestNameFlags
+	owners    map[string]*NameOwner
+	watchers  map[*NameWatcher]struct{}
 }
 
 func newNameTracker() *nameTracker {
-	return &nameTracker{names: map[string]struct{}{}}
+	return &nameTracker{
+		names:     map[string]struct{}{},
+		requested: map[string]RequestNameFlags{},
+		owners:    map[string]*NameOwner{},
+		watchers:  map[*NameWatcher]struct{}{},
+	}
+}
+
+// reset forgets all names after the connection was reestablished with the
+// new unique name. Requested names are kept for requesting them again.
+func (tracker *nameTracker) reset(unique string) {
+	tracker.lck.Lock()
+	defer tracker.lck.Unlock()
+	tracker.unique = unique
+	tracker.names = map[string]struct{}{}
+}
+
+// loseAllNames forgets the well-known names after the connection was lost
+// and returns the NameOwners of those that were owned.
+func (tracker *nameTracker) loseAllNames() []*NameOwner {
+	tracker.lck.Lock()
+	defer tracker.lck.Unlock()
+	var owners []*NameOwner
+	for name := range tracker.names {
+		if o := tracker.owners[name]; o != nil {
+			owners = append(owners, o)
+		}
+	}
+	tracker.names = map[string]struct{}{}
+	return owners
+}
+func (tracker *nameTracker) requestName(name string, flags RequestNameFlags) {
+	tracker.lck.Lock()
+	defer tracker.lck.Unlock()
+	tracker.requested[name] = flags
+}
+func (tracker *nameTracker) releaseName(name string) {
+	tracker.lck.Lock()
+	defer tracker.lck.Unlock()
+	delete(tracker.requested, name)
+}
+func (tracker *nameTracker) listRequestedNames() map[string]RequestNameFlags {
+	tracker.lck.RLock()
+	defer tracker.lck.RUnlock()
+	out := make(map[string]RequestNameFlags, len(tracker.requested))
+	for k, v := range tracker.requested {
+		out[k] = v
+	}
+	return out
 }
 func (tracker *nameTracker) acquireUniqueConnectionName(name string) {
 	tracker.lck.Lock()
 	defer tracker.lck.Unlock()
 	tracker.unique = name
 }
-func (tracker *nameTracker) acquireName(name string) {
+func (tracker *nameTracker) acquireName(name string) *NameOwner {
 	tracker.lck.Lock()
 	defer tracker.lck.Unlock()
 	tracker.names[name] = struct{}{}
+	return tracker.owners[name]
 }
-func (tracker *nameTracker) loseName(name string) {
+func (tracker *nameTracker) loseName(name string) *NameOwner {
 	tracker.lck.Lock()
 	defer tracker.lck.Unlock()
 	delete(tracker.names, name)
+	return tracker.owners[name]
+}
+func (tracker *nameTracker) addOwner(owner *NameOwner) bool {
+	tracker.lck.Lock()
+	defer tracker.lck.Unlock()
+	if _, ok := tracker.owners[owner.name]; ok {
+		return false
+	}
+	tracker.owners[owner.name] = owner
+	return true
+}
+func (tracker *nameTracker) removeOwner(owner *NameOwner) {
+	tracker.lck.Lock()
+	defer tracker.lck.Unlock()
+	if tracker.owners[owner.name] == owner {
+		delete(tracker.owners, owner.name)
+	}
+}
+func (tracker *nameTracker) addWatcher(w *NameWatcher) {
+	tracker.lck.Lock()
+	defer tracker.lck.Unlock()
+	tracker.watchers[w] = struct{}{}
+}
+func (tracker *nameTracker) removeWatcher(w *NameWatcher) {
+	tracker.lck.Lock()
+	defer tracker.lck.Unlock()
+	delete(tracker.watchers, w)
+}
+func (tracker *nameTracker) listWatchers() []*NameWatcher {
+	tracker.lck.RLock()
+	defer tracker.lck.RUnlock()
+	out := make([]*NameWatcher, 0, len(tracker.watchers))
+	for w := range tracker.watchers {
+		out = append(out, w)
+	}
+	return out
 }
 
 func (tracker *nameTracker) uniqueNameIsKnown() bool {
@@ -854,7 +1047,10 @@ func (tracker *callTracker) handleReply(sequence Sequence, msg *Message) uint32
 	_, ok := tracker.calls[serial]
 	tracker.lck.RUnlock()
 	if ok {
-		tracker.finalizeWithBody(serial, sequence, msg.Body)
+		tracker.finalizeWithBody(serial, sequence, msg)
+	} else {
+		// The call was canceled or timed out, so nobody receives the fds.
+		msg.closeFDs()
 	}
 	return serial
 }
@@ -868,6 +1064,7 @@ func (tracker *callTracker) handleDBusError(sequence Sequence, msg *Message) uin
 		name, _ := msg.Headers[FieldErrorName].value.(string)
 		tracker.finalizeWithError(serial, sequence, Error{name, msg.Body})
 	}
+	msg.closeFDs()
 	return serial
 }
 
@@ -894,15 +1091,20 @@ func (tracker *callTracker) finalize(sn uint32) {
 	}
 }
 
-func (tracker *callTracker) finalizeWithBody(sn uint32, sequence Sequence, body []interface{}) {
+func (tracker *callTracker) finalizeWithBody(sn uint32, sequence Sequence, msg *Message) {
 	tracker.lck.Lock()
 	c, ok := tracker.calls[sn]
 	if ok {
 		delete(tracker.calls, sn)
 	}
 	tracker.lck.Unlock()
+	if !ok {
+		msg.closeFDs()
+	}
 	if ok {
-		c.Body = body
+		c.Body = msg.Body
+		c.fds = msg.fds
+		msg.fds = nil
 		c.ResponseSequence = sequence
 		c.done()
 	}
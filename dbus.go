@@ -28,6 +28,7 @@ var (
 	interfaceType   = reflect.TypeOf((*interface{})(nil)).Elem()
 	unixFDType      = reflect.TypeOf(UnixFD(0))
 	unixFDIndexType = reflect.TypeOf(UnixFDIndex(0))
+	fdType          = reflect.TypeOf((*FD)(nil)).Elem()
 	errType         = reflect.TypeOf((*error)(nil)).Elem()
 )
 
@@ -63,12 +64,18 @@ func storeInterfaces(src, dest interface{}) error {
 }
 
 func store(dest, src reflect.Value) error {
+	if u, ok := asUnmarshaler(dest); ok {
+		return u.UnmarshalDBus(getVariantValue(src).Interface())
+	}
 	if dest.Kind() == reflect.Ptr {
 		if dest.IsNil() {
 			dest.Set(reflect.New(dest.Type().Elem()))
 		}
 		return store(dest.Elem(), src)
 	}
+	if src.Kind() == reflect.Map && isDictStruct(dest.Type()) {
+		return storeDictStruct(dest, src)
+	}
 	switch src.Kind() {
 	case reflect.Slice:
 		return storeSlice(dest, src)
@@ -93,6 +100,19 @@ func setDest(dest, src reflect.Value) error {
 		src = getVariantValue(src)
 		return store(dest, src)
 	}
+	if src.Type() == signatureType && dest.Kind() == reflect.String {
+		dest.SetString(src.Interface().(Signature).str)
+		return nil
+	}
+	if dest.Type() == fdType && src.Type() == unixFDType && dest.CanAddr() {
+		// The descriptor that the FD owned so far is replaced.
+		fd := dest.Addr().Interface().(*FD)
+		if n := fd.Fd(); n >= 0 && n != int(src.Int()) {
+			closeFD(n)
+		}
+		fd.fd = int(src.Int()) + 1
+		return nil
+	}
 	if !src.Type().ConvertibleTo(dest.Type()) {
 		return fmt.Errorf(
 			"dbus.Store: type mismatch: cannot convert %s to %s",
@@ -115,13 +135,19 @@ func kindsAreCompatible(dest, src reflect.Type) bool {
 
 func isConvertibleTo(dest, src reflect.Type) bool {
 	switch {
+	case isUnmarshalerType(dest):
+		return true
 	case isVariant(dest):
 		return true
 	case dest.Kind() == reflect.Interface:
 		return true
+	case dest == fdType:
+		return src == unixFDType
 	case dest.Kind() == reflect.Slice:
 		return src.Kind() == reflect.Slice &&
 			isConvertibleTo(dest.Elem(), src.Elem())
+	case isDictStruct(dest):
+		return src.Kind() == reflect.Map || src == variantType
 	case dest.Kind() == reflect.Struct:
 		return src == interfacesType
 	default:
@@ -183,7 +209,10 @@ func storeMapIntoMap(dest, src reflect.Value) error {
 	}
 	keys := src.MapKeys()
 	for _, key := range keys {
-		dkey := key.Convert(dest.Type().Key())
+		dkey := reflect.New(dest.Type().Key()).Elem()
+		if err := store(dkey, key); err != nil {
+			return err
+		}
 		dval := reflect.New(dest.Type().Elem()).Elem()
 		err := store(dval, getVariantValue(src.MapIndex(key)))
 		if err != nil {
@@ -222,18 +251,10 @@ func storeStruct(dest, src reflect.Value) error {
 	if isVariant(dest.Type()) {
 		return storeBase(dest, src)
 	}
-	dval := make([]interface{}, 0, dest.NumField())
-	dtype := dest.Type()
-	for i := 0; i < dest.NumField(); i++ {
-		field := dest.Field(i)
-		ftype := dtype.Field(i)
-		if ftype.PkgPath != "" {
-			continue
-		}
-		if ftype.Tag.Get("dbus") == "-" {
-			continue
-		}
-		dval = append(dval, field.Addr().Interface())
+	fields := getStructInfo(dest.Type()).fields
+	dval := make([]interface{}, 0, len(fields))
+	for _, f := range fields {
+		dval = append(dval, dest.FieldByIndex(f.index).Addr().Interface())
 	}
 	if src.Len() != len(dval) {
 		return fmt.Errorf(
@@ -344,6 +365,12 @@ type UnixFDIndex uint32
 
 // alignment returns the alignment of values of type t.
 func alignment(t reflect.Type) int {
+	if s, ok, err := marshalerSignature(t); ok {
+		if err != nil {
+			panic(err)
+		}
+		return sigAlignment(s)
+	}
 	switch t {
 	case variantType:
 		return 1
@@ -353,6 +380,11 @@ func alignment(t reflect.Type) int {
 		return 1
 	case interfacesType:
 		return 4
+	case fdType:
+		return 4
+	}
+	if isDictStruct(t) {
+		return 4
 	}
 	switch t.Kind() {
 	case reflect.Uint8:
@@ -371,6 +403,9 @@ func alignment(t reflect.Type) int {
 
 // isKeyType returns whether t is a valid type for a D-Bus dict.
 func isKeyType(t reflect.Type) bool {
+	if s, ok, err := marshalerSignature(t); ok {
+		return err == nil && isBasicSignature(s)
+	}
 	switch t.Kind() {
 	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
 		reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float64,
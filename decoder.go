@@ -4,12 +4,17 @@ import (
 	"encoding/binary"
 	"io"
 	"reflect"
+	"strings"
 )
 
 type decoder struct {
 	in    io.Reader
 	order binary.ByteOrder
 	pos   int
+
+	// fds, if not nil, are the unix fds received with the message, which
+	// UNIX_FD values are resolved to.
+	fds []int
 }
 
 // newDecoder returns a new decoder that reads values from in. The input is
@@ -161,12 +166,19 @@ func (dec *decoder) decode(s string, depth int) interface{} {
 		variant.value = dec.decode(sig.str, depth+1)
 		return variant
 	case 'h':
-		return UnixFDIndex(dec.decode("u", depth).(uint32))
+		i := dec.decode("u", depth).(uint32)
+		if dec.fds == nil {
+			return UnixFDIndex(i)
+		}
+		if int(i) >= len(dec.fds) {
+			panic(InvalidMessageError("invalid index for unix fd"))
+		}
+		return UnixFD(dec.fds[i])
 	case 'a':
 		if len(s) > 1 && s[1] == '{' {
 			ksig := s[2:3]
 			vsig := s[3 : len(s)-1]
-			v := reflect.MakeMap(reflect.MapOf(typeFor(ksig), typeFor(vsig)))
+			v := reflect.MakeMap(reflect.MapOf(dec.typeFor(ksig), dec.typeFor(vsig)))
 			if depth >= 63 {
 				panic(FormatError("input exceeds container depth limit"))
 			}
@@ -195,7 +207,7 @@ func (dec *decoder) decode(s string, depth int) interface{} {
 		if s := sigByteSize(sig); s != 0 {
 			capacity = int(length) / s
 		}
-		v := reflect.MakeSlice(reflect.SliceOf(typeFor(sig)), 0, capacity)
+		v := reflect.MakeSlice(reflect.SliceOf(dec.typeFor(sig)), 0, capacity)
 		// Even for empty arrays, the correct padding must be included
 		align := alignment(typeFor(s[1:]))
 		if len(s) > 1 && s[1] == '(' {
@@ -233,6 +245,29 @@ func (dec *decoder) decode(s string, depth int) interface{} {
 	}
 }
 
+// typeFor returns the type of the values decoded for the signature s, in
+// which UNIX_FD values are UnixFD if dec resolves them.
+func (dec *decoder) typeFor(s string) reflect.Type {
+	t := typeFor(s)
+	if dec.fds == nil || !strings.Contains(s, "h") {
+		return t
+	}
+	return resolvedFDType(t)
+}
+
+// resolvedFDType returns t with UnixFDIndex replaced by UnixFD.
+func resolvedFDType(t reflect.Type) reflect.Type {
+	switch {
+	case t == unixFDIndexType:
+		return unixFDType
+	case t.Kind() == reflect.Slice:
+		return reflect.SliceOf(resolvedFDType(t.Elem()))
+	case t.Kind() == reflect.Map:
+		return reflect.MapOf(resolvedFDType(t.Key()), resolvedFDType(t.Elem()))
+	}
+	return t
+}
+
 // sigByteSize tries to calculates size of the given signature in bytes.
 //
 // It returns zero when it can't, for example when it contains non-fixed size
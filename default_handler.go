@@ -1,7 +1,6 @@
 package dbus
 
 import (
-	"bytes"
 	"reflect"
 	"strings"
 	"sync"
@@ -36,6 +35,10 @@ type defaultHandler struct {
 	sync.RWMutex
 	objects     map[ObjectPath]*exportedObj
 	defaultIntf map[string]*exportedIntf
+
+	// exportMu serializes exports and their notification to observers.
+	exportMu  sync.Mutex
+	observers []ExportObserver
 }
 
 func (h *defaultHandler) PathExists(path ObjectPath) bool {
@@ -43,27 +46,6 @@ func (h *defaultHandler) PathExists(path ObjectPath) bool {
 	return ok
 }
 
-func (h *defaultHandler) introspectPath(path ObjectPath) string {
-	subpath := make(map[string]struct{})
-	var xml bytes.Buffer
-	xml.WriteString("<node>")
-	for obj := range h.objects {
-		p := string(path)
-		if p != "/" {
-			p += "/"
-		}
-		if strings.HasPrefix(string(obj), p) {
-			node_name := strings.Split(string(obj[len(p):]), "/")[0]
-			subpath[node_name] = struct{}{}
-		}
-	}
-	for s := range subpath {
-		xml.WriteString("\n\t<node name=\"" + s + "\"/>")
-	}
-	xml.WriteString("\n</node>")
-	return xml.String()
-}
-
 func (h *defaultHandler) LookupObject(path ObjectPath) (ServerObject, bool) {
 	h.RLock()
 	defer h.RUnlock()
@@ -103,6 +85,7 @@ func (h *defaultHandler) LookupObject(path ObjectPath) (ServerObject, bool) {
 
 func (h *defaultHandler) AddObject(path ObjectPath, object *exportedObj) {
 	h.Lock()
+	object.defaultIntf = h.defaultIntf
 	h.objects[path] = object
 	h.Unlock()
 }
@@ -179,6 +162,10 @@ func newExportedObject() *exportedObj {
 type exportedObj struct {
 	mu         sync.RWMutex
 	interfaces map[string]*exportedIntf
+
+	// The interfaces that are implemented by every object, unless they are
+	// exported explicitly
+	defaultIntf map[string]*exportedIntf
 }
 
 func (obj *exportedObj) LookupInterface(name string) (Interface, bool) {
@@ -188,6 +175,9 @@ func (obj *exportedObj) LookupInterface(name string) (Interface, bool) {
 	obj.mu.RLock()
 	defer obj.mu.RUnlock()
 	intf, exists := obj.interfaces[name]
+	if !exists {
+		intf, exists = obj.defaultIntf[name]
+	}
 	return intf, exists
 }
 
@@ -197,6 +187,13 @@ func (obj *exportedObj) AddInterface(name string, iface *exportedIntf) {
 	obj.interfaces[name] = iface
 }
 
+func (obj *exportedObj) lookupExportedInterface(name string) (*exportedIntf, bool) {
+	obj.mu.RLock()
+	defer obj.mu.RUnlock()
+	intf, exists := obj.interfaces[name]
+	return intf, exists
+}
+
 func (obj *exportedObj) DeleteInterface(name string) {
 	obj.mu.Lock()
 	defer obj.mu.Unlock()
@@ -229,6 +226,12 @@ func newExportedIntf(methods map[string]Method, includeSubtree bool) *exportedIn
 type exportedIntf struct {
 	methods map[string]Method
 
+	// The value that was exported, if any
+	value interface{}
+
+	// The description of the interface given on export
+	spec InterfaceSpec
+
 	// Whether or not this export is for the entire subtree
 	includeSubtree bool
 }
@@ -42,8 +42,30 @@ Structs other than Variant and Signature encode as a STRUCT containing their
 exported fields. Fields whose tags contain `dbus:"-"` and unexported fields will
 be skipped.
 
+The tag of a field has the form `dbus:"name,option,..."` and supports these
+options:
+
+	dict           encode the struct as a DICT of the type a{sv} instead, which
+	               maps the names of its fields to their values; the name
+	               defaults to the field name
+	omitempty      leave the field out of such a DICT if it has its zero value
+	signature=sig  encode the field with the signature sig, e.g. a string as an
+	               OBJECT_PATH with signature=o
+	inline         encode the fields of an embedded struct as if they were
+	               fields of the outer struct
+
+Other options are ignored. Embedded structs without the inline option are
+encoded like any other field. When storing a DICT into a struct with
+the dict option, entries without a field are ignored and fields without an
+entry are left unchanged.
+
 Pointers encode as the value they're pointed to.
 
+Types that implement DBusMarshaler encode as the value returned by their
+MarshalDBus method, which takes precedence over the other rules. Likewise,
+values are stored into types that implement DBusUnmarshaler by calling their
+UnmarshalDBus method.
+
 Types convertible to one of the base types above will be mapped as the
 base type.
 
@@ -61,9 +83,33 @@ Handling Unix file descriptors deserves special mention. To use them, you should
 first check that they are supported on a connection by calling SupportsUnixFDs.
 If it returns true, all method of Connection will translate messages containing
 UnixFD's to messages that are accompanied by the given file descriptors with the
-UnixFD values being substituted by the correct indices. Similarly, the indices
-of incoming messages are automatically resolved. It shouldn't be necessary to use
+UnixFD values being substituted by the correct indices. This applies to UnixFD
+values anywhere in a message, including inside structs, arrays, maps and
+variants. Similarly, the indices of incoming messages are automatically
+resolved, wherever they are nested. It shouldn't be necessary to use
 UnixFDIndex.
 
+The file descriptors received with a message are owned by its receiver. Use
+the FD type to take them over when storing a reply or the arguments of an
+exported method; FD has methods to close, duplicate or convert the descriptor
+to an *os.File; pass it as *FD, as copies would own the same descriptor. File
+descriptors that nobody receives are closed: those of messages that are
+dropped, of replies that arrive after their call was canceled or timed out, of
+error replies, of method calls that can't be dispatched, and those that
+Call.Store doesn't store into an FD when it fails. Storing into an FD that
+still owns a descriptor closes that descriptor first. The UnixFD values in
+Call.Body of a reply that is never stored, of signals and of eavesdropped
+messages are owned by the receiver of the call or channel.
+
+GVariant serialization
+
+Besides the classic D-Bus marshalling, values can be serialized in the GVariant
+format that GLib uses for binary data like dconf databases and GSettings
+schemas. MarshalGVariant and UnmarshalGVariant convert between Go values and
+GVariant data following the conversion rules above. Messages are always
+encoded with the classic marshalling: the GVariant message format of D-Bus
+protocol version 2 was only specified for the kdbus transport, which no bus
+implements, so it isn't offered per message.
+
 */
 package dbus
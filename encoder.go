@@ -12,6 +12,12 @@ type encoder struct {
 	out   io.Writer
 	order binary.ByteOrder
 	pos   int
+
+	// passFDs is set if UnixFD values are passed with the message, in which
+	// case fds collects them and they are replaced by their indices.
+	// Otherwise, they are encoded as their plain value.
+	passFDs bool
+	fds     []int
 }
 
 // NewEncoder returns a new encoder that writes to out in the given byte order.
@@ -75,6 +81,18 @@ func (enc *encoder) Encode(vs ...interface{}) (err error) {
 // encode encodes the given value to the writer and panics on error. depth holds
 // the depth of the container nesting.
 func (enc *encoder) encode(v reflect.Value, depth int) {
+	if m, ok := asMarshaler(v); ok {
+		enc.encode(marshalValue(v.Type(), m), depth)
+		return
+	}
+	if v.Type() == fdType {
+		v = reflect.ValueOf(UnixFD(fdValue(v)))
+	}
+	if v.Type() == unixFDType && enc.passFDs {
+		enc.fds = append(enc.fds, int(v.Int()))
+		enc.encode(reflect.ValueOf(UnixFDIndex(len(enc.fds)-1)), depth)
+		return
+	}
 	enc.align(alignment(v.Type()))
 	switch v.Kind() {
 	case reflect.Uint8:
@@ -134,10 +152,12 @@ func (enc *encoder) encode(v reflect.Value, depth int) {
 
 		var buf bytes.Buffer
 		bufenc := newEncoderAtOffset(&buf, offset, enc.order)
+		bufenc.passFDs, bufenc.fds = enc.passFDs, enc.fds
 
 		for i := 0; i < v.Len(); i++ {
 			bufenc.encode(v.Index(i), depth+1)
 		}
+		enc.fds = bufenc.fds
 		enc.encode(reflect.ValueOf(uint32(buf.Len())), depth)
 		length := buf.Len()
 		enc.align(alignment(v.Type().Elem()))
@@ -166,11 +186,12 @@ func (enc *encoder) encode(v reflect.Value, depth int) {
 			enc.encode(reflect.ValueOf(variant.sig), depth+1)
 			enc.encode(reflect.ValueOf(variant.value), depth+1)
 		default:
-			for i := 0; i < v.Type().NumField(); i++ {
-				field := t.Field(i)
-				if field.PkgPath == "" && field.Tag.Get("dbus") != "-" {
-					enc.encode(v.Field(i), depth+1)
-				}
+			if isDictStruct(t) {
+				enc.encode(reflect.ValueOf(structDict(v)), depth)
+				break
+			}
+			for _, fv := range structValues(v) {
+				enc.encode(fv, depth+1)
 			}
 		}
 	case reflect.Map:
@@ -190,11 +211,13 @@ func (enc *encoder) encode(v reflect.Value, depth int) {
 
 		var buf bytes.Buffer
 		bufenc := newEncoderAtOffset(&buf, offset, enc.order)
+		bufenc.passFDs, bufenc.fds = enc.passFDs, enc.fds
 		for _, k := range keys {
 			bufenc.align(8)
 			bufenc.encode(k, depth+2)
 			bufenc.encode(v.MapIndex(k), depth+2)
 		}
+		enc.fds = bufenc.fds
 		enc.encode(reflect.ValueOf(uint32(buf.Len())), depth)
 		length := buf.Len()
 		enc.align(8)
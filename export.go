@@ -128,6 +128,9 @@ func (conn *Conn) handleCall(msg *Message) {
 	ifaceName, _ := msg.Headers[FieldInterface].value.(string)
 	sender, hasSender := msg.Headers[FieldSender].value.(string)
 	serial := msg.serial
+	// Unless the arguments are passed to a method, which then owns the fds
+	// received with them, the fds are closed.
+	defer msg.closeFDs()
 	if ifaceName == "org.freedesktop.DBus.Peer" {
 		switch name {
 		case "Ping":
@@ -160,19 +163,26 @@ func (conn *Conn) handleCall(msg *Message) {
 		conn.sendError(ErrMsgUnknownMethod, sender, serial)
 		return
 	}
+	// Callers that expect no reply get neither a reply nor an error.
+	noReply := msg.Flags&FlagNoReplyExpected != 0
 	args, err := conn.decodeArguments(m, sender, msg)
 	if err != nil {
-		conn.sendError(err, sender, serial)
+		if !noReply {
+			conn.sendError(err, sender, serial)
+		}
 		return
 	}
 
+	msg.fds = nil
 	ret, err := m.Call(args...)
 	if err != nil {
-		conn.sendError(err, sender, serial)
+		if !noReply {
+			conn.sendError(err, sender, serial)
+		}
 		return
 	}
 
-	if msg.Flags&FlagNoReplyExpected == 0 {
+	if !noReply {
 		reply := new(Message)
 		reply.Type = TypeMethodReply
 		reply.serial = conn.getSerial()
@@ -222,13 +232,13 @@ func (conn *Conn) Emit(path ObjectPath, name string, values ...interface{}) erro
 	}
 
 	var closed bool
-	conn.sendMessageAndIfClosed(msg, func() {
+	err := conn.sendMessageAndIfClosed(msg, func() {
 		closed = true
 	})
 	if closed {
 		return ErrClosed
 	}
-	return nil
+	return err
 }
 
 // Export registers the given value to be exported as an object on the
@@ -253,7 +263,10 @@ func (conn *Conn) Emit(path ObjectPath, name string, values ...interface{}) erro
 // in multiple goroutines at once.
 //
 // Method calls on the interface org.freedesktop.DBus.Peer will be automatically
-// handled for every object.
+// handled for every object. Unless it is exported explicitly,
+// org.freedesktop.DBus.Introspectable is implemented as well, describing the
+// exported interfaces and the properties of a PropertiesIntrospector exported
+// as org.freedesktop.DBus.Properties.
 //
 // Passing nil as the first parameter will cause conn to cease handling calls on
 // the given combination of path and interface.
@@ -272,7 +285,7 @@ func (conn *Conn) Export(v interface{}, path ObjectPath, iface string) error {
 // it is sent back to the caller as an error. Otherwise, a method reply is
 // sent with the other return values as its body.
 func (conn *Conn) ExportAll(v interface{}, path ObjectPath, iface string) error {
-	return conn.export(getAllMethods(v, nil), path, iface, false)
+	return conn.export(v, getAllMethods(v, nil), path, iface, false, nil)
 }
 
 // ExportWithMap works exactly like Export but provides the ability to remap
@@ -281,7 +294,18 @@ func (conn *Conn) ExportAll(v interface{}, path ObjectPath, iface string) error
 // The keys in the map are the real method names (exported on the struct), and
 // the values are the method names to be exported on DBus.
 func (conn *Conn) ExportWithMap(v interface{}, mapping map[string]string, path ObjectPath, iface string) error {
-	return conn.export(getMethods(v, mapping), path, iface, false)
+	return conn.export(v, getMethods(v, mapping), path, iface, false, nil)
+}
+
+// ExportWithSpec works like Export, but describes the interface with spec,
+// which can name the arguments of its methods, declare the signals it emits
+// and attach annotations. The description is used for the introspection data
+// of the object.
+//
+// ExportWithSpec returns an error if spec describes methods that v doesn't
+// have or arguments that don't match them.
+func (conn *Conn) ExportWithSpec(v interface{}, spec InterfaceSpec, path ObjectPath, iface string) error {
+	return conn.export(v, getMethods(v, nil), path, iface, false, &spec)
 }
 
 // ExportSubtree works exactly like Export but registers the given value for
@@ -304,7 +328,7 @@ func (conn *Conn) ExportSubtree(v interface{}, path ObjectPath, iface string) er
 // The keys in the map are the real method names (exported on the struct), and
 // the values are the method names to be exported on DBus.
 func (conn *Conn) ExportSubtreeWithMap(v interface{}, mapping map[string]string, path ObjectPath, iface string) error {
-	return conn.export(getMethods(v, mapping), path, iface, true)
+	return conn.export(v, getMethods(v, mapping), path, iface, true, nil)
 }
 
 // ExportMethodTable like Export registers the given methods as an object
@@ -318,15 +342,21 @@ func (conn *Conn) ExportSubtreeWithMap(v interface{}, mapping map[string]string,
 //
 // Any non-function objects in the method table are ignored.
 func (conn *Conn) ExportMethodTable(methods map[string]interface{}, path ObjectPath, iface string) error {
-	return conn.exportMethodTable(methods, path, iface, false)
+	return conn.exportMethodTable(methods, path, iface, false, nil)
+}
+
+// ExportMethodTableWithSpec works like ExportMethodTable, but describes the
+// interface with spec, like ExportWithSpec does.
+func (conn *Conn) ExportMethodTableWithSpec(methods map[string]interface{}, spec InterfaceSpec, path ObjectPath, iface string) error {
+	return conn.exportMethodTable(methods, path, iface, false, &spec)
 }
 
 // Like ExportSubtree, but with the same caveats as ExportMethodTable.
 func (conn *Conn) ExportSubtreeMethodTable(methods map[string]interface{}, path ObjectPath, iface string) error {
-	return conn.exportMethodTable(methods, path, iface, true)
+	return conn.exportMethodTable(methods, path, iface, true, nil)
 }
 
-func (conn *Conn) exportMethodTable(methods map[string]interface{}, path ObjectPath, iface string, includeSubtree bool) error {
+func (conn *Conn) exportMethodTable(methods map[string]interface{}, path ObjectPath, iface string, includeSubtree bool, spec *InterfaceSpec) error {
 	out := make(map[string]reflect.Value)
 	for name, method := range methods {
 		rval := reflect.ValueOf(method)
@@ -341,22 +371,28 @@ func (conn *Conn) exportMethodTable(methods map[string]interface{}, path ObjectP
 		}
 		out[name] = rval
 	}
-	return conn.export(out, path, iface, includeSubtree)
+	return conn.export(methods, out, path, iface, includeSubtree, spec)
 }
 
 func (conn *Conn) unexport(h *defaultHandler, path ObjectPath, iface string) error {
 	if h.PathExists(path) {
 		obj := h.objects[path]
+		intf, ok := obj.lookupExportedInterface(iface)
 		obj.DeleteInterface(iface)
 		if len(obj.interfaces) == 0 {
 			h.DeleteObject(path)
 		}
+		if ok && !intf.includeSubtree {
+			for _, o := range h.observers {
+				o.InterfaceUnexported(path, iface)
+			}
+		}
 	}
 	return nil
 }
 
 // exportWithMap is the worker function for all exports/registrations.
-func (conn *Conn) export(methods map[string]reflect.Value, path ObjectPath, iface string, includeSubtree bool) error {
+func (conn *Conn) export(v interface{}, methods map[string]reflect.Value, path ObjectPath, iface string, includeSubtree bool, spec *InterfaceSpec) error {
 	h, ok := conn.handler.(*defaultHandler)
 	if !ok {
 		return fmt.Errorf(
@@ -368,29 +404,116 @@ func (conn *Conn) export(methods map[string]reflect.Value, path ObjectPath, ifac
 		return fmt.Errorf(`dbus: Invalid path name: "%s"`, path)
 	}
 
+	h.exportMu.Lock()
+	defer h.exportMu.Unlock()
+
 	// Remove a previous export if the interface is nil
 	if methods == nil {
 		return conn.unexport(h, path, iface)
 	}
 
+	exportedMethods := make(map[string]Method)
+	for name, method := range methods {
+		exportedMethods[name] = exportedMethod{method}
+	}
+	if spec != nil {
+		if err := checkInterfaceSpec(spec, exportedMethods); err != nil {
+			return err
+		}
+	}
+
 	// If this is the first handler for this path, make a new map to hold all
 	// handlers for this path.
 	if !h.PathExists(path) {
 		h.AddObject(path, newExportedObject())
 	}
 
-	exportedMethods := make(map[string]Method)
-	for name, method := range methods {
-		exportedMethods[name] = exportedMethod{method}
-	}
-
 	// Finally, save this handler
 	obj := h.objects[path]
-	obj.AddInterface(iface, newExportedIntf(exportedMethods, includeSubtree))
+	intf := newExportedIntf(exportedMethods, includeSubtree)
+	intf.value = v
+	if spec != nil {
+		intf.spec = *spec
+	}
+	obj.AddInterface(iface, intf)
 
+	if !includeSubtree {
+		for _, o := range h.observers {
+			o.InterfaceExported(path, iface, v)
+		}
+	}
 	return nil
 }
 
+// ExportObserver is notified whenever an interface is exported or unexported
+// on a connection with Export or one of its variants. Subtree exports are not
+// reported, as they don't create objects of their own.
+//
+// The methods of an ExportObserver are called synchronously from the
+// goroutine that exports or unexports the interface, and must not export or
+// unexport objects themselves.
+type ExportObserver interface {
+	// InterfaceExported is called when iface is exported on path with v,
+	// which is the value passed to Export or the method table passed to
+	// ExportMethodTable. It is also called again if an exported interface
+	// is replaced.
+	InterfaceExported(path ObjectPath, iface string, v interface{})
+	// InterfaceUnexported is called when iface is no longer exported on
+	// path.
+	InterfaceUnexported(path ObjectPath, iface string)
+}
+
+// AddExportObserver registers o to be notified of exports and unexports on
+// conn. Before AddExportObserver returns, InterfaceExported is called for
+// every interface that is already exported. It does nothing if conn doesn't
+// use the default handler.
+func (conn *Conn) AddExportObserver(o ExportObserver) {
+	h, ok := conn.handler.(*defaultHandler)
+	if !ok {
+		return
+	}
+	h.exportMu.Lock()
+	defer h.exportMu.Unlock()
+	h.RLock()
+	var exported []exportedInterface
+	for path, obj := range h.objects {
+		obj.mu.RLock()
+		for name, intf := range obj.interfaces {
+			if !intf.includeSubtree {
+				exported = append(exported, exportedInterface{path, name, intf.value})
+			}
+		}
+		obj.mu.RUnlock()
+	}
+	h.RUnlock()
+	for _, e := range exported {
+		o.InterfaceExported(e.path, e.iface, e.value)
+	}
+	h.observers = append(h.observers, o)
+}
+
+// RemoveExportObserver stops notifying o of exports and unexports on conn.
+func (conn *Conn) RemoveExportObserver(o ExportObserver) {
+	h, ok := conn.handler.(*defaultHandler)
+	if !ok {
+		return
+	}
+	h.exportMu.Lock()
+	defer h.exportMu.Unlock()
+	for i, other := range h.observers {
+		if other == o {
+			h.observers = append(h.observers[:i], h.observers[i+1:]...)
+			return
+		}
+	}
+}
+
+type exportedInterface struct {
+	path  ObjectPath
+	iface string
+	value interface{}
+}
+
 // ReleaseName calls org.freedesktop.DBus.ReleaseName and awaits a response.
 func (conn *Conn) ReleaseName(name string) (ReleaseNameReply, error) {
 	var r uint32
@@ -398,6 +521,7 @@ func (conn *Conn) ReleaseName(name string) (ReleaseNameReply, error) {
 	if err != nil {
 		return 0, err
 	}
+	conn.names.releaseName(name)
 	return ReleaseNameReply(r), nil
 }
 
@@ -408,6 +532,9 @@ func (conn *Conn) RequestName(name string, flags RequestNameFlags) (RequestNameR
 	if err != nil {
 		return 0, err
 	}
+	if RequestNameReply(r) != RequestNameReplyExists {
+		conn.names.requestName(name, flags)
+	}
 	return RequestNameReply(r), nil
 }
 
@@ -1,6 +1,7 @@
 package dbus
 
 import (
+	"encoding/xml"
 	"fmt"
 	"regexp"
 	"strings"
@@ -726,3 +727,180 @@ func TestExportSubPathIntrospection(t *testing.T) {
 		t.Errorf("Unexpected introspection response for %s: %s", invalSubpath, response)
 	}
 }
+
+type introspectedProps struct{}
+
+func (introspectedProps) Get(iface, property string) (Variant, *Error) {
+	return MakeVariant(""), nil
+}
+
+func (introspectedProps) PropertySpecs(iface string) []PropertySpec {
+	if iface != "org.guelfey.DBus.Test" {
+		return nil
+	}
+	return []PropertySpec{{Name: "Name", Type: Signature{"s"}, Access: "read"}}
+}
+
+// Test that the introspection data of exported objects is generated
+func TestExportIntrospection(t *testing.T) {
+	connection, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatalf("Unexpected error connecting to session bus: %s", err)
+	}
+	defer connection.Close()
+
+	const path = "/org/guelfey/DBus/Test"
+	connection.Export(&fooExport{}, path, "org.guelfey.DBus.Test")
+	connection.Export(introspectedProps{}, path, "org.freedesktop.DBus.Properties")
+	connection.Export(barExport{}, path+"/Child", "org.guelfey.DBus.Test")
+
+	var data string
+	err = connection.Object(connection.Names()[0], path).
+		Call("org.freedesktop.DBus.Introspectable.Introspect", 0).Store(&data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var node introspectionNode
+	if err := xml.Unmarshal([]byte(data), &node); err != nil {
+		t.Fatalf("Invalid introspection data %s: %s", data, err)
+	}
+
+	var names []string
+	for _, intf := range node.Interfaces {
+		names = append(names, intf.Name)
+	}
+	want := []string{
+		"org.guelfey.DBus.Test",
+		"org.freedesktop.DBus.Properties",
+		"org.freedesktop.DBus.Introspectable",
+		"org.freedesktop.DBus.Peer",
+	}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Fatalf("Introspected interfaces %v, want %v", names, want)
+	}
+	test := node.Interfaces[0]
+	if len(test.Methods) != 1 || test.Methods[0].Name != "Foo" {
+		t.Fatalf("Unexpected methods %v", test.Methods)
+	}
+	args := test.Methods[0].Args
+	if len(args) != 2 || args[0] != (introspectionArg{Type: "s", Direction: "in"}) ||
+		args[1] != (introspectionArg{Type: "s", Direction: "out"}) {
+		t.Errorf("Unexpected arguments of Foo %v", args)
+	}
+	if len(test.Properties) != 1 || test.Properties[0].Name != "Name" || test.Properties[0].Type != "s" {
+		t.Errorf("Unexpected properties %v", test.Properties)
+	}
+	if len(node.Children) != 1 || node.Children[0].Name != "Child" {
+		t.Errorf("Unexpected children %v", node.Children)
+	}
+}
+
+type specExport struct {
+	notified chan string
+}
+
+func (e specExport) Add(a, b int32) (int32, *Error) {
+	return a + b, nil
+}
+
+func (e specExport) Notify(s string) *Error {
+	e.notified <- s
+	if s == "fail" {
+		return NewError("org.guelfey.DBus.Spec.Failed", nil)
+	}
+	return nil
+}
+
+func TestExportWithSpec(t *testing.T) {
+	connection, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatalf("Unexpected error connecting to session bus: %s", err)
+	}
+	defer connection.Close()
+
+	const path = "/org/guelfey/DBus/Spec"
+	const iface = "org.guelfey.DBus.Spec"
+	export := specExport{make(chan string, 1)}
+	for _, spec := range []InterfaceSpec{
+		{Methods: map[string]MethodSpec{"Missing": {}}},
+		{Methods: map[string]MethodSpec{"Add": {Args: []ArgSpec{{Name: "a", Direction: "in"}}}}},
+		{Methods: map[string]MethodSpec{"Add": {Args: []ArgSpec{
+			{Name: "a", Direction: "in"},
+			{Name: "b", Type: Signature{"s"}, Direction: "in"},
+			{Name: "sum", Direction: "out"},
+		}}}},
+	} {
+		if err := connection.ExportWithSpec(export, spec, path, iface); err == nil {
+			t.Errorf("ExportWithSpec accepted invalid spec %v", spec)
+		}
+	}
+
+	deprecated := []Annotation{{Name: AnnotationDeprecated, Value: "true"}}
+	err = connection.ExportWithSpec(export, InterfaceSpec{
+		Methods: map[string]MethodSpec{
+			"Add": {Args: []ArgSpec{
+				{Name: "a", Direction: "in"},
+				{Name: "b", Type: Signature{"i"}, Direction: "in"},
+				{Name: "sum", Direction: "out"},
+			}},
+			"Notify": {Annotations: []Annotation{{Name: AnnotationMethodNoReply, Value: "true"}}},
+		},
+		Signals: []SignalSpec{
+			{Name: "Changed", Args: []ArgSpec{{Name: "value", Type: Signature{"i"}}}},
+		},
+		Annotations: deprecated,
+	}, path, iface)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := connection.Object(connection.Names()[0], path)
+	var data string
+	if err := obj.Call("org.freedesktop.DBus.Introspectable.Introspect", 0).Store(&data); err != nil {
+		t.Fatal(err)
+	}
+	var node introspectionNode
+	if err := xml.Unmarshal([]byte(data), &node); err != nil {
+		t.Fatalf("Invalid introspection data %s: %s", data, err)
+	}
+	intf := node.Interfaces[0]
+	if len(intf.Annotations) != 1 || intf.Annotations[0] != deprecated[0] {
+		t.Errorf("Unexpected annotations %v", intf.Annotations)
+	}
+	if len(intf.Methods) != 2 || len(intf.Methods[0].Args) != 3 {
+		t.Fatalf("Unexpected methods %v", intf.Methods)
+	}
+	for i, want := range []introspectionArg{
+		{Name: "a", Type: "i", Direction: "in"},
+		{Name: "b", Type: "i", Direction: "in"},
+		{Name: "sum", Type: "i", Direction: "out"},
+	} {
+		if got := intf.Methods[0].Args[i]; got != want {
+			t.Errorf("Argument %d of Add is %v, want %v", i, got, want)
+		}
+	}
+	if len(intf.Signals) != 1 || intf.Signals[0].Name != "Changed" ||
+		len(intf.Signals[0].Args) != 1 || intf.Signals[0].Args[0].Name != "value" {
+		t.Errorf("Unexpected signals %v", intf.Signals)
+	}
+
+	// The NoReply annotation is only a hint; methods still reply unless the
+	// caller passes FlagNoReplyExpected.
+	if err := obj.Call(iface+".Notify", 0, "hello").Err; err != nil {
+		t.Errorf("Call of NoReply method returned %v", err)
+	}
+	if s := <-export.notified; s != "hello" {
+		t.Errorf("Notify was called with %q", s)
+	}
+	err = obj.Call(iface+".Notify", 0, "fail").Err
+	if e, ok := err.(Error); !ok || e.Name != "org.guelfey.DBus.Spec.Failed" {
+		t.Errorf("Failing call of NoReply method returned %v", err)
+	}
+	if s := <-export.notified; s != "fail" {
+		t.Errorf("Notify was called with %q", s)
+	}
+	obj.Call(iface+".Notify", FlagNoReplyExpected, "again")
+	if s := <-export.notified; s != "again" {
+		t.Errorf("Notify was called with %q", s)
+	}
+}
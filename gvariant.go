@@ -0,0 +1,600 @@
+package dbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// This file implements the GVariant serialization format, which GLib uses for
+// binary data like dconf databases and GSettings schemas. Unlike the classic
+// D-Bus marshalling, values don't carry their own lengths; instead, the size of
+// every value is known from its container, and containers of variable-size
+// values end with a table of framing offsets.
+
+// MarshalGVariant returns the serialization of v in the GVariant format in the
+// given byte order. The type of the GVariant is the signature of v, and the Go
+// types are converted as for messages (see the package documentation). UnixFD
+// values are written as their plain value, like UnixFDIndex.
+func MarshalGVariant(v interface{}, order binary.ByteOrder) (b []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var ok bool
+			if err, ok = r.(error); !ok {
+				panic(r)
+			}
+		}
+	}()
+	return gvEncoder{order}.encode(reflect.ValueOf(v), getSignature(reflect.TypeOf(v)), 0), nil
+}
+
+// UnmarshalGVariant decodes the GVariant data of the type sig, which must be a
+// single complete type, in the given byte order and stores it into dest like
+// Store. The decoded value has the same types as the values in the body of a
+// message, so dest can also be a pointer to an interface{} or a Variant.
+func UnmarshalGVariant(data []byte, sig Signature, order binary.ByteOrder, dest interface{}) error {
+	if !isSingle(sig.str) {
+		return errors.New("dbus: GVariant signature must be a single complete type")
+	}
+	v, err := gvDecode(data, sig.str, order)
+	if err != nil {
+		return err
+	}
+	return Store([]interface{}{v}, dest)
+}
+
+// gvEncode returns the GVariant serialization of v with the type sig.
+func gvEncode(v interface{}, sig string, order binary.ByteOrder) (b []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var ok bool
+			if err, ok = r.(error); !ok {
+				panic(r)
+			}
+		}
+	}()
+	return gvEncoder{order}.encode(reflect.ValueOf(v), sig, 0), nil
+}
+
+// gvDecode decodes the GVariant data with the type sig.
+func gvDecode(data []byte, sig string, order binary.ByteOrder) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var ok bool
+			if err, ok = r.(error); !ok {
+				panic(r)
+			}
+		}
+	}()
+	return gvDecoder{order}.decode(data, sig, 0), nil
+}
+
+type gvEncoder struct {
+	order binary.ByteOrder
+}
+
+// encode returns the serialization of v with the type s, which starts at an
+// offset that is aligned for s. It panics on error. depth holds the depth of
+// the container nesting.
+func (enc gvEncoder) encode(v reflect.Value, s string, depth int) []byte {
+	for v.Kind() == reflect.Ptr || (v.Kind() == reflect.Interface && s[0] != 'v') {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		panic(errors.New("dbus: cannot encode nil value"))
+	}
+	if m, ok := asMarshaler(v); ok {
+		return enc.encode(marshalValue(v.Type(), m), s, depth)
+	}
+	if isDictStruct(v.Type()) {
+		v = reflect.ValueOf(structDict(v))
+	}
+	var b []byte
+	switch s[0] {
+	case 'y':
+		b = []byte{byte(v.Uint())}
+	case 'b':
+		b = []byte{0}
+		if v.Bool() {
+			b[0] = 1
+		}
+	case 'n':
+		b = make([]byte, 2)
+		enc.order.PutUint16(b, uint16(v.Int()))
+	case 'q':
+		b = make([]byte, 2)
+		enc.order.PutUint16(b, uint16(v.Uint()))
+	case 'i':
+		b = make([]byte, 4)
+		enc.order.PutUint32(b, uint32(v.Int()))
+	case 'u':
+		b = make([]byte, 4)
+		enc.order.PutUint32(b, uint32(v.Uint()))
+	case 'h':
+		b = make([]byte, 4)
+		switch {
+		case v.Type() == fdType:
+			enc.order.PutUint32(b, uint32(fdValue(v)))
+		case v.Kind() == reflect.Int32:
+			enc.order.PutUint32(b, uint32(v.Int()))
+		default:
+			enc.order.PutUint32(b, uint32(v.Uint()))
+		}
+	case 'x':
+		b = make([]byte, 8)
+		enc.order.PutUint64(b, uint64(v.Int()))
+	case 't':
+		b = make([]byte, 8)
+		enc.order.PutUint64(b, v.Uint())
+	case 'd':
+		b = make([]byte, 8)
+		enc.order.PutUint64(b, math.Float64bits(v.Float()))
+	case 's', 'o':
+		b = append([]byte(v.String()), 0)
+	case 'g':
+		b = append([]byte(v.Interface().(Signature).str), 0)
+	case 'v':
+		if depth >= 64 {
+			panic(FormatError("input exceeds container depth limit"))
+		}
+		variant, ok := v.Interface().(Variant)
+		if !ok {
+			variant = MakeVariant(v.Interface())
+		}
+		b = enc.encode(reflect.ValueOf(variant.value), variant.sig.str, depth+1)
+		b = append(b, 0)
+		b = append(b, variant.sig.str...)
+	case 'a':
+		if depth >= 64 {
+			panic(FormatError("input exceeds container depth limit"))
+		}
+		b = enc.encodeArray(v, s[1:], depth+1)
+	case '(', '{':
+		if depth >= 64 {
+			panic(FormatError("input exceeds container depth limit"))
+		}
+		b = enc.encodeTuple(gvTupleValues(v), gvMembers(s), depth+1)
+	default:
+		panic(InvalidTypeError{v.Type()})
+	}
+	return b
+}
+
+// encodeArray returns the serialization of the slice, array or map v with the
+// element type elem.
+func (enc gvEncoder) encodeArray(v reflect.Value, elem string, depth int) []byte {
+	var items [][]byte
+	if elem[0] == '{' {
+		if v.Kind() != reflect.Map {
+			panic(InvalidTypeError{v.Type()})
+		}
+		members := gvMembers(elem)
+		keys := v.MapKeys()
+		sortKeys(keys)
+		for _, k := range keys {
+			items = append(items, enc.encodeTuple([]reflect.Value{k, v.MapIndex(k)}, members, depth+1))
+		}
+	} else {
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			panic(InvalidTypeError{v.Type()})
+		}
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, enc.encode(v.Index(i), elem, depth))
+		}
+	}
+	var b []byte
+	if gvFixedSize(elem) != 0 {
+		for _, item := range items {
+			b = append(b, item...)
+		}
+		return b
+	}
+	align := gvAlignment(elem)
+	offsets := make([]int, len(items))
+	for i, item := range items {
+		b = gvPad(b, align)
+		b = append(b, item...)
+		offsets[i] = len(b)
+	}
+	return enc.appendOffsets(b, offsets)
+}
+
+// encodeTuple returns the serialization of a tuple or dict entry with the
+// given values and types of its members.
+func (enc gvEncoder) encodeTuple(vs []reflect.Value, members []string, depth int) []byte {
+	if len(vs) != len(members) {
+		panic(errors.New("dbus: number of struct fields doesn't match signature"))
+	}
+	if len(members) == 0 {
+		// The unit type has a size of one byte.
+		return []byte{0}
+	}
+	var b []byte
+	var offsets []int
+	fixed := true
+	for i, m := range members {
+		b = gvPad(b, gvAlignment(m))
+		b = append(b, enc.encode(vs[i], m, depth)...)
+		if gvFixedSize(m) == 0 {
+			fixed = false
+			if i != len(members)-1 {
+				offsets = append(offsets, len(b))
+			}
+		}
+	}
+	if fixed {
+		align := 1
+		for _, m := range members {
+			if a := gvAlignment(m); a > align {
+				align = a
+			}
+		}
+		return gvPad(b, align)
+	}
+	// The offsets of tuples are stored in reverse order.
+	for i, j := 0, len(offsets)-1; i < j; i, j = i+1, j-1 {
+		offsets[i], offsets[j] = offsets[j], offsets[i]
+	}
+	return enc.appendOffsets(b, offsets)
+}
+
+// appendOffsets appends the framing offsets to the body b of a container,
+// using the smallest offset size that can address the whole container.
+func (enc gvEncoder) appendOffsets(b []byte, offsets []int) []byte {
+	size := 0
+	for _, n := range []int{1, 2, 4, 8} {
+		size = n
+		if gvOffsetSize(len(b)+n*len(offsets)) <= n {
+			break
+		}
+	}
+	for _, off := range offsets {
+		b = append(b, enc.putOffset(off, size)...)
+	}
+	return b
+}
+
+func (enc gvEncoder) putOffset(off, size int) []byte {
+	b := make([]byte, 8)
+	switch size {
+	case 1:
+		b[0] = byte(off)
+	case 2:
+		enc.order.PutUint16(b, uint16(off))
+	case 4:
+		enc.order.PutUint32(b, uint32(off))
+	default:
+		enc.order.PutUint64(b, uint64(off))
+	}
+	return b[:size]
+}
+
+// gvTupleValues returns the members of v, which must be a struct or a slice
+// of its members as returned by the decoder.
+func gvTupleValues(v reflect.Value) []reflect.Value {
+	var vs []reflect.Value
+	switch v.Kind() {
+	case reflect.Struct:
+		vs = structValues(v)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			vs = append(vs, v.Index(i))
+		}
+	default:
+		panic(InvalidTypeError{v.Type()})
+	}
+	return vs
+}
+
+// sortKeys sorts the keys of a map, so that dictionaries are serialized
+// deterministically.
+func sortKeys(keys []reflect.Value) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.Bool:
+			return !a.Bool() && b.Bool()
+		case reflect.String:
+			return a.String() < b.String()
+		}
+		return false
+	})
+}
+
+type gvDecoder struct {
+	order binary.ByteOrder
+}
+
+// decode decodes the serialized value data of the type s and panics on error.
+// depth holds the depth of the container nesting.
+func (dec gvDecoder) decode(data []byte, s string, depth int) interface{} {
+	if size := gvFixedSize(s); size != 0 && len(data) != size {
+		panic(FormatError("invalid size of fixed-size value"))
+	}
+	switch s[0] {
+	case 'y':
+		return data[0]
+	case 'b':
+		switch data[0] {
+		case 0:
+			return false
+		case 1:
+			return true
+		}
+		panic(FormatError("invalid value for boolean"))
+	case 'n':
+		return int16(dec.order.Uint16(data))
+	case 'q':
+		return dec.order.Uint16(data)
+	case 'i':
+		return int32(dec.order.Uint32(data))
+	case 'u':
+		return dec.order.Uint32(data)
+	case 'h':
+		return UnixFDIndex(dec.order.Uint32(data))
+	case 'x':
+		return int64(dec.order.Uint64(data))
+	case 't':
+		return dec.order.Uint64(data)
+	case 'd':
+		return math.Float64frombits(dec.order.Uint64(data))
+	case 's', 'o', 'g':
+		if len(data) == 0 || data[len(data)-1] != 0 || bytes.IndexByte(data, 0) != len(data)-1 {
+			panic(FormatError("invalid string"))
+		}
+		str := string(data[:len(data)-1])
+		switch s[0] {
+		case 'o':
+			if !ObjectPath(str).IsValid() {
+				panic(FormatError("invalid object path"))
+			}
+			return ObjectPath(str)
+		case 'g':
+			sig, err := ParseSignature(str)
+			if err != nil {
+				panic(err)
+			}
+			return sig
+		}
+		return str
+	case 'v':
+		if depth >= 64 {
+			panic(FormatError("input exceeds container depth limit"))
+		}
+		i := bytes.LastIndexByte(data, 0)
+		if i == -1 {
+			panic(FormatError("invalid variant"))
+		}
+		sig, err := ParseSignature(string(data[i+1:]))
+		if err != nil {
+			panic(err)
+		}
+		if !isSingle(sig.str) {
+			panic(FormatError("variant signature is not a single type"))
+		}
+		return Variant{sig, dec.decode(data[:i], sig.str, depth+1)}
+	case 'a':
+		if depth >= 64 {
+			panic(FormatError("input exceeds container depth limit"))
+		}
+		return dec.decodeArray(data, s, depth+1)
+	case '(', '{':
+		if depth >= 64 {
+			panic(FormatError("input exceeds container depth limit"))
+		}
+		return dec.decodeTuple(data, gvMembers(s), depth+1)
+	}
+	panic(SignatureError{Sig: s, Reason: "invalid type character"})
+}
+
+// decodeArray decodes the array data of the type s.
+func (dec gvDecoder) decodeArray(data []byte, s string, depth int) interface{} {
+	elem := s[1:]
+	var items [][]byte
+	if size := gvFixedSize(elem); size != 0 {
+		if len(data)%size != 0 {
+			panic(FormatError("invalid size of array"))
+		}
+		for i := 0; i < len(data); i += size {
+			items = append(items, data[i:i+size])
+		}
+	} else if len(data) != 0 {
+		size := gvOffsetSize(len(data))
+		end := dec.offset(data, len(data)-size, size)
+		if end > len(data)-size || (len(data)-end)%size != 0 {
+			panic(FormatError("invalid framing offset"))
+		}
+		align := gvAlignment(elem)
+		start := 0
+		for i := end; i < len(data); i += size {
+			e := dec.offset(data, i, size)
+			start = gvAlign(start, align)
+			if start > e || e > end {
+				panic(FormatError("invalid framing offset"))
+			}
+			items = append(items, data[start:e])
+			start = e
+		}
+	}
+
+	if elem[0] == '{' {
+		members := gvMembers(elem)
+		m := reflect.MakeMap(typeFor(s))
+		for _, item := range items {
+			kv := dec.decodeTuple(item, members, depth+1)
+			m.SetMapIndex(reflect.ValueOf(kv[0]), reflect.ValueOf(kv[1]))
+		}
+		return m.Interface()
+	}
+	v := reflect.MakeSlice(typeFor(s), 0, len(items))
+	for _, item := range items {
+		v = reflect.Append(v, reflect.ValueOf(dec.decode(item, elem, depth)))
+	}
+	return v.Interface()
+}
+
+// decodeTuple decodes the tuple or dict entry data with the given types of
+// its members.
+func (dec gvDecoder) decodeTuple(data []byte, members []string, depth int) []interface{} {
+	vs := make([]interface{}, 0, len(members))
+	if len(members) == 0 {
+		return vs
+	}
+	size := gvOffsetSize(len(data))
+	// The offsets are stored in reverse order at the end of the tuple.
+	frame := len(data)
+	start := 0
+	for i, m := range members {
+		start = gvAlign(start, gvAlignment(m))
+		var end int
+		if n := gvFixedSize(m); n != 0 {
+			end = start + n
+		} else if i == len(members)-1 {
+			end = frame
+		} else {
+			frame -= size
+			if frame < 0 {
+				panic(FormatError("invalid framing offset"))
+			}
+			end = dec.offset(data, frame, size)
+		}
+		if start > end || end > frame {
+			panic(FormatError("invalid framing offset"))
+		}
+		vs = append(vs, dec.decode(data[start:end], m, depth))
+		start = end
+	}
+	return vs
+}
+
+// offset reads the framing offset of the given size at i in data.
+func (dec gvDecoder) offset(data []byte, i, size int) int {
+	if i < 0 || i+size > len(data) {
+		panic(FormatError("invalid framing offset"))
+	}
+	var off uint64
+	switch size {
+	case 1:
+		off = uint64(data[i])
+	case 2:
+		off = uint64(dec.order.Uint16(data[i:]))
+	case 4:
+		off = uint64(dec.order.Uint32(data[i:]))
+	default:
+		off = dec.order.Uint64(data[i:])
+	}
+	if off > uint64(len(data)) {
+		panic(FormatError("invalid framing offset"))
+	}
+	return int(off)
+}
+
+// gvOffsetSize returns the size of the framing offsets in a container of the
+// given size.
+func gvOffsetSize(size int) int {
+	switch {
+	case size == 0:
+		return 0
+	case size <= math.MaxUint8:
+		return 1
+	case size <= math.MaxUint16:
+		return 2
+	case uint64(size) <= math.MaxUint32:
+		return 4
+	}
+	return 8
+}
+
+// gvAlignment returns the alignment of values of the single complete type s.
+func gvAlignment(s string) int {
+	switch s[0] {
+	case 'n', 'q':
+		return 2
+	case 'i', 'u', 'h':
+		return 4
+	case 'x', 't', 'd', 'v':
+		return 8
+	case 'a':
+		return gvAlignment(s[1:])
+	case '(', '{':
+		align := 1
+		for _, m := range gvMembers(s) {
+			if a := gvAlignment(m); a > align {
+				align = a
+			}
+		}
+		return align
+	}
+	return 1
+}
+
+// gvFixedSize returns the size of values of the single complete type s, or 0
+// if their size is variable.
+func gvFixedSize(s string) int {
+	switch s[0] {
+	case 'y', 'b':
+		return 1
+	case 'n', 'q':
+		return 2
+	case 'i', 'u', 'h':
+		return 4
+	case 'x', 't', 'd':
+		return 8
+	case '(', '{':
+		members := gvMembers(s)
+		if len(members) == 0 {
+			return 1
+		}
+		size, align := 0, 1
+		for _, m := range members {
+			n := gvFixedSize(m)
+			if n == 0 {
+				return 0
+			}
+			a := gvAlignment(m)
+			if a > align {
+				align = a
+			}
+			size = gvAlign(size, a) + n
+		}
+		return gvAlign(size, align)
+	}
+	return 0
+}
+
+// gvMembers returns the types of the members of the tuple or dict entry s.
+func gvMembers(s string) []string {
+	var members []string
+	rem := s[1 : len(s)-1]
+	for rem != "" {
+		err, r := validSingle(rem, 0)
+		if err != nil {
+			panic(err)
+		}
+		members = append(members, rem[:len(rem)-len(r)])
+		rem = r
+	}
+	return members
+}
+
+// gvAlign returns n rounded up to a multiple of align.
+func gvAlign(n, align int) int {
+	return (n + align - 1) / align * align
+}
+
+// gvPad appends zero bytes to b until its length is a multiple of align.
+func gvPad(b []byte, align int) []byte {
+	for len(b)%align != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
@@ -0,0 +1,172 @@
+package dbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The expected serializations were produced with GLib's g_variant_get_data.
+var gvariantTests = []struct {
+	v   interface{}
+	sig string
+	hex string
+}{
+	{byte(7), "y", "07"},
+	{true, "b", "01"},
+	{int16(-3), "n", "fdff"},
+	{uint16(65535), "q", "ffff"},
+	{int32(-100000), "i", "6079feff"},
+	{uint32(4000000000), "u", "00286bee"},
+	{int64(-1 << 40), "x", "0000000000ffffff"},
+	{uint64(1 << 63), "t", "0000000000000080"},
+	{1.5, "d", "000000000000f83f"},
+	{"hello", "s", "68656c6c6f00"},
+	{ObjectPath("/org/x"), "o", "2f6f72672f7800"},
+	{Signature{"a{sv}"}, "g", "617b73767d00"},
+	{MakeVariant("x"), "v", "78000073"},
+	{[]string{"a", "bc", ""}, "as", "610062630000020506"},
+	{[]int32{1, 2, 3}, "ai", "010000000200000003000000"},
+	{[]string{}, "as", ""},
+	{[]float64{}, "ad", ""},
+	{
+		map[string]Variant{"a": MakeVariant(int32(1)), "b": MakeVariant([]string{"x", "y"})},
+		"a{sv}",
+		"610000000000000001000000006902006200000000000000780079000204006173020f22",
+	},
+	{
+		struct {
+			S string
+			M map[string]Variant
+			H UnixFDIndex
+		}{"ab", map[string]Variant{"x": MakeVariant(int32(1))}, 3},
+		"(sa{sv}h)",
+		"61620000000000007800000000000000010000000069020f030000001803",
+	},
+	{struct {
+		A byte
+		B uint16
+		C byte
+	}{1, 2, 3}, "(yqy)", "010002000300"},
+	{[]struct {
+		T uint64
+		Y byte
+	}{{1, 2}, {3, 4}}, "a(ty)", "0100000000000000020000000000000003000000000000000400000000000000"},
+	{struct {
+		A []string
+		B struct{ X, Y int32 }
+		C string
+	}{[]string{"q", "w"}, struct{ X, Y int32 }{1, 2}, "end"}, "(as(ii)s)", "71007700020400000100000002000000656e640006"},
+	{[][]byte{[]byte("ab"), {}, []byte("c")}, "aay", "616263020203"},
+	{map[string]string{"k": "v", "a": "b"}, "a{ss}", "61006200026b00760002050a"},
+	{struct{}{}, "()", "00"},
+	{[]struct{}{{}, {}}, "a()", "0000"},
+	{
+		map[string]map[string]Variant{"conn": {"id": MakeVariant("eth0"), "n": MakeVariant(uint32(5))}},
+		"a{sa{sv}}",
+		"636f6e6e00000000696400000000000065746830000073036e0000000000000005000000007502101f052a",
+	},
+	{struct {
+		D float64
+		S string
+	}{2, "q"}, "(ds)", "00000000000000407100"},
+	{[]string{strings.Repeat("y", 200), strings.Repeat("z", 100)}, "as",
+		hex.EncodeToString([]byte(strings.Repeat("y", 200))) + "00" +
+			hex.EncodeToString([]byte(strings.Repeat("z", 100))) + "00c9002e01"},
+}
+
+func TestGVariant(t *testing.T) {
+	for _, tt := range gvariantTests {
+		if sig := SignatureOf(tt.v).str; sig != tt.sig {
+			t.Errorf("signature of %v: got %s, want %s", tt.v, sig, tt.sig)
+			continue
+		}
+		b, err := MarshalGVariant(tt.v, binary.LittleEndian)
+		if err != nil {
+			t.Errorf("marshal %s: %v", tt.sig, err)
+			continue
+		}
+		if got := hex.EncodeToString(b); got != tt.hex {
+			t.Errorf("marshal %s: got %s, want %s", tt.sig, got, tt.hex)
+			continue
+		}
+
+		// Decoding and encoding again must result in the same data.
+		var v interface{}
+		if err := UnmarshalGVariant(b, Signature{tt.sig}, binary.LittleEndian, &v); err != nil {
+			t.Errorf("unmarshal %s: %v", tt.sig, err)
+			continue
+		}
+		b2, err := gvEncode(v, tt.sig, binary.LittleEndian)
+		if err != nil {
+			t.Errorf("marshal decoded %s: %v", tt.sig, err)
+		} else if !bytes.Equal(b, b2) {
+			t.Errorf("marshal decoded %s: got %x, want %x", tt.sig, b2, b)
+		}
+
+		// Storing into a value of the original type must restore it.
+		dest := reflect.New(reflect.TypeOf(tt.v))
+		if err := UnmarshalGVariant(b, Signature{tt.sig}, binary.LittleEndian, dest.Interface()); err != nil {
+			t.Errorf("unmarshal %s into %T: %v", tt.sig, tt.v, err)
+		} else if got := dest.Elem().Interface(); !reflect.DeepEqual(got, tt.v) {
+			t.Errorf("unmarshal %s: got %#v, want %#v", tt.sig, got, tt.v)
+		}
+	}
+}
+
+func TestGVariantBigEndian(t *testing.T) {
+	v := struct {
+		A uint16
+		B []int32
+	}{1, []int32{2}}
+	b, err := MarshalGVariant(v, binary.BigEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(b); got != "0001000000000002" {
+		t.Errorf("got %s", got)
+	}
+	var got struct {
+		A uint16
+		B []int32
+	}
+	if err := UnmarshalGVariant(b, Signature{"(qai)"}, binary.BigEndian, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("got %v, want %v", got, v)
+	}
+}
+
+func TestGVariantInvalid(t *testing.T) {
+	tests := []struct {
+		sig string
+		hex string
+	}{
+		{"i", "010000"},
+		{"b", "02"},
+		{"s", "6162"},
+		{"s", "610062"},
+		{"o", "6100"},
+		{"v", "0000"},
+		{"v", "780000737300"},
+		{"as", "6100ff"},
+		{"as", "610005"},
+		{"(sai)", "6100000001000000"},
+		{"ai", "010000"},
+	}
+	for _, tt := range tests {
+		b, _ := hex.DecodeString(tt.hex)
+		var v interface{}
+		if err := UnmarshalGVariant(b, Signature{tt.sig}, binary.LittleEndian, &v); err == nil {
+			t.Errorf("%s %s: got %v, want error", tt.sig, tt.hex, v)
+		}
+	}
+	var v interface{}
+	if err := UnmarshalGVariant(nil, Signature{"ss"}, binary.LittleEndian, &v); err == nil {
+		t.Error("unmarshal with multiple types succeeded")
+	}
+}
@@ -0,0 +1,494 @@
+package dbus
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Annotation is an annotation in the introspection data that is generated for
+// exported objects.
+type Annotation struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// Well-known annotations of the introspection format.
+const (
+	// AnnotationDeprecated marks an interface, method, signal or property as
+	// deprecated if its value is "true".
+	AnnotationDeprecated = "org.freedesktop.DBus.Deprecated"
+	// AnnotationMethodNoReply on a method with the value "true" tells
+	// callers not to expect a reply. It is only a hint for callers, who
+	// still have to pass FlagNoReplyExpected.
+	AnnotationMethodNoReply = "org.freedesktop.DBus.Method.NoReply"
+	// AnnotationEmitsChangedSignal on an interface or property tells whether
+	// PropertiesChanged is emitted for it; its value is one of "true",
+	// "invalidates", "const" or "false".
+	AnnotationEmitsChangedSignal = "org.freedesktop.DBus.Property.EmitsChangedSignal"
+)
+
+// InterfaceSpec describes an interface that is exported with ExportWithSpec
+// or ExportMethodTableWithSpec beyond what can be derived from its methods.
+type InterfaceSpec struct {
+	// Methods maps the names of exported methods to their descriptions. It
+	// may leave out methods.
+	Methods     map[string]MethodSpec
+	Signals     []SignalSpec
+	Annotations []Annotation
+}
+
+// MethodSpec describes an exported method.
+type MethodSpec struct {
+	// Args describes the arguments of the method, in the order in which
+	// they appear in its signature; the arguments with direction "in"
+	// correspond to the parameters of the Go method, leaving out those of
+	// type Sender and Message, and those with direction "out" to its
+	// return values, leaving out the error. If Args is nil, the arguments
+	// are derived from the Go method and stay anonymous.
+	Args        []ArgSpec
+	Annotations []Annotation
+}
+
+// SignalSpec describes a signal that an exported interface emits.
+type SignalSpec struct {
+	Name        string
+	Args        []ArgSpec
+	Annotations []Annotation
+}
+
+// ArgSpec describes an argument of a method or a signal.
+type ArgSpec struct {
+	Name string
+	// Type is the signature of the argument. For methods, it may be left
+	// empty and is then derived from the Go method; otherwise, it must
+	// match.
+	Type Signature
+	// Direction is "in" or "out". Arguments of signals are always "out".
+	Direction string
+}
+
+// PropertySpec describes a property in the introspection data that is
+// generated for exported objects.
+type PropertySpec struct {
+	Name string
+	Type Signature
+	// Access is one of "read", "write" or "readwrite".
+	Access      string
+	Annotations []Annotation
+}
+
+// PropertiesIntrospector is implemented by values that are exported as
+// org.freedesktop.DBus.Properties and can describe the properties of the
+// other interfaces of their object, like prop.Properties does. The
+// introspection data that is generated for exported objects includes the
+// properties returned by PropertySpecs.
+type PropertiesIntrospector interface {
+	PropertySpecs(iface string) []PropertySpec
+}
+
+// The following types mirror those of the introspect package, which can't be
+// imported here.
+
+type introspectionNode struct {
+	XMLName    xml.Name                 `xml:"node"`
+	Name       string                   `xml:"name,attr,omitempty"`
+	Interfaces []introspectionInterface `xml:"interface"`
+	Children   []introspectionNode      `xml:"node,omitempty"`
+}
+
+type introspectionInterface struct {
+	Name        string                  `xml:"name,attr"`
+	Methods     []introspectionMethod   `xml:"method"`
+	Signals     []introspectionSignal   `xml:"signal"`
+	Properties  []introspectionProperty `xml:"property"`
+	Annotations []Annotation            `xml:"annotation"`
+}
+
+type introspectionMethod struct {
+	Name        string             `xml:"name,attr"`
+	Args        []introspectionArg `xml:"arg"`
+	Annotations []Annotation       `xml:"annotation"`
+}
+
+type introspectionSignal struct {
+	Name        string             `xml:"name,attr"`
+	Args        []introspectionArg `xml:"arg"`
+	Annotations []Annotation       `xml:"annotation"`
+}
+
+type introspectionProperty struct {
+	Name        string       `xml:"name,attr"`
+	Type        string       `xml:"type,attr"`
+	Access      string       `xml:"access,attr"`
+	Annotations []Annotation `xml:"annotation"`
+}
+
+type introspectionArg struct {
+	Name      string `xml:"name,attr,omitempty"`
+	Type      string `xml:"type,attr"`
+	Direction string `xml:"direction,attr,omitempty"`
+}
+
+const introspectionDeclaration = `<!DOCTYPE node PUBLIC "-//freedesktop//DTD D-BUS Object Introspection 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/introspect.dtd">
+`
+
+var peerIntrospection = introspectionInterface{
+	Name: "org.freedesktop.DBus.Peer",
+	Methods: []introspectionMethod{
+		{Name: "Ping"},
+		{
+			Name: "GetMachineId",
+			Args: []introspectionArg{
+				{Name: "machine_uuid", Type: "s", Direction: "out"},
+			},
+		},
+	},
+}
+
+var introspectableIntrospection = introspectionInterface{
+	Name: "org.freedesktop.DBus.Introspectable",
+	Methods: []introspectionMethod{
+		{
+			Name: "Introspect",
+			Args: []introspectionArg{
+				{Name: "out", Type: "s", Direction: "out"},
+			},
+		},
+	},
+}
+
+var propertiesIntrospection = introspectionInterface{
+	Name: "org.freedesktop.DBus.Properties",
+	Methods: []introspectionMethod{
+		{
+			Name: "Get",
+			Args: []introspectionArg{
+				{Name: "interface", Type: "s", Direction: "in"},
+				{Name: "property", Type: "s", Direction: "in"},
+				{Name: "value", Type: "v", Direction: "out"},
+			},
+		},
+		{
+			Name: "GetAll",
+			Args: []introspectionArg{
+				{Name: "interface", Type: "s", Direction: "in"},
+				{Name: "props", Type: "a{sv}", Direction: "out"},
+			},
+		},
+		{
+			Name: "Set",
+			Args: []introspectionArg{
+				{Name: "interface", Type: "s", Direction: "in"},
+				{Name: "property", Type: "s", Direction: "in"},
+				{Name: "value", Type: "v", Direction: "in"},
+			},
+		},
+	},
+	Signals: []introspectionSignal{
+		{
+			Name: "PropertiesChanged",
+			Args: []introspectionArg{
+				{Name: "interface", Type: "s", Direction: "out"},
+				{Name: "changed_properties", Type: "a{sv}", Direction: "out"},
+				{Name: "invalidated_properties", Type: "as", Direction: "out"},
+			},
+		},
+	},
+}
+
+// introspectPath returns the introspection data of path. For paths on which
+// interfaces are exported, directly or as part of a subtree, it describes
+// these interfaces together with the standard ones; otherwise, it only lists
+// the children of path.
+func (h *defaultHandler) introspectPath(path ObjectPath) string {
+	h.RLock()
+	defer h.RUnlock()
+	node := introspectionNode{}
+	for _, name := range h.childNames(path) {
+		node.Children = append(node.Children, introspectionNode{Name: name})
+	}
+	ifaces := h.interfacesAt(path)
+	if len(ifaces) == 0 {
+		var buf bytes.Buffer
+		buf.WriteString("<node>")
+		for _, child := range node.Children {
+			buf.WriteString("\n\t<node name=\"" + child.Name + "\"/>")
+		}
+		buf.WriteString("\n</node>")
+		return buf.String()
+	}
+
+	var props PropertiesIntrospector
+	if intf, ok := ifaces[propertiesIntrospection.Name]; ok {
+		props, _ = intf.value.(PropertiesIntrospector)
+	}
+	names := make([]string, 0, len(ifaces))
+	for name := range ifaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var intf introspectionInterface
+		switch name {
+		case peerIntrospection.Name, introspectableIntrospection.Name, propertiesIntrospection.Name:
+			// added below
+			continue
+		default:
+			intf = introspectInterface(name, ifaces[name])
+		}
+		if props != nil {
+			for _, p := range props.PropertySpecs(name) {
+				intf.Properties = append(intf.Properties, introspectionProperty{
+					Name:        p.Name,
+					Type:        p.Type.String(),
+					Access:      p.Access,
+					Annotations: p.Annotations,
+				})
+			}
+		}
+		node.Interfaces = append(node.Interfaces, intf)
+	}
+	if _, ok := ifaces[propertiesIntrospection.Name]; ok {
+		node.Interfaces = append(node.Interfaces, propertiesIntrospection)
+	}
+	node.Interfaces = append(node.Interfaces, introspectableIntrospection, peerIntrospection)
+
+	b, err := xml.MarshalIndent(node, "", "\t")
+	if err != nil {
+		// only possible with invalid names, which can't be exported
+		panic(err)
+	}
+	return introspectionDeclaration + string(b)
+}
+
+// childNames returns the sorted names of the children of path that lead to
+// exported objects. h must be locked.
+func (h *defaultHandler) childNames(path ObjectPath) []string {
+	p := string(path)
+	if p != "/" {
+		p += "/"
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for obj := range h.objects {
+		if !strings.HasPrefix(string(obj), p) || len(obj) == len(p) {
+			continue
+		}
+		name := strings.Split(string(obj[len(p):]), "/")[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// interfacesAt returns the interfaces that are exported on path, or, if there
+// aren't any, those that are exported on the subtree that path belongs to. h
+// must be locked.
+func (h *defaultHandler) interfacesAt(path ObjectPath) map[string]*exportedIntf {
+	ifaces := make(map[string]*exportedIntf)
+	if obj, ok := h.objects[path]; ok {
+		obj.mu.RLock()
+		for name, intf := range obj.interfaces {
+			ifaces[name] = intf
+		}
+		obj.mu.RUnlock()
+		if len(ifaces) > 0 {
+			return ifaces
+		}
+	}
+	for p := path; len(p) > 1; {
+		p = p[:strings.LastIndex(string(p), "/")]
+		if p == "" {
+			p = "/"
+		}
+		obj, ok := h.objects[p]
+		if !ok {
+			continue
+		}
+		obj.mu.RLock()
+		for name, intf := range obj.interfaces {
+			if intf.includeSubtree {
+				ifaces[name] = intf
+			}
+		}
+		obj.mu.RUnlock()
+		break
+	}
+	return ifaces
+}
+
+// introspectInterface describes the methods of intf, as well as the signals
+// and annotations of its spec. Methods with argument types that can't be
+// represented in D-Bus are left out.
+func introspectInterface(name string, intf *exportedIntf) introspectionInterface {
+	desc := introspectionInterface{Name: name}
+	methods := make([]string, 0, len(intf.methods))
+	for method := range intf.methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		var spec *MethodSpec
+		if s, ok := intf.spec.Methods[method]; ok {
+			spec = &s
+		}
+		if m, ok := introspectMethod(method, intf.methods[method], spec); ok {
+			desc.Methods = append(desc.Methods, m)
+		}
+	}
+	for _, sig := range intf.spec.Signals {
+		s := introspectionSignal{Name: sig.Name, Annotations: sig.Annotations}
+		for _, arg := range sig.Args {
+			s.Args = append(s.Args, introspectionArg{Name: arg.Name, Type: arg.Type.String(), Direction: "out"})
+		}
+		desc.Signals = append(desc.Signals, s)
+	}
+	desc.Annotations = intf.spec.Annotations
+	return desc
+}
+
+// introspectMethod describes m, which is exported with the given name and
+// spec, which may be nil.
+func introspectMethod(name string, m Method, spec *MethodSpec) (desc introspectionMethod, ok bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			if _, isTypeErr := err.(InvalidTypeError); !isTypeErr {
+				panic(err)
+			}
+			ok = false
+		}
+	}()
+	desc.Name = name
+	in, out := methodArgTypes(m)
+	for _, t := range append(in, out...) {
+		if t == nil {
+			return desc, false
+		}
+	}
+	if spec != nil {
+		desc.Annotations = spec.Annotations
+		if spec.Args != nil {
+			// the spec was checked against m when it was exported
+			for _, arg := range spec.Args {
+				var t reflect.Type
+				if arg.Direction == "in" {
+					t, in = in[0], in[1:]
+				} else {
+					t, out = out[0], out[1:]
+				}
+				desc.Args = append(desc.Args, introspectionArg{
+					Name:      arg.Name,
+					Type:      SignatureOfType(t).String(),
+					Direction: arg.Direction,
+				})
+			}
+			return desc, true
+		}
+	}
+	for _, t := range in {
+		desc.Args = append(desc.Args, introspectionArg{Type: SignatureOfType(t).String(), Direction: "in"})
+	}
+	for _, t := range out {
+		desc.Args = append(desc.Args, introspectionArg{Type: SignatureOfType(t).String(), Direction: "out"})
+	}
+	return desc, true
+}
+
+// checkMethodSpec returns an error if spec doesn't match m, which is exported
+// with the given name.
+func checkMethodSpec(name string, m Method, spec MethodSpec) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			typeErr, ok := e.(InvalidTypeError)
+			if !ok {
+				panic(e)
+			}
+			err = fmt.Errorf("dbus: method %s: %s", name, typeErr)
+		}
+	}()
+	if spec.Args == nil {
+		return nil
+	}
+	in, out := methodArgTypes(m)
+	for _, arg := range spec.Args {
+		var t reflect.Type
+		switch {
+		case arg.Direction == "in" && len(in) > 0:
+			t, in = in[0], in[1:]
+		case arg.Direction == "out" && len(out) > 0:
+			t, out = out[0], out[1:]
+		case arg.Direction == "in" || arg.Direction == "out":
+			return fmt.Errorf("dbus: method %s has no %s argument %q", name, arg.Direction, arg.Name)
+		default:
+			return fmt.Errorf("dbus: invalid direction %q of argument %q of method %s", arg.Direction, arg.Name, name)
+		}
+		if arg.Type.str != "" && arg.Type != SignatureOfType(t) {
+			return fmt.Errorf("dbus: argument %q of method %s has type %s, not %s",
+				arg.Name, name, SignatureOfType(t), arg.Type)
+		}
+	}
+	if len(in) > 0 || len(out) > 0 {
+		return fmt.Errorf("dbus: arguments of method %s are missing from its spec", name)
+	}
+	return nil
+}
+
+// checkInterfaceSpec returns an error if spec doesn't match the given methods.
+func checkInterfaceSpec(spec *InterfaceSpec, methods map[string]Method) error {
+	for name, m := range spec.Methods {
+		method, ok := methods[name]
+		if !ok {
+			return fmt.Errorf("dbus: spec describes unknown method %s", name)
+		}
+		if err := checkMethodSpec(name, method, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	senderType  = reflect.TypeOf((*Sender)(nil)).Elem()
+	messageType = reflect.TypeOf((*Message)(nil)).Elem()
+)
+
+// methodArgTypes returns the types of the arguments of m, leaving out those of
+// type Sender and Message, and of its return values, leaving out a trailing
+// error.
+func methodArgTypes(m Method) (in, out []reflect.Type) {
+	if em, ok := m.(exportedMethod); ok {
+		t := em.Type()
+		for i := 0; i < t.NumIn(); i++ {
+			in = append(in, t.In(i))
+		}
+		for i := 0; i < t.NumOut(); i++ {
+			out = append(out, t.Out(i))
+		}
+	} else {
+		for i := 0; i < m.NumArguments(); i++ {
+			in = append(in, reflect.TypeOf(m.ArgumentValue(i)))
+		}
+		for i := 0; i < m.NumReturns(); i++ {
+			out = append(out, reflect.TypeOf(m.ReturnValue(i)))
+		}
+	}
+	filtered := in[:0]
+	for _, t := range in {
+		if t != senderType && t != messageType {
+			filtered = append(filtered, t)
+		}
+	}
+	in = filtered
+	if n := len(out); n > 0 && out[n-1] != nil && out[n-1].Implements(errType) {
+		out = out[:n-1]
+	}
+	return in, out
+}
@@ -0,0 +1,177 @@
+package dbus
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// DBusMarshaler is the interface implemented by types that encode themselves
+// as another D-Bus value.
+type DBusMarshaler interface {
+	// MarshalDBus returns the signature and the value that the receiver is
+	// encoded as. The value is converted to the signature if necessary, e.g.
+	// from a string to an ObjectPath. As it is also used as the signature of
+	// the type, the signature must be the same for all values of the type,
+	// including the zero value.
+	MarshalDBus() (Signature, interface{}, error)
+}
+
+// DBusUnmarshaler is the interface implemented by types that decode themselves
+// from a D-Bus value.
+type DBusUnmarshaler interface {
+	// UnmarshalDBus sets the receiver to the decoded value v, which has the
+	// types of the values in the body of a message, e.g. a slice of empty
+	// interfaces for a STRUCT. If the value is a VARIANT, v is its value.
+	UnmarshalDBus(v interface{}) error
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*DBusMarshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*DBusUnmarshaler)(nil)).Elem()
+)
+
+// A marshalerInfo describes whether a type implements DBusMarshaler and the
+// signature of its values if it does.
+type marshalerInfo struct {
+	// marshaler is set if the type or a pointer to it implements
+	// DBusMarshaler, and ptr if only the pointer type does.
+	marshaler, ptr bool
+	// sig is the signature of the values of the type, or err the reason why
+	// it has none.
+	sig string
+	err error
+}
+
+var (
+	marshalerInfos  sync.Map // map[reflect.Type]*marshalerInfo
+	noMarshalerInfo marshalerInfo
+)
+
+// getMarshalerInfo returns whether t implements DBusMarshaler. The signature of
+// its values is that of its zero value, so that MarshalDBus is called only
+// once per type.
+func getMarshalerInfo(t reflect.Type) *marshalerInfo {
+	if t.PkgPath() == "" && t.Kind() != reflect.Ptr && t.Kind() != reflect.Struct {
+		// Predeclared and unnamed types have no methods, unless they
+		// are promoted from embedded fields.
+		return &noMarshalerInfo
+	}
+	if info, ok := marshalerInfos.Load(t); ok {
+		return info.(*marshalerInfo)
+	}
+	info := new(marshalerInfo)
+	var v reflect.Value
+	switch {
+	case t.Kind() == reflect.Interface:
+	case t.Implements(marshalerType):
+		info.marshaler = true
+		if t.Kind() == reflect.Ptr {
+			v = reflect.New(t.Elem())
+		} else {
+			v = reflect.Zero(t)
+		}
+	case t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(marshalerType):
+		info.marshaler, info.ptr = true, true
+		v = reflect.New(t)
+	}
+	if info.marshaler {
+		sig, _, _ := v.Interface().(DBusMarshaler).MarshalDBus()
+		if isSingle(sig.str) {
+			info.sig = sig.str
+		} else {
+			info.err = fmt.Errorf("dbus: MarshalDBus of %s returns invalid signature %q", t, sig.str)
+		}
+	}
+	actual, _ := marshalerInfos.LoadOrStore(t, info)
+	return actual.(*marshalerInfo)
+}
+
+// asMarshaler returns v as a DBusMarshaler if it or a pointer to it implements
+// the interface.
+func asMarshaler(v reflect.Value) (DBusMarshaler, bool) {
+	info := getMarshalerInfo(v.Type())
+	if !info.marshaler {
+		return nil, false
+	}
+	if info.ptr {
+		if !v.CanAddr() {
+			p := reflect.New(v.Type())
+			p.Elem().Set(v)
+			v = p.Elem()
+		}
+		return v.Addr().Interface().(DBusMarshaler), true
+	}
+	return v.Interface().(DBusMarshaler), true
+}
+
+// marshalValue returns the value that m, a value of type t, is encoded as and
+// panics on error. The signature of the value must be that of t.
+func marshalValue(t reflect.Type, m DBusMarshaler) reflect.Value {
+	info := getMarshalerInfo(t)
+	if info.err != nil {
+		panic(info.err)
+	}
+	sig, v, err := m.MarshalDBus()
+	if err != nil {
+		panic(err)
+	}
+	if sig.str != info.sig {
+		panic(SignatureError{Sig: sig.str, Reason: "differs from signature " + info.sig + " of " + t.String()})
+	}
+	if v == nil {
+		panic(errors.New("dbus: MarshalDBus returned nil value"))
+	}
+	return convertToSignature(reflect.ValueOf(v), sig.str)
+}
+
+// marshalerSignature returns the signature of the type t if it or its pointer
+// type implements DBusMarshaler. The error is set if t has no valid signature.
+func marshalerSignature(t reflect.Type) (string, bool, error) {
+	info := getMarshalerInfo(t)
+	return info.sig, info.marshaler, info.err
+}
+
+// sigAlignment returns the alignment of values of the single complete type s.
+func sigAlignment(s string) int {
+	if s[0] == '(' || s[0] == '{' {
+		return 8
+	}
+	return alignment(typeFor(s))
+}
+
+// isBasicSignature returns whether s is the signature of a basic type, which
+// can be the key of a DICT.
+func isBasicSignature(s string) bool {
+	return len(s) == 1 && strings.IndexByte("ybnqiuxtdsogh", s[0]) != -1
+}
+
+// asUnmarshaler returns dest as a DBusUnmarshaler if it or a pointer to it
+// implements the interface. A nil pointer is set to a new value first.
+func asUnmarshaler(dest reflect.Value) (DBusUnmarshaler, bool) {
+	t := dest.Type()
+	switch {
+	case t.Kind() == reflect.Interface:
+		return nil, false
+	case t.Kind() == reflect.Ptr && t.Implements(unmarshalerType):
+		if dest.IsNil() {
+			if !dest.CanSet() {
+				return nil, false
+			}
+			dest.Set(reflect.New(t.Elem()))
+		}
+		return dest.Interface().(DBusUnmarshaler), true
+	case t.Kind() != reflect.Ptr && dest.CanAddr() && reflect.PtrTo(t).Implements(unmarshalerType):
+		return dest.Addr().Interface().(DBusUnmarshaler), true
+	}
+	return nil, false
+}
+
+// isUnmarshalerType returns whether values of type t can be stored with
+// DBusUnmarshaler.
+func isUnmarshalerType(t reflect.Type) bool {
+	return t.Kind() != reflect.Interface &&
+		(t.Implements(unmarshalerType) || reflect.PtrTo(t).Implements(unmarshalerType))
+}
@@ -0,0 +1,235 @@
+package dbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testColor int
+
+const (
+	testRed testColor = iota
+	testGreen
+	testInvalid
+)
+
+var testColorNames = []string{"red", "green"}
+
+func (c testColor) MarshalDBus() (Signature, interface{}, error) {
+	if c < 0 || int(c) >= len(testColorNames) {
+		return Signature{"s"}, "", errors.New("invalid color")
+	}
+	return Signature{"s"}, testColorNames[c], nil
+}
+
+func (c *testColor) UnmarshalDBus(v interface{}) error {
+	s, ok := v.(string)
+	if !ok {
+		return errors.New("color is not a string")
+	}
+	for i, name := range testColorNames {
+		if name == s {
+			*c = testColor(i)
+			return nil
+		}
+	}
+	return errors.New("unknown color " + s)
+}
+
+type testTime struct {
+	time.Time
+}
+
+func (t *testTime) MarshalDBus() (Signature, interface{}, error) {
+	return Signature{"x"}, t.Unix(), nil
+}
+
+func (t *testTime) UnmarshalDBus(v interface{}) error {
+	t.Time = time.Unix(v.(int64), 0)
+	return nil
+}
+
+type testIP net.IP
+
+func (ip testIP) MarshalDBus() (Signature, interface{}, error) {
+	return Signature{"ay"}, []byte(net.IP(ip).To16()), nil
+}
+
+func (ip *testIP) UnmarshalDBus(v interface{}) error {
+	*ip = testIP(v.([]byte))
+	return nil
+}
+
+type testMarshalStruct struct {
+	Color  testColor
+	Time   testTime
+	IP     testIP
+	Colors map[testColor][]testTime
+}
+
+func TestMarshalerSignature(t *testing.T) {
+	tests := []struct {
+		v   interface{}
+		sig string
+	}{
+		{testRed, "s"},
+		{testTime{}, "x"},
+		{&testTime{}, "x"},
+		{testIP{}, "ay"},
+		{testMarshalStruct{}, "(sxaya{sax})"},
+		{map[testColor]bool{}, "a{sb}"},
+	}
+	for _, tt := range tests {
+		if sig := SignatureOf(tt.v).String(); sig != tt.sig {
+			t.Errorf("SignatureOf(%T) = %s, want %s", tt.v, sig, tt.sig)
+		}
+	}
+}
+
+func TestMarshaler(t *testing.T) {
+	now := testTime{time.Unix(time.Now().Unix(), 0)}
+	v := testMarshalStruct{
+		Color:  testGreen,
+		Time:   now,
+		IP:     testIP(net.ParseIP("::1")),
+		Colors: map[testColor][]testTime{testRed: {now}},
+	}
+	vs := encodeDecode(t, v)
+	want := []interface{}{
+		"green",
+		now.Unix(),
+		[]byte(net.ParseIP("::1")),
+		map[string][]int64{"red": {now.Unix()}},
+	}
+	if !reflect.DeepEqual(vs[0], want) {
+		t.Errorf("got %#v, want %#v", vs[0], want)
+	}
+	var got testMarshalStruct
+	if err := Store(vs, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("got %v, want %v", got, v)
+	}
+
+	var c testColor
+	if err := MakeVariant("green").Store(&c); err != nil || c != testGreen {
+		t.Errorf("Variant.Store: got %v, %v", c, err)
+	}
+	if err := Store([]interface{}{"blue"}, &c); err == nil {
+		t.Error("storing unknown color succeeded")
+	}
+	if _, err := MarshalGVariant(testInvalid, binary.LittleEndian); err == nil {
+		t.Error("marshaling invalid color succeeded")
+	}
+	b, err := MarshalGVariant(v, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = testMarshalStruct{}
+	if err := UnmarshalGVariant(b, SignatureOf(v), binary.LittleEndian, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("GVariant: got %v, want %v", got, v)
+	}
+}
+
+func TestMarshalerMapKeys(t *testing.T) {
+	// The keys of maps are stored like their values, so that they can be
+	// unmarshalers too.
+	var got map[testColor]bool
+	if err := Store([]interface{}{map[string]bool{"red": true, "green": false}}, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[testColor]bool{testRed: true, testGreen: false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := Store([]interface{}{map[string]bool{"blue": true}}, &got); err == nil {
+		t.Error("storing unknown color key succeeded")
+	}
+}
+
+type testBadSig struct{}
+
+func (testBadSig) MarshalDBus() (Signature, interface{}, error) {
+	return Signature{"ii"}, nil, nil
+}
+
+func TestMarshalerInvalidSignature(t *testing.T) {
+	for _, v := range []interface{}{testBadSig{}, []testBadSig{}, map[string]testBadSig{"a": {}}} {
+		buf := new(bytes.Buffer)
+		if err := newEncoder(buf, binary.LittleEndian).Encode(v); err == nil {
+			t.Errorf("encoding %T succeeded", v)
+		}
+		if _, err := MarshalGVariant(v, binary.LittleEndian); err == nil {
+			t.Errorf("marshaling %T succeeded", v)
+		}
+	}
+}
+
+// testVarying has a signature that depends on its value.
+type testVarying bool
+
+func (v testVarying) MarshalDBus() (Signature, interface{}, error) {
+	if v {
+		return Signature{"s"}, "true", nil
+	}
+	return Signature{"i"}, int32(0), nil
+}
+
+func TestMarshalerMessage(t *testing.T) {
+	for _, v := range []interface{}{testInvalid, testVarying(true), []testVarying{false, true}} {
+		msg := &Message{
+			Type: TypeSignal,
+			Headers: map[HeaderField]Variant{
+				FieldPath:      MakeVariant(ObjectPath("/org/godbus/test")),
+				FieldInterface: MakeVariant("org.godbus.Test"),
+				FieldMember:    MakeVariant("Test"),
+				FieldSignature: MakeVariant(SignatureOf(v)),
+			},
+			Body: []interface{}{v},
+		}
+		buf := new(bytes.Buffer)
+		if err := msg.EncodeTo(buf, binary.LittleEndian); err == nil {
+			t.Errorf("encoding %#v succeeded", v)
+		}
+	}
+	if _, err := MarshalGVariant(testVarying(true), binary.LittleEndian); err == nil {
+		t.Error("marshaling testVarying(true) succeeded")
+	}
+}
+
+type marshalerExport struct{}
+
+func (marshalerExport) Next(c testColor, t testTime) (testColor, *testTime, *Error) {
+	return c + 1, &testTime{t.Add(time.Hour)}, nil
+}
+
+func TestMarshalerExport(t *testing.T) {
+	conn, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Export(marshalerExport{}, "/org/godbus/marshal", "org.godbus.Marshal")
+	obj := conn.Object(conn.Names()[0], "/org/godbus/marshal")
+	now := testTime{time.Unix(time.Now().Unix(), 0)}
+	var c testColor
+	var tm testTime
+	if err := obj.Call("org.godbus.Marshal.Next", 0, testRed, now).Store(&c, &tm); err != nil {
+		t.Fatal(err)
+	}
+	if c != testGreen || !tm.Equal(now.Add(time.Hour)) {
+		t.Errorf("got %v, %v", c, tm)
+	}
+	if err := obj.Call("org.godbus.Marshal.Next", 0, "blue", int64(0)).Err; err == nil {
+		t.Error("call with unknown color succeeded")
+	}
+}
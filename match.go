@@ -1,6 +1,9 @@
 package dbus
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -10,19 +13,22 @@ import (
 type MatchOption struct {
 	key   string
 	value string
+	// err is the reason why the option is invalid, if it is. It is returned
+	// when the option is used.
+	err error
 }
 
 func formatMatchOptions(options []MatchOption) string {
 	items := make([]string, 0, len(options))
 	for _, option := range options {
-		items = append(items, option.key+"='"+option.value+"'")
+		items = append(items, option.key+"="+quoteMatchValue(option.value))
 	}
 	return strings.Join(items, ",")
 }
 
 // WithMatchOption creates match option with given key and value
 func WithMatchOption(key, value string) MatchOption {
-	return MatchOption{key, value}
+	return MatchOption{key: key, value: value}
 }
 
 // doesn't make sense to export this option because clients can only
@@ -60,3 +66,424 @@ func WithMatchPathNamespace(namespace ObjectPath) MatchOption {
 func WithMatchDestination(destination string) MatchOption {
 	return WithMatchOption("destination", destination)
 }
+
+// WithMatchArg sets argN match option, which matches messages whose argument
+// with index n is a string equal to value. n must be between 0 and 63;
+// otherwise, using the option returns an error.
+func WithMatchArg(n int, value string) MatchOption {
+	opt := WithMatchOption("arg"+strconv.Itoa(n), value)
+	opt.err = checkArgIndex(n)
+	return opt
+}
+
+// WithMatchArgPath sets argNpath match option, which matches messages whose
+// argument with index n is a string or object path that is equal to path, or
+// either of them ends with a slash and is a prefix of the other. n must be
+// between 0 and 63; otherwise, using the option returns an error.
+func WithMatchArgPath(n int, path string) MatchOption {
+	opt := WithMatchOption("arg"+strconv.Itoa(n)+"path", path)
+	opt.err = checkArgIndex(n)
+	return opt
+}
+
+// checkArgIndex returns an error if n is not a valid argument index for the
+// argN and argNpath match options.
+func checkArgIndex(n int) error {
+	if n < 0 || n > 63 {
+		return fmt.Errorf("dbus: match rule argument index %d is not between 0 and 63", n)
+	}
+	return nil
+}
+
+// WithMatchArg0Namespace sets arg0namespace match option, which matches
+// messages whose first argument is a bus name or interface name equal to
+// namespace or starting with namespace followed by a dot.
+func WithMatchArg0Namespace(namespace string) MatchOption {
+	return WithMatchOption("arg0namespace", namespace)
+}
+
+// newMatchRule returns the match rule formed by options, or an error if they
+// don't form a valid one. Unknown keys are an error if strict is set and are
+// left out of the returned rule otherwise, so that options for keys added in
+// later versions of the specification can still be passed to the bus.
+func newMatchRule(options []MatchOption, strict bool) (*MatchRule, error) {
+	r := new(MatchRule)
+	seen := make(map[string]bool)
+	for _, option := range options {
+		if option.err != nil {
+			return nil, option.err
+		}
+		if seen[option.key] {
+			return nil, fmt.Errorf("dbus: duplicate match rule key %q", option.key)
+		}
+		seen[option.key] = true
+		if err := r.set(option.key, option.value); err != nil {
+			if _, ok := err.(unknownMatchKeyError); ok && !strict {
+				continue
+			}
+			return nil, err
+		}
+	}
+	if r.Path != "" && r.PathNamespace != "" {
+		return nil, errors.New("dbus: match rule contains both path and path_namespace")
+	}
+	return r, nil
+}
+
+// MatchRule is a parsed match rule. The zero value matches every message.
+type MatchRule struct {
+	// Type restricts matching to messages of the given type if it is not 0.
+	Type Type
+
+	Sender        string
+	Interface     string
+	Member        string
+	Path          ObjectPath
+	PathNamespace ObjectPath
+	Destination   string
+
+	// Args maps argument indices to the string that the argument must be
+	// equal to (argN).
+	Args map[int]string
+	// ArgPaths maps argument indices to the path that the argument must be
+	// equal to or a prefix of, or have as prefix (argNpath).
+	ArgPaths map[int]string
+	// Arg0Namespace is the bus name or interface namespace that the first
+	// argument must be in (arg0namespace).
+	Arg0Namespace string
+
+	// Eavesdrop has no influence on matching; it asks the bus to also deliver
+	// messages that are addressed to other connections.
+	Eavesdrop bool
+}
+
+var matchRuleTypes = map[string]Type{
+	"method_call":   TypeMethodCall,
+	"method_return": TypeMethodReply,
+	"error":         TypeError,
+	"signal":        TypeSignal,
+}
+
+var errInvalidMatchRule = errors.New("dbus: invalid match rule")
+
+// unknownMatchKeyError is returned for match rule keys that aren't known.
+type unknownMatchKeyError string
+
+func (e unknownMatchKeyError) Error() string {
+	return fmt.Sprintf("dbus: unknown match rule key %q", string(e))
+}
+
+// ParseMatchRule parses a match rule as described in the D-Bus specification.
+// An error is returned if the rule is malformed, contains a key more than
+// once or a value that is invalid for its key.
+func ParseMatchRule(s string) (*MatchRule, error) {
+	r := new(MatchRule)
+	seen := make(map[string]bool)
+	for {
+		s = strings.TrimLeft(s, " \t\n")
+		if s == "" {
+			break
+		}
+		i := strings.IndexByte(s, '=')
+		if i == -1 {
+			return nil, errInvalidMatchRule
+		}
+		key := strings.TrimSpace(s[:i])
+		value, rest, err := parseMatchValue(s[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		s = rest
+		if seen[key] {
+			return nil, fmt.Errorf("dbus: duplicate match rule key %q", key)
+		}
+		seen[key] = true
+		if err := r.set(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if r.Path != "" && r.PathNamespace != "" {
+		return nil, errors.New("dbus: match rule contains both path and path_namespace")
+	}
+	return r, nil
+}
+
+// parseMatchValue parses a possibly quoted value up to the next unquoted comma
+// and returns the value and the rest of the rule after the comma. Inside of
+// quotes, all characters are taken literally; outside of them, \' stands for
+// an apostrophe.
+func parseMatchValue(s string) (string, string, error) {
+	var value []byte
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+			value = append(value, c)
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\'':
+			value = append(value, '\'')
+			i++
+		case c == ',':
+			return string(value), s[i+1:], nil
+		default:
+			value = append(value, c)
+		}
+	}
+	if quoted {
+		return "", "", errors.New("dbus: unterminated quote in match rule")
+	}
+	return string(value), "", nil
+}
+
+func (r *MatchRule) set(key, value string) error {
+	valid := true
+	switch key {
+	case "type":
+		r.Type, valid = matchRuleTypes[value]
+	case "sender":
+		r.Sender = value
+		valid = isValidBusName(value)
+	case "interface":
+		r.Interface = value
+		valid = isValidInterface(value)
+	case "member":
+		r.Member = value
+		valid = isValidMember(value)
+	case "path":
+		r.Path = ObjectPath(value)
+		valid = r.Path.IsValid()
+	case "path_namespace":
+		r.PathNamespace = ObjectPath(value)
+		valid = r.PathNamespace.IsValid()
+	case "destination":
+		r.Destination = value
+		valid = isValidBusName(value)
+	case "arg0namespace":
+		r.Arg0Namespace = value
+		valid = isValidNamespace(value)
+	case "eavesdrop":
+		switch value {
+		case "true":
+			r.Eavesdrop = true
+		case "false":
+			r.Eavesdrop = false
+		default:
+			valid = false
+		}
+	default:
+		n, path, ok := parseArgKey(key)
+		if !ok {
+			return unknownMatchKeyError(key)
+		}
+		if path {
+			if r.ArgPaths == nil {
+				r.ArgPaths = make(map[int]string)
+			}
+			r.ArgPaths[n] = value
+		} else {
+			if r.Args == nil {
+				r.Args = make(map[int]string)
+			}
+			r.Args[n] = value
+		}
+	}
+	if !valid {
+		return fmt.Errorf("dbus: invalid value %q for match rule key %q", value, key)
+	}
+	return nil
+}
+
+// parseArgKey parses a match rule key of the form argN or argNpath.
+func parseArgKey(key string) (n int, path bool, ok bool) {
+	if !strings.HasPrefix(key, "arg") {
+		return 0, false, false
+	}
+	num := key[3:]
+	if strings.HasSuffix(num, "path") {
+		num = num[:len(num)-4]
+		path = true
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 0 || n > 63 || num != strconv.Itoa(n) {
+		return 0, false, false
+	}
+	return n, path, true
+}
+
+// String returns the rule in the format understood by ParseMatchRule and the
+// AddMatch method of the bus. Keys are written in a fixed order, so rules
+// that match the same messages yield the same string.
+func (r *MatchRule) String() string {
+	var items []string
+	add := func(key, value string) {
+		if value != "" {
+			items = append(items, key+"="+quoteMatchValue(value))
+		}
+	}
+	for name, typ := range matchRuleTypes {
+		if typ == r.Type {
+			add("type", name)
+		}
+	}
+	add("sender", r.Sender)
+	add("interface", r.Interface)
+	add("member", r.Member)
+	add("path", string(r.Path))
+	add("path_namespace", string(r.PathNamespace))
+	add("destination", r.Destination)
+	for i := 0; i < 64; i++ {
+		if v, ok := r.Args[i]; ok {
+			items = append(items, "arg"+strconv.Itoa(i)+"="+quoteMatchValue(v))
+		}
+		if v, ok := r.ArgPaths[i]; ok {
+			items = append(items, "arg"+strconv.Itoa(i)+"path="+quoteMatchValue(v))
+		}
+	}
+	add("arg0namespace", r.Arg0Namespace)
+	if r.Eavesdrop {
+		add("eavesdrop", "true")
+	}
+	return strings.Join(items, ",")
+}
+
+// quoteMatchValue quotes a match rule value. Apostrophes can't appear inside
+// of quotes, so they are written as \' between two quoted parts.
+func quoteMatchValue(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Matches returns whether msg matches r. The sender key is compared with the
+// sender of msg verbatim; as messages that were routed by a bus carry the
+// unique name of their sender, use MatchesOwner for rules that match on a
+// well-known sender name.
+func (r *MatchRule) Matches(msg *Message) bool {
+	return r.MatchesOwner(msg, nil)
+}
+
+// MatchesOwner is like Matches, but if the sender of msg differs from the
+// sender key of r, it calls ownsName to determine whether the sender owns the
+// name given in the key. ownsName may be nil.
+func (r *MatchRule) MatchesOwner(msg *Message, ownsName func(sender, name string) bool) bool {
+	if r.Type != 0 && msg.Type != r.Type {
+		return false
+	}
+	if r.Sender != "" {
+		sender, _ := msg.Headers[FieldSender].value.(string)
+		if sender != r.Sender && (ownsName == nil || !ownsName(sender, r.Sender)) {
+			return false
+		}
+	}
+	if !matchHeader(msg, FieldInterface, r.Interface) ||
+		!matchHeader(msg, FieldMember, r.Member) ||
+		!matchHeader(msg, FieldDestination, r.Destination) {
+		return false
+	}
+	path, _ := msg.Headers[FieldPath].value.(ObjectPath)
+	if r.Path != "" && path != r.Path {
+		return false
+	}
+	if r.PathNamespace != "" && !isInPathNamespace(path, r.PathNamespace) {
+		return false
+	}
+	for n, v := range r.Args {
+		if n >= len(msg.Body) {
+			return false
+		}
+		if s, ok := msg.Body[n].(string); !ok || s != v {
+			return false
+		}
+	}
+	for n, v := range r.ArgPaths {
+		if n >= len(msg.Body) {
+			return false
+		}
+		var s string
+		switch arg := msg.Body[n].(type) {
+		case string:
+			s = arg
+		case ObjectPath:
+			s = string(arg)
+		default:
+			return false
+		}
+		if s != v &&
+			!(strings.HasSuffix(v, "/") && strings.HasPrefix(s, v)) &&
+			!(strings.HasSuffix(s, "/") && strings.HasPrefix(v, s)) {
+			return false
+		}
+	}
+	if r.Arg0Namespace != "" {
+		if len(msg.Body) == 0 {
+			return false
+		}
+		s, ok := msg.Body[0].(string)
+		if !ok || (s != r.Arg0Namespace && !strings.HasPrefix(s, r.Arg0Namespace+".")) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchHeader returns whether the string header field of msg equals want or
+// want is empty.
+func matchHeader(msg *Message, field HeaderField, want string) bool {
+	if want == "" {
+		return true
+	}
+	s, _ := msg.Headers[field].value.(string)
+	return s == want
+}
+
+// isInPathNamespace returns whether path is equal to ns or below it.
+func isInPathNamespace(path, ns ObjectPath) bool {
+	return ns == "/" || path == ns || strings.HasPrefix(string(path), string(ns)+"/")
+}
+
+// isValidBusName returns whether s is a valid unique or well-known bus name.
+func isValidBusName(s string) bool {
+	if len(s) == 0 || len(s) > 255 {
+		return false
+	}
+	unique := s[0] == ':'
+	if unique {
+		s = s[1:]
+	}
+	elems := strings.Split(s, ".")
+	if len(elems) < 2 {
+		return false
+	}
+	for _, e := range elems {
+		if !isValidNameElement(e, unique) {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidNamespace returns whether s is a valid value for arg0namespace, that
+// is a well-known bus name that may consist of a single element.
+func isValidNamespace(s string) bool {
+	if len(s) == 0 || len(s) > 255 {
+		return false
+	}
+	for _, e := range strings.Split(s, ".") {
+		if !isValidNameElement(e, false) {
+			return false
+		}
+	}
+	return true
+}
+
+func isValidNameElement(e string, unique bool) bool {
+	if len(e) == 0 || (!unique && e[0] >= '0' && e[0] <= '9') {
+		return false
+	}
+	for _, c := range e {
+		if !isMemberChar(c) && c != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -1,6 +1,9 @@
 package dbus
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestFormatMatchOptions(t *testing.T) {
 	opts := []MatchOption{
@@ -17,3 +20,149 @@ func TestFormatMatchOptions(t *testing.T) {
 		t.Fatalf("formatMatchOptions(%v) = %q, want %q", opts, have, want)
 	}
 }
+
+func TestParseMatchRule(t *testing.T) {
+	rule := "type='signal',sender='org.freedesktop.DBus',interface='org.freedesktop.DBus'," +
+		"member='NameOwnerChanged',path_namespace='/org',arg0='it'\\''s',arg2path='/a/'," +
+		"arg0namespace='org.example',eavesdrop='true'"
+	r, err := ParseMatchRule(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &MatchRule{
+		Type:          TypeSignal,
+		Sender:        "org.freedesktop.DBus",
+		Interface:     "org.freedesktop.DBus",
+		Member:        "NameOwnerChanged",
+		PathNamespace: "/org",
+		Args:          map[int]string{0: "it's"},
+		ArgPaths:      map[int]string{2: "/a/"},
+		Arg0Namespace: "org.example",
+		Eavesdrop:     true,
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("ParseMatchRule(%q) = %+v, want %+v", rule, r, want)
+	}
+	if r2, err := ParseMatchRule(r.String()); err != nil || !reflect.DeepEqual(r2, r) {
+		t.Errorf("ParseMatchRule(%q) = %+v, %v, want %+v", r.String(), r2, err, r)
+	}
+
+	for _, rule := range []string{
+		"type='foo'",
+		"sender='org.bluez',sender='org.bluez'",
+		"path='/a',path_namespace='/a'",
+		"interface='noDots'",
+		"member='a.b'",
+		"arg64='x'",
+		"arg01='x'",
+		"unknown='x'",
+		"eavesdrop='yes'",
+		"member='Foo",
+		"member",
+	} {
+		if _, err := ParseMatchRule(rule); err == nil {
+			t.Errorf("ParseMatchRule(%q) succeeded, want error", rule)
+		}
+	}
+}
+
+func TestMatchRuleMatches(t *testing.T) {
+	msg := &Message{
+		Type: TypeSignal,
+		Headers: map[HeaderField]Variant{
+			FieldSender:    MakeVariant(":1.42"),
+			FieldPath:      MakeVariant(ObjectPath("/org/example/obj")),
+			FieldInterface: MakeVariant("org.example.Iface"),
+			FieldMember:    MakeVariant("Changed"),
+		},
+		Body: []interface{}{"org.example.Name", ObjectPath("/org/example/obj"), uint32(1)},
+	}
+	for _, tc := range []struct {
+		rule string
+		want bool
+	}{
+		{"", true},
+		{"type='signal'", true},
+		{"type='method_call'", false},
+		{"sender=':1.42'", true},
+		{"sender='org.example'", false},
+		{"interface='org.example.Iface',member='Changed'", true},
+		{"member='Other'", false},
+		{"path='/org/example/obj'", true},
+		{"path='/org/example'", false},
+		{"path_namespace='/org/example'", true},
+		{"path_namespace='/org/ex'", false},
+		{"path_namespace='/'", true},
+		{"destination=':1.1'", false},
+		{"arg0='org.example.Name'", true},
+		{"arg0='org.example'", false},
+		{"arg1='/org/example/obj'", false},
+		{"arg2='1'", false},
+		{"arg3='x'", false},
+		{"arg1path='/org/example/'", true},
+		{"arg1path='/org/example/obj/child'", false},
+		{"arg0path='org.example.Name'", true},
+		{"arg0namespace='org.example'", true},
+		{"arg0namespace='org.ex'", false},
+	} {
+		r, err := ParseMatchRule(tc.rule)
+		if err != nil {
+			t.Fatalf("ParseMatchRule(%q): %v", tc.rule, err)
+		}
+		if got := r.Matches(msg); got != tc.want {
+			t.Errorf("%q matches = %v, want %v", tc.rule, got, tc.want)
+		}
+	}
+
+	r := &MatchRule{Sender: "org.example"}
+	owns := func(sender, name string) bool {
+		return sender == ":1.42" && name == "org.example"
+	}
+	if !r.MatchesOwner(msg, owns) {
+		t.Error("MatchesOwner doesn't consult ownsName")
+	}
+}
+
+func TestArgMatchOptions(t *testing.T) {
+	opts := []MatchOption{
+		WithMatchArg(0, "it's"),
+		WithMatchArg(63, "x"),
+		WithMatchArgPath(1, "/org/example/"),
+		WithMatchArg0Namespace("org.example"),
+	}
+	want := `arg0='it'\''s',arg63='x',arg1path='/org/example/',arg0namespace='org.example'`
+	have := formatMatchOptions(opts)
+	if have != want {
+		t.Fatalf("formatMatchOptions(%v) = %q, want %q", opts, have, want)
+	}
+	r, err := ParseMatchRule(have)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Args[0] != "it's" || r.Args[63] != "x" || r.ArgPaths[1] != "/org/example/" ||
+		r.Arg0Namespace != "org.example" {
+		t.Errorf("ParseMatchRule(%q) = %+v", have, r)
+	}
+
+	for _, opts := range [][]MatchOption{
+		{WithMatchArg(-1, "x")},
+		{WithMatchArg(64, "x")},
+		{WithMatchArgPath(64, "/")},
+		{WithMatchArg0Namespace("org..example")},
+		{WithMatchSender("org.bluez"), WithMatchSender("org.bluez")},
+		{WithMatchObjectPath("/a"), WithMatchPathNamespace("/a")},
+	} {
+		if _, err := newMatchRule(opts, false); err == nil {
+			t.Errorf("newMatchRule(%v) succeeded, want error", opts)
+		}
+	}
+
+	// Unknown keys are passed on to the bus, but can't be matched locally.
+	opts = []MatchOption{WithMatchMember("Foo"), WithMatchOption("x_custom", "y")}
+	if r, err := newMatchRule(opts, false); err != nil || r.Member != "Foo" {
+		t.Errorf("newMatchRule(%v) = %v, %v", opts, r, err)
+	}
+	if _, err := newMatchRule(opts, true); err == nil {
+		t.Errorf("strict newMatchRule(%v) succeeded, want error", opts)
+	}
+}
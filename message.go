@@ -111,6 +111,10 @@ type Message struct {
 	Body    []interface{}
 
 	serial uint32
+
+	// fds are the unix fds received with the message that are still owned
+	// by it.
+	fds []int
 }
 
 type header struct {
@@ -123,6 +127,13 @@ type header struct {
 // The possibly returned error can be an error of the underlying reader, an
 // InvalidMessageError or a FormatError.
 func DecodeMessage(rd io.Reader) (msg *Message, err error) {
+	return decodeMessageWithFDs(rd, nil)
+}
+
+// decodeMessageWithFDs acts like DecodeMessage, but if fds is not nil, the
+// UNIX_FD values in the body, wherever they are nested, are resolved to the
+// given fds that were received with the message.
+func decodeMessageWithFDs(rd io.Reader, fds []int) (msg *Message, err error) {
 	var order binary.ByteOrder
 	var hlength, length uint32
 	var typ, flags, proto byte
@@ -197,22 +208,41 @@ func DecodeMessage(rd io.Reader) (msg *Message, err error) {
 	if sig.str != "" {
 		buf := bytes.NewBuffer(body)
 		dec = newDecoder(buf, order)
+		dec.fds = fds
 		vs, err := dec.Decode(sig)
 		if err != nil {
 			return nil, err
 		}
 		msg.Body = vs
 	}
+	msg.fds = fds
 
 	return
 }
 
 // EncodeTo encodes and sends a message to the given writer. The byte order must
 // be either binary.LittleEndian or binary.BigEndian. If the message is not
-// valid or an error occurs when writing, an error is returned.
+// valid or an error occurs when writing, an error is returned. UnixFD values
+// are encoded as their plain value, as the file descriptors can only be passed
+// by a connection.
 func (msg *Message) EncodeTo(out io.Writer, order binary.ByteOrder) error {
+	_, err := msg.encode(out, order, false)
+	return err
+}
+
+// encodeWithFDs acts like EncodeTo, but returns the unix fds of the UnixFD
+// values in the body, wherever they are nested, which are encoded as their
+// indices. If there are any, the UnixFDs header field is written with the
+// message; msg itself is left unchanged.
+func (msg *Message) encodeWithFDs(out io.Writer, order binary.ByteOrder) ([]int, error) {
+	return msg.encode(out, order, true)
+}
+
+// encode encodes msg to out. If passFDs is set, UnixFD values are encoded as
+// described for encodeWithFDs.
+func (msg *Message) encode(out io.Writer, order binary.ByteOrder, passFDs bool) ([]int, error) {
 	if err := msg.IsValid(); err != nil {
-		return err
+		return nil, err
 	}
 	var vs [7]interface{}
 	switch order {
@@ -221,35 +251,47 @@ func (msg *Message) EncodeTo(out io.Writer, order binary.ByteOrder) error {
 	case binary.BigEndian:
 		vs[0] = byte('B')
 	default:
-		return errors.New("dbus: invalid byte order")
+		return nil, errors.New("dbus: invalid byte order")
 	}
 	body := new(bytes.Buffer)
 	enc := newEncoder(body, order)
+	enc.passFDs = passFDs
 	if len(msg.Body) != 0 {
-		enc.Encode(msg.Body...)
+		if err := enc.Encode(msg.Body...); err != nil {
+			return nil, err
+		}
 	}
+	fds := enc.fds
 	vs[1] = msg.Type
 	vs[2] = msg.Flags
 	vs[3] = protoVersion
 	vs[4] = uint32(len(body.Bytes()))
 	vs[5] = msg.serial
-	headers := make([]header, 0, len(msg.Headers))
+	headers := make([]header, 0, len(msg.Headers)+1)
 	for k, v := range msg.Headers {
+		if k == FieldUnixFDs && passFDs {
+			continue
+		}
 		headers = append(headers, header{byte(k), v})
 	}
+	if len(fds) != 0 {
+		headers = append(headers, header{byte(FieldUnixFDs), MakeVariant(uint32(len(fds)))})
+	}
 	vs[6] = headers
 	var buf bytes.Buffer
 	enc = newEncoder(&buf, order)
-	enc.Encode(vs[:]...)
+	if err := enc.Encode(vs[:]...); err != nil {
+		return nil, err
+	}
 	enc.align(8)
 	body.WriteTo(&buf)
 	if buf.Len() > 1<<27 {
-		return InvalidMessageError("message is too long")
+		return nil, InvalidMessageError("message is too long")
 	}
 	if _, err := buf.WriteTo(out); err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return fds, nil
 }
 
 // IsValid checks whether msg is a valid message and returns an
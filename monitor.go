@@ -0,0 +1,136 @@
+package dbus
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrMonitor is the error returned when sending messages on a connection that
+// has become a monitor.
+var ErrMonitor = errors.New("dbus: connection is a monitor")
+
+// monitor is the state of a connection that becomes a monitor.
+type monitor struct {
+	ch     chan<- *Message
+	serial uint32
+
+	// active is set by inWorker once the bus has accepted BecomeMonitor.
+	active bool
+}
+
+// BecomeMonitor turns conn into a monitor connection by calling
+// org.freedesktop.DBus.Monitoring.BecomeMonitor, which replaces the
+// deprecated eavesdropping. Afterwards, every message on the bus that matches
+// at least one of the given match rules is sent to ch, including method
+// calls, replies and errors that are addressed to other connections. If no
+// rules are given, all messages are sent to ch. The rules must be valid as
+// described by ParseMatchRule.
+//
+// A monitor is read-only: the bus disconnects monitors that send messages, so
+// all further attempts to send on conn fail with ErrMonitor. Method calls,
+// signals and replies addressed to conn itself are no longer processed either;
+// they are sent to ch like all other messages. The bus releases the names
+// owned by conn and sends the NameLost signals for them, including the one for
+// the unique name, to ch regardless of the rules.
+//
+// Unlike Eavesdrop, no messages are discarded; the connection stops reading
+// from the bus while ch is full. ch is closed when conn is closed, for example
+// because the bus closed the connection. BecomeMonitor must not be called on
+// shared connections.
+func (conn *Conn) BecomeMonitor(ch chan<- *Message, rules ...string) error {
+	return conn.BecomeMonitorWithContext(context.Background(), ch, rules...)
+}
+
+// BecomeMonitorWithContext acts like BecomeMonitor but takes a context for
+// the call to BecomeMonitor.
+func (conn *Conn) BecomeMonitorWithContext(ctx context.Context, ch chan<- *Message, rules ...string) error {
+	for _, rule := range rules {
+		if _, err := ParseMatchRule(rule); err != nil {
+			return err
+		}
+	}
+	if rules == nil {
+		rules = []string{}
+	}
+
+	msg := new(Message)
+	msg.Type = TypeMethodCall
+	msg.Headers = map[HeaderField]Variant{
+		FieldPath:        MakeVariant(ObjectPath("/org/freedesktop/DBus")),
+		FieldDestination: MakeVariant("org.freedesktop.DBus"),
+		FieldInterface:   MakeVariant("org.freedesktop.DBus.Monitoring"),
+		FieldMember:      MakeVariant("BecomeMonitor"),
+		FieldSignature:   MakeVariant(SignatureOf(rules, uint32(0))),
+	}
+	msg.Body = []interface{}{rules, uint32(0)}
+
+	// The serial of the call has to be known to inWorker before the reply
+	// arrives, because every message read after the reply belongs to the
+	// monitor.
+	m := &monitor{ch: ch, serial: conn.getSerial()}
+	conn.monitorLck.Lock()
+	if conn.monitor != nil {
+		conn.monitorLck.Unlock()
+		return errors.New("dbus: connection is already becoming a monitor")
+	}
+	conn.monitor = m
+	conn.monitorLck.Unlock()
+
+	call := <-conn.sendWithSerial(ctx, msg, nil, m.serial).Done
+	err := call.Err
+	if err != nil {
+		conn.monitorLck.Lock()
+		if conn.monitor == m {
+			conn.monitor = nil
+		}
+		conn.monitorLck.Unlock()
+	}
+	return err
+}
+
+// monitorMessage sends msg to the monitor channel if conn is a monitor and
+// reports whether it did. It activates the monitor when the reply to
+// BecomeMonitor is read.
+func (conn *Conn) monitorMessage(msg *Message) bool {
+	conn.monitorLck.Lock()
+	defer conn.monitorLck.Unlock()
+	m := conn.monitor
+	if m == nil {
+		return false
+	}
+	if m.active && conn.ctx.Err() != nil {
+		// conn is closed, and so is the channel.
+		return true
+	}
+	if !m.active {
+		if msg.Type == TypeMethodReply {
+			if serial, _ := msg.Headers[FieldReplySerial].value.(uint32); serial == m.serial {
+				m.active = true
+				conn.outHandler.setReadOnly()
+			}
+		}
+		return false
+	}
+	select {
+	case m.ch <- msg:
+	case <-conn.ctx.Done():
+	}
+	return true
+}
+
+// isMonitor reports whether conn has become a monitor.
+func (conn *Conn) isMonitor() bool {
+	conn.monitorLck.Lock()
+	defer conn.monitorLck.Unlock()
+	return conn.monitor != nil && conn.monitor.active
+}
+
+// closeMonitor closes the monitor channel. It must be called after the
+// context of conn has been canceled.
+func (conn *Conn) closeMonitor() {
+	conn.monitorLck.Lock()
+	defer conn.monitorLck.Unlock()
+	if conn.monitor != nil && conn.monitor.active {
+		close(conn.monitor.ch)
+	}
+}
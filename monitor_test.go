@@ -0,0 +1,76 @@
+package dbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBecomeMonitor(t *testing.T) {
+	mon, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mon.Close()
+	bus, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	ch := make(chan *Message, 10)
+	if err := mon.BecomeMonitor(ch, "type='foo'"); err == nil {
+		t.Error("BecomeMonitor with invalid rule succeeded")
+	}
+	err = mon.BecomeMonitor(ch,
+		"type='signal',interface='org.example.Monitor'",
+		"type='method_call',interface='org.example.Monitor'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mon.Emit("/org/example", "org.example.Monitor.Signal"); err != ErrMonitor {
+		t.Errorf("Emit on monitor: got %v, want ErrMonitor", err)
+	}
+	if call := mon.BusObject().Call("org.freedesktop.DBus.GetId", 0); call.Err != ErrMonitor {
+		t.Errorf("Call on monitor: got %v, want ErrMonitor", call.Err)
+	}
+
+	if err := bus.Emit("/org/example", "org.example.Other.Signal"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Emit("/org/example", "org.example.Monitor.Signal", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	bus.Object(bus.Names()[0], "/org/example").Call("org.example.Monitor.Method", FlagNoReplyExpected)
+
+	for _, want := range []struct {
+		typ    Type
+		member string
+	}{
+		{TypeSignal, "Signal"},
+		{TypeMethodCall, "Method"},
+	} {
+		var msg *Message
+		for msg == nil {
+			select {
+			case m := <-ch:
+				// The bus also sends the NameLost signal for the
+				// unique name of the monitor.
+				if m.Headers[FieldInterface].value == "org.example.Monitor" {
+					msg = m
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %s", want.member)
+			}
+		}
+		if msg.Type != want.typ || msg.Headers[FieldMember].value != want.member {
+			t.Errorf("got %v, want %v %s", msg, want.typ, want.member)
+		}
+		if want.typ == TypeSignal && (len(msg.Body) != 1 || msg.Body[0] != "foo") {
+			t.Errorf("got body %v, want [foo]", msg.Body)
+		}
+	}
+
+	mon.Close()
+	for range ch {
+	}
+}
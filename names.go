@@ -0,0 +1,200 @@
+package dbus
+
+import (
+	"context"
+	"errors"
+)
+
+// NameWatcher reports changes of the owner of a bus name. It is created by
+// WatchName.
+type NameWatcher struct {
+	conn *Conn
+	name string
+	sub  *Subscription
+}
+
+// WatchName watches the owner of the given bus name, like g_bus_watch_name
+// does. onAppeared is called with the unique name of the owner whenever the
+// name gets an owner and onVanished whenever it loses it; if the name passes
+// directly from one owner to another, onVanished is called before
+// onAppeared. Either callback may be nil.
+//
+// Exactly one of the callbacks is called with the initial state of the name,
+// followed by the transitions in the order in which they happened. The
+// sequence passed to the callbacks is that of the message that announced the
+// transition and can be compared to those of other messages received on
+// conn. The callbacks are called from a single goroutine.
+//
+// If the connection is reestablished (see WithReconnect), the owner is
+// queried again and a change that happened in the meantime is reported with
+// the sequence of the reply.
+func (conn *Conn) WatchName(name string, onAppeared func(name, owner string, sequence Sequence),
+	onVanished func(name string, sequence Sequence)) (*NameWatcher, error) {
+	sub, err := conn.Subscribe(context.Background(),
+		WithMatchSender("org.freedesktop.DBus"),
+		WithMatchInterface("org.freedesktop.DBus"),
+		WithMatchMember("NameOwnerChanged"),
+		WithMatchArg(0, name),
+	)
+	if err != nil {
+		return nil, err
+	}
+	w := &NameWatcher{conn: conn, name: name, sub: sub}
+	// The watcher is registered first, so that the owner is queried again
+	// if the connection is reestablished before the initial reply arrives.
+	conn.names.addWatcher(w)
+	owner, sequence, err := w.getOwner()
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	go func() {
+		if owner != "" {
+			if onAppeared != nil {
+				onAppeared(name, owner, sequence)
+			}
+		} else if onVanished != nil {
+			onVanished(name, sequence)
+		}
+		for sig := range sub.C {
+			var changedName, oldOwner, newOwner string
+			if sig.Sequence < sequence ||
+				Store(sig.Body, &changedName, &oldOwner, &newOwner) != nil ||
+				changedName != name {
+				// already reflected by a later reply to GetNameOwner
+				continue
+			}
+			sequence = sig.Sequence
+			if newOwner == owner {
+				continue
+			}
+			if owner != "" && onVanished != nil {
+				onVanished(name, sig.Sequence)
+			}
+			owner = newOwner
+			if owner != "" && onAppeared != nil {
+				onAppeared(name, owner, sig.Sequence)
+			}
+		}
+	}()
+	return w, nil
+}
+
+// getOwner returns the current owner of the name, or "" if it has none, and
+// the sequence of the reply that it was learned from.
+func (w *NameWatcher) getOwner() (string, Sequence, error) {
+	var owner string
+	call := w.conn.busObj.Call("org.freedesktop.DBus.GetNameOwner", 0, w.name)
+	if err := call.Store(&owner); err != nil {
+		if e, ok := err.(Error); !ok || e.Name != "org.freedesktop.DBus.Error.NameHasNoOwner" {
+			return "", NoSequence, err
+		}
+	}
+	return owner, call.ResponseSequence, nil
+}
+
+// refresh queries the owner of the name after the connection was
+// reestablished and reports it to the watcher like a NameOwnerChanged signal,
+// as signals sent while the connection was lost were missed.
+func (w *NameWatcher) refresh() error {
+	owner, sequence, err := w.getOwner()
+	if err != nil {
+		return err
+	}
+	w.sub.queue.deliver(&Signal{
+		Sender:   "org.freedesktop.DBus",
+		Path:     "/org/freedesktop/DBus",
+		Name:     "org.freedesktop.DBus.NameOwnerChanged",
+		Body:     []interface{}{w.name, "", owner},
+		Sequence: sequence,
+	})
+	return nil
+}
+
+// Close stops watching the name. The report of a transition that is in
+// progress when Close is called may still complete.
+func (w *NameWatcher) Close() error {
+	w.conn.names.removeWatcher(w)
+	return w.sub.Close()
+}
+
+// NameOwner requests a well-known name on the bus and reports when it is
+// acquired and lost. It is created by OwnName.
+type NameOwner struct {
+	conn  *Conn
+	name  string
+	queue *signalQueue
+}
+
+// OwnName requests the given well-known name with flags, like
+// g_bus_own_name does, and keeps reporting changes of its ownership until
+// Close is called. onAcquired is called whenever conn becomes the primary
+// owner of the name, including when it moves up to the head of the queue or
+// regains the name after the connection was reestablished (see
+// WithReconnect). onLost is called whenever conn stops being the primary
+// owner, for example because another connection replaced it, and also if the
+// name couldn't be acquired and NameFlagDoNotQueue was given. Either callback
+// may be nil; they are called from a single goroutine, in order.
+//
+// Only one NameOwner can exist for a name on each connection.
+func (conn *Conn) OwnName(name string, flags RequestNameFlags, onAcquired, onLost func(name string)) (*NameOwner, error) {
+	o := &NameOwner{conn: conn, name: name, queue: newSignalQueue()}
+	if !conn.names.addOwner(o) {
+		o.queue.close()
+		return nil, errors.New("dbus: name " + name + " is already owned with OwnName")
+	}
+	go func() {
+		for sig := range o.queue.ch {
+			switch sig.Name {
+			case "org.freedesktop.DBus.NameAcquired":
+				if onAcquired != nil {
+					onAcquired(name)
+				}
+			case "org.freedesktop.DBus.NameLost":
+				if onLost != nil {
+					onLost(name)
+				}
+			}
+		}
+	}()
+
+	// NameAcquired and NameLost are delivered to o as soon as it was added,
+	// so they aren't reported here.
+	reply, err := conn.RequestName(name, flags)
+	if err != nil {
+		o.Close()
+		return nil, err
+	}
+	switch reply {
+	case RequestNameReplyExists:
+		o.queue.deliver(nameLostSignal(name))
+	case RequestNameReplyAlreadyOwner:
+		o.queue.deliver(&Signal{
+			Sender: "org.freedesktop.DBus",
+			Path:   "/org/freedesktop/DBus",
+			Name:   "org.freedesktop.DBus.NameAcquired",
+			Body:   []interface{}{name},
+		})
+	}
+	return o, nil
+}
+
+// Close releases the name and stops reporting changes of its ownership.
+func (o *NameOwner) Close() error {
+	o.conn.names.removeOwner(o)
+	o.queue.close()
+	_, err := o.conn.ReleaseName(o.name)
+	return err
+}
+
+// nameLostSignal returns a NameLost signal for name that is reported to a
+// NameOwner without being received from the bus.
+func nameLostSignal(name string) *Signal {
+	return &Signal{
+		Sender: "org.freedesktop.DBus",
+		Path:   "/org/freedesktop/DBus",
+		Name:   "org.freedesktop.DBus.NameLost",
+		Body:   []interface{}{name},
+	}
+}
@@ -0,0 +1,146 @@
+package dbus
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestWatchName(t *testing.T) {
+	conn, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	srv1, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv1.Close()
+	srv2, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv2.Close()
+
+	const name = "org.godbus.DBus.WatchNameTest"
+	events := make(chan string, 10)
+	var last Sequence
+	w, err := conn.WatchName(name, func(n, owner string, seq Sequence) {
+		if seq < last {
+			t.Errorf("sequence %d after %d", seq, last)
+		}
+		last = seq
+		events <- "appeared " + owner
+	}, func(n string, seq Sequence) {
+		if seq < last {
+			t.Errorf("sequence %d after %d", seq, last)
+		}
+		last = seq
+		events <- "vanished"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case ev := <-events:
+			if ev != want {
+				t.Fatalf("got %q, want %q", ev, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	expect("vanished")
+
+	if _, err = srv1.RequestName(name, NameFlagAllowReplacement); err != nil {
+		t.Fatal(err)
+	}
+	expect("appeared " + srv1.Names()[0])
+	if _, err = srv2.RequestName(name, NameFlagReplaceExisting|NameFlagDoNotQueue); err != nil {
+		t.Fatal(err)
+	}
+	expect("vanished")
+	expect("appeared " + srv2.Names()[0])
+	if _, err = srv2.ReleaseName(name); err != nil {
+		t.Fatal(err)
+	}
+	expect("vanished")
+}
+
+func TestOwnName(t *testing.T) {
+	conn1, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn1.Close()
+	conn2, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+
+	const name = "org.godbus.DBus.OwnNameTest"
+	events := make(chan string, 10)
+	callbacks := func(id string) (func(string), func(string)) {
+		return func(string) { events <- id + " acquired" },
+			func(string) { events <- id + " lost" }
+	}
+	// Events of different connections may arrive in any order.
+	expect := func(want ...string) {
+		t.Helper()
+		var got []string
+		for range want {
+			select {
+			case ev := <-events:
+				got = append(got, ev)
+			case <-time.After(time.Second):
+				t.Fatalf("timed out waiting for %q", want)
+			}
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+
+	acquired, lost := callbacks("conn1")
+	o1, err := conn1.OwnName(name, NameFlagAllowReplacement, acquired, lost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o1.Close()
+	expect("conn1 acquired")
+	if _, err = conn1.OwnName(name, 0, nil, nil); err == nil {
+		t.Error("owning a name twice succeeded")
+	}
+
+	// conn2 takes over the name, conn1 stays in the queue.
+	acquired, lost = callbacks("conn2")
+	o2, err := conn2.OwnName(name, NameFlagReplaceExisting, acquired, lost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect("conn1 lost", "conn2 acquired")
+
+	// conn1 gets the name back once conn2 releases it.
+	if err = o2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expect("conn1 acquired")
+
+	// conn2 can't get the name without queueing.
+	acquired, lost = callbacks("conn2")
+	o2, err = conn2.OwnName(name, NameFlagDoNotQueue, acquired, lost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o2.Close()
+	expect("conn2 lost")
+}
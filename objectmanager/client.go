@@ -0,0 +1,278 @@
+package objectmanager
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/yaamai/dbus/v5"
+)
+
+// ClientHandlers contains the callbacks through which a Client reports
+// changes of the objects of a remote ObjectManager. Any of them may be nil.
+type ClientHandlers struct {
+	// ObjectAdded is called when an object appears, before InterfaceAdded
+	// is called for its interfaces.
+	ObjectAdded func(path dbus.ObjectPath)
+
+	// ObjectRemoved is called when an object disappears, after
+	// InterfaceRemoved was called for its interfaces.
+	ObjectRemoved func(path dbus.ObjectPath)
+
+	// InterfaceAdded is called when an interface is added to an object,
+	// with the initial values of its properties.
+	InterfaceAdded func(path dbus.ObjectPath, iface string, props map[string]dbus.Variant)
+
+	// InterfaceRemoved is called when an interface is removed from an
+	// object.
+	InterfaceRemoved func(path dbus.ObjectPath, iface string)
+
+	// PropertiesChanged is called when properties of an interface of an
+	// object changed. changed contains the new values of the properties
+	// and invalidated the names of those whose values weren't sent and
+	// which were therefore removed from the Client.
+	PropertiesChanged func(path dbus.ObjectPath, iface string, changed map[string]dbus.Variant, invalidated []string)
+}
+
+// Client mirrors the objects of a remote ObjectManager. It is safe for
+// concurrent use by multiple goroutines.
+//
+// The objects are loaded with GetManagedObjects when the Client is created
+// and kept up to date through the InterfacesAdded, InterfacesRemoved and
+// PropertiesChanged signals of the remote object.
+type Client struct {
+	mut     sync.RWMutex
+	objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+
+	obj      dbus.BusObject
+	sub      *dbus.Subscription
+	handlers ClientHandlers
+}
+
+// NewClient returns a new Client for the ObjectManager implemented by obj,
+// which must be an object on conn. The objects that exist at the time
+// NewClient returns are available from the Client right away; the callbacks
+// of handlers are only called for the changes that follow. The callbacks are
+// called from a single goroutine, in order, after the Client was updated.
+func NewClient(conn *dbus.Conn, obj dbus.BusObject, handlers ClientHandlers) (*Client, error) {
+	// A single subscription keeps the signals of the object manager and the
+	// properties of its objects in order.
+	sub, err := conn.Subscribe(context.Background(),
+		dbus.WithMatchSender(obj.Destination()),
+		dbus.WithMatchPathNamespace(obj.Path()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		obj:      obj,
+		sub:      sub,
+		handlers: handlers,
+	}
+	call := obj.Call(Interface+".GetManagedObjects", 0)
+	if err := call.Store(&c.objects); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	if c.objects == nil {
+		c.objects = make(map[dbus.ObjectPath]map[string]map[string]dbus.Variant)
+	}
+	go c.run(call.ResponseSequence)
+	return c, nil
+}
+
+// Close stops updating the Client. The objects that it contains at that time
+// stay available. The report of a change that is in progress when Close is
+// called may still complete.
+func (c *Client) Close() error {
+	return c.sub.Close()
+}
+
+// Objects returns the paths of all objects, in sorted order.
+func (c *Client) Objects() []dbus.ObjectPath {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	paths := make([]dbus.ObjectPath, 0, len(c.objects))
+	for path := range c.objects {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool { return paths[i] < paths[j] })
+	return paths
+}
+
+// Interfaces returns the names of the interfaces of the object at path, in
+// sorted order. It returns nil if there is no such object.
+func (c *Client) Interfaces(path dbus.ObjectPath) []string {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	ifaces, ok := c.objects[path]
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(ifaces))
+	for name := range ifaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Properties returns a copy of the properties of the given interface of the
+// object at path. The returned bool is false if the object doesn't have the
+// interface.
+func (c *Client) Properties(path dbus.ObjectPath, iface string) (map[string]dbus.Variant, bool) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	props, ok := c.objects[path][iface]
+	if !ok {
+		return nil, false
+	}
+	return copyProperties(props), true
+}
+
+// Property returns the value of the named property of the given interface of
+// the object at path. The returned bool is false if the property isn't known.
+func (c *Client) Property(path dbus.ObjectPath, iface, name string) (dbus.Variant, bool) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	v, ok := c.objects[path][iface][name]
+	return v, ok
+}
+
+// ManagedObjects returns a copy of all objects in the form that
+// GetManagedObjects returns them.
+func (c *Client) ManagedObjects() map[dbus.ObjectPath]map[string]map[string]dbus.Variant {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	objects := make(map[dbus.ObjectPath]map[string]map[string]dbus.Variant, len(c.objects))
+	for path, ifaces := range c.objects {
+		m := make(map[string]map[string]dbus.Variant, len(ifaces))
+		for name, props := range ifaces {
+			m[name] = copyProperties(props)
+		}
+		objects[path] = m
+	}
+	return objects
+}
+
+// run applies the signals received after the reply to GetManagedObjects,
+// which has the given sequence, until the subscription is closed.
+func (c *Client) run(sequence dbus.Sequence) {
+	for sig := range c.sub.C {
+		if sig.Sequence < sequence {
+			// already reflected by the reply to GetManagedObjects
+			continue
+		}
+		switch sig.Name {
+		case Interface + ".InterfacesAdded":
+			var path dbus.ObjectPath
+			var ifaces map[string]map[string]dbus.Variant
+			if sig.Path == c.obj.Path() && dbus.Store(sig.Body, &path, &ifaces) == nil {
+				c.interfacesAdded(path, ifaces)
+			}
+		case Interface + ".InterfacesRemoved":
+			var path dbus.ObjectPath
+			var ifaces []string
+			if sig.Path == c.obj.Path() && dbus.Store(sig.Body, &path, &ifaces) == nil {
+				c.interfacesRemoved(path, ifaces)
+			}
+		case propertiesInterface + ".PropertiesChanged":
+			var iface string
+			var changed map[string]dbus.Variant
+			var invalidated []string
+			if dbus.Store(sig.Body, &iface, &changed, &invalidated) == nil {
+				c.propertiesChanged(sig.Path, iface, changed, invalidated)
+			}
+		}
+	}
+}
+
+func (c *Client) interfacesAdded(path dbus.ObjectPath, ifaces map[string]map[string]dbus.Variant) {
+	c.mut.Lock()
+	obj, exists := c.objects[path]
+	if !exists {
+		obj = make(map[string]map[string]dbus.Variant, len(ifaces))
+		c.objects[path] = obj
+	}
+	for name, props := range ifaces {
+		obj[name] = props
+	}
+	c.mut.Unlock()
+
+	if !exists && c.handlers.ObjectAdded != nil {
+		c.handlers.ObjectAdded(path)
+	}
+	if c.handlers.InterfaceAdded != nil {
+		for _, name := range sortedKeys(ifaces) {
+			c.handlers.InterfaceAdded(path, name, copyProperties(ifaces[name]))
+		}
+	}
+}
+
+func (c *Client) interfacesRemoved(path dbus.ObjectPath, ifaces []string) {
+	c.mut.Lock()
+	obj, exists := c.objects[path]
+	if !exists {
+		c.mut.Unlock()
+		return
+	}
+	removed := make([]string, 0, len(ifaces))
+	for _, name := range ifaces {
+		if _, ok := obj[name]; ok {
+			delete(obj, name)
+			removed = append(removed, name)
+		}
+	}
+	gone := len(obj) == 0
+	if gone {
+		delete(c.objects, path)
+	}
+	c.mut.Unlock()
+
+	if c.handlers.InterfaceRemoved != nil {
+		for _, name := range removed {
+			c.handlers.InterfaceRemoved(path, name)
+		}
+	}
+	if gone && c.handlers.ObjectRemoved != nil {
+		c.handlers.ObjectRemoved(path)
+	}
+}
+
+func (c *Client) propertiesChanged(path dbus.ObjectPath, iface string, changed map[string]dbus.Variant, invalidated []string) {
+	c.mut.Lock()
+	props, ok := c.objects[path][iface]
+	if !ok {
+		// not an interface of a managed object
+		c.mut.Unlock()
+		return
+	}
+	for name, v := range changed {
+		props[name] = v
+	}
+	for _, name := range invalidated {
+		delete(props, name)
+	}
+	c.mut.Unlock()
+
+	if c.handlers.PropertiesChanged != nil {
+		c.handlers.PropertiesChanged(path, iface, changed, invalidated)
+	}
+}
+
+func copyProperties(props map[string]dbus.Variant) map[string]dbus.Variant {
+	m := make(map[string]dbus.Variant, len(props))
+	for k, v := range props {
+		m[k] = v
+	}
+	return m
+}
+
+func sortedKeys(m map[string]map[string]dbus.Variant) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,239 @@
+// Package objectmanager provides the ObjectManager struct which can be used to
+// implement org.freedesktop.DBus.ObjectManager.
+package objectmanager
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/yaamai/dbus/v5"
+	"github.com/yaamai/dbus/v5/introspect"
+	"github.com/yaamai/dbus/v5/prop"
+)
+
+// The name of the org.freedesktop.DBus.ObjectManager interface.
+const Interface = "org.freedesktop.DBus.ObjectManager"
+
+const propertiesInterface = "org.freedesktop.DBus.Properties"
+
+// The introspection data for the org.freedesktop.DBus.ObjectManager interface.
+var IntrospectData = introspect.Interface{
+	Name: Interface,
+	Methods: []introspect.Method{
+		{
+			Name: "GetManagedObjects",
+			Args: []introspect.Arg{
+				{Name: "objects", Type: "a{oa{sa{sv}}}", Direction: "out"},
+			},
+		},
+	},
+	Signals: []introspect.Signal{
+		{
+			Name: "InterfacesAdded",
+			Args: []introspect.Arg{
+				{Name: "object", Type: "o", Direction: "out"},
+				{Name: "interfaces", Type: "a{sa{sv}}", Direction: "out"},
+			},
+		},
+		{
+			Name: "InterfacesRemoved",
+			Args: []introspect.Arg{
+				{Name: "object", Type: "o", Direction: "out"},
+				{Name: "interfaces", Type: "as", Direction: "out"},
+			},
+		},
+	},
+}
+
+// The introspection data for the org.freedesktop.DBus.ObjectManager interface,
+// as a string.
+const IntrospectDataString = `
+	<interface name="org.freedesktop.DBus.ObjectManager">
+		<method name="GetManagedObjects">
+			<arg name="objects" direction="out" type="a{oa{sa{sv}}}"/>
+		</method>
+		<signal name="InterfacesAdded">
+			<arg name="object" type="o"/>
+			<arg name="interfaces" type="a{sa{sv}}"/>
+		</signal>
+		<signal name="InterfacesRemoved">
+			<arg name="object" type="o"/>
+			<arg name="interfaces" type="as"/>
+		</signal>
+	</interface>
+`
+
+// ObjectManager implements org.freedesktop.DBus.ObjectManager for the objects
+// that are exported beneath its root path on a connection. It is safe for
+// concurrent use by multiple goroutines.
+//
+// The ObjectManager learns about objects as their interfaces are exported and
+// unexported with Conn.Export and its variants, and emits InterfacesAdded and
+// InterfacesRemoved accordingly. The signals are emitted in order, but from a
+// separate goroutine, so they may follow shortly after Export returns. If a
+// *prop.Properties is exported on an object, for example with prop.Export, the
+// values of its properties are included in GetManagedObjects and
+// InterfacesAdded. Export the properties of an object before its other
+// interfaces, so that InterfacesAdded carries their values.
+type ObjectManager struct {
+	mut     sync.RWMutex
+	conn    *dbus.Conn
+	root    dbus.ObjectPath
+	objects map[dbus.ObjectPath]map[string]interface{}
+
+	// pending holds the signals that are yet to be emitted, in order, and
+	// emitting is set while a goroutine emits them.
+	pending  []signal
+	emitting bool
+}
+
+// signal is an InterfacesAdded or InterfacesRemoved signal.
+type signal struct {
+	member string
+	values []interface{}
+}
+
+// Export returns a new ObjectManager that manages the objects beneath root,
+// including those that are already exported, and exports it as
+// org.freedesktop.DBus.ObjectManager on root.
+func Export(conn *dbus.Conn, root dbus.ObjectPath) (*ObjectManager, error) {
+	m := &ObjectManager{
+		conn:    conn,
+		root:    root,
+		objects: make(map[dbus.ObjectPath]map[string]interface{}),
+	}
+	if err := conn.Export(m, root, Interface); err != nil {
+		return nil, err
+	}
+	conn.AddExportObserver(observer{m})
+	return m, nil
+}
+
+// Close stops managing the objects and unexports the ObjectManager. The
+// objects themselves stay exported.
+func (m *ObjectManager) Close() error {
+	m.conn.RemoveExportObserver(observer{m})
+	return m.conn.Export(nil, m.root, Interface)
+}
+
+// GetManagedObjects implements
+// org.freedesktop.DBus.ObjectManager.GetManagedObjects.
+func (m *ObjectManager) GetManagedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	objects := make(map[dbus.ObjectPath]map[string]map[string]dbus.Variant, len(m.objects))
+	for path, ifaces := range m.objects {
+		names := make([]string, 0, len(ifaces))
+		for name := range ifaces {
+			names = append(names, name)
+		}
+		objects[path] = interfaceProperties(ifaces, names)
+	}
+	return objects, nil
+}
+
+// manages returns whether path is beneath the root path of m.
+func (m *ObjectManager) manages(path dbus.ObjectPath) bool {
+	if m.root == "/" {
+		return path != "/"
+	}
+	return strings.HasPrefix(string(path), string(m.root)+"/")
+}
+
+func (m *ObjectManager) interfaceExported(path dbus.ObjectPath, iface string, v interface{}) {
+	if !m.manages(path) {
+		return
+	}
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	ifaces, ok := m.objects[path]
+	if !ok {
+		ifaces = make(map[string]interface{})
+		m.objects[path] = ifaces
+	}
+	_, replaced := ifaces[iface]
+	ifaces[iface] = v
+	if replaced {
+		return
+	}
+	m.queueSignal("InterfacesAdded", path, interfaceProperties(ifaces, []string{iface}))
+}
+
+func (m *ObjectManager) interfaceUnexported(path dbus.ObjectPath, iface string) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	ifaces, ok := m.objects[path]
+	if !ok {
+		return
+	}
+	if _, ok := ifaces[iface]; !ok {
+		return
+	}
+	delete(ifaces, iface)
+	if len(ifaces) == 0 {
+		delete(m.objects, path)
+	}
+	m.queueSignal("InterfacesRemoved", path, []string{iface})
+}
+
+// queueSignal queues a signal for emission. The observer methods are called
+// with the export lock of the connection held, so the signals are emitted by
+// a separate goroutine, in the order in which they were queued. m.mut must be
+// locked.
+func (m *ObjectManager) queueSignal(member string, values ...interface{}) {
+	m.pending = append(m.pending, signal{member, values})
+	if !m.emitting {
+		m.emitting = true
+		go m.emitSignals()
+	}
+}
+
+// emitSignals emits the queued signals until there are none left.
+func (m *ObjectManager) emitSignals() {
+	for {
+		m.mut.Lock()
+		if len(m.pending) == 0 {
+			m.emitting = false
+			m.mut.Unlock()
+			return
+		}
+		s := m.pending[0]
+		m.pending[0] = signal{}
+		m.pending = m.pending[1:]
+		m.mut.Unlock()
+		m.conn.Emit(m.root, Interface+"."+s.member, s.values...)
+	}
+}
+
+// interfaceProperties returns the properties of the named interfaces among
+// the interfaces of an object, as they are reported by GetManagedObjects and
+// InterfacesAdded.
+func interfaceProperties(ifaces map[string]interface{}, names []string) map[string]map[string]dbus.Variant {
+	props, _ := ifaces[propertiesInterface].(*prop.Properties)
+	m := make(map[string]map[string]dbus.Variant, len(names))
+	for _, name := range names {
+		var values map[string]dbus.Variant
+		if props != nil {
+			values, _ = props.GetAll(name)
+		}
+		if values == nil {
+			values = make(map[string]dbus.Variant)
+		}
+		m[name] = values
+	}
+	return m
+}
+
+// observer passes the exports and unexports on the connection on to an
+// ObjectManager, without adding the notification methods to its API.
+type observer struct {
+	m *ObjectManager
+}
+
+func (o observer) InterfaceExported(path dbus.ObjectPath, iface string, v interface{}) {
+	o.m.interfaceExported(path, iface, v)
+}
+
+func (o observer) InterfaceUnexported(path dbus.ObjectPath, iface string) {
+	o.m.interfaceUnexported(path, iface)
+}
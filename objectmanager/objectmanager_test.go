@@ -0,0 +1,225 @@
+package objectmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yaamai/dbus/v5"
+	"github.com/yaamai/dbus/v5/prop"
+)
+
+type device struct{}
+
+func (device) Reset() *dbus.Error {
+	return nil
+}
+
+func TestObjectManager(t *testing.T) {
+	srv, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	client, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Objects that already exist are managed as well.
+	if err := srv.Export(device{}, "/org/godbus/om/existing", "org.godbus.Device"); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Export(srv, "/org/godbus/om")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	sub, err := client.Subscribe(context.Background(),
+		dbus.WithMatchSender(srv.Names()[0]),
+		dbus.WithMatchInterface(Interface),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	const path = dbus.ObjectPath("/org/godbus/om/dev0")
+	_, err = prop.Export(srv, path, map[string]map[string]*prop.Prop{
+		"org.godbus.Device": {"Name": {Value: "dev0"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Export(device{}, path, "org.godbus.Device"); err != nil {
+		t.Fatal(err)
+	}
+	// Objects outside of the root path aren't managed.
+	if err := srv.Export(device{}, "/org/godbus/other", "org.godbus.Device"); err != nil {
+		t.Fatal(err)
+	}
+
+	next := func() *dbus.Signal {
+		for {
+			select {
+			case sig := <-sub.C:
+				// The signal for the existing object is emitted
+				// asynchronously and may arrive after subscribing.
+				if len(sig.Body) != 0 && sig.Body[0] == dbus.ObjectPath("/org/godbus/om/existing") {
+					continue
+				}
+				return sig
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for signal")
+			}
+			return nil
+		}
+	}
+	var (
+		object dbus.ObjectPath
+		added  map[string]map[string]dbus.Variant
+	)
+	for _, want := range []string{"org.freedesktop.DBus.Properties", "org.godbus.Device"} {
+		sig := next()
+		added = nil
+		if sig.Name != Interface+".InterfacesAdded" {
+			t.Fatalf("got signal %s, want InterfacesAdded", sig.Name)
+		}
+		if err := dbus.Store(sig.Body, &object, &added); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := added[want]; object != path || len(added) != 1 || !ok {
+			t.Fatalf("got InterfacesAdded %s %v, want %s", object, added, want)
+		}
+	}
+	if v := added["org.godbus.Device"]["Name"].Value(); v != "dev0" {
+		t.Errorf("InterfacesAdded reported Name = %v, want dev0", v)
+	}
+
+	var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	err = client.Object(srv.Names()[0], "/org/godbus/om").
+		Call(Interface+".GetManagedObjects", 0).Store(&objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("GetManagedObjects returned %v", objects)
+	}
+	if _, ok := objects["/org/godbus/om/existing"]["org.godbus.Device"]; !ok {
+		t.Errorf("GetManagedObjects is missing the existing object: %v", objects)
+	}
+	if v := objects[path]["org.godbus.Device"]["Name"].Value(); v != "dev0" {
+		t.Errorf("GetManagedObjects reported Name = %v, want dev0", v)
+	}
+
+	if err := srv.Export(nil, path, "org.godbus.Device"); err != nil {
+		t.Fatal(err)
+	}
+	sig := next()
+	var removed []string
+	if err := dbus.Store(sig.Body, &object, &removed); err != nil {
+		t.Fatal(err)
+	}
+	if sig.Name != Interface+".InterfacesRemoved" || object != path ||
+		len(removed) != 1 || removed[0] != "org.godbus.Device" {
+		t.Errorf("got %s %v, want InterfacesRemoved of org.godbus.Device", sig.Name, sig.Body)
+	}
+}
+
+func TestClient(t *testing.T) {
+	srv, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	m, err := Export(srv, "/org/godbus/om")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	props, err := prop.Export(srv, "/org/godbus/om/dev0", map[string]map[string]*prop.Prop{
+		"org.godbus.Device": {"Name": {Value: "dev0", Emit: prop.EmitTrue}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Export(device{}, "/org/godbus/om/dev0", "org.godbus.Device"); err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan string, 10)
+	c, err := NewClient(conn, conn.Object(srv.Names()[0], "/org/godbus/om"), ClientHandlers{
+		ObjectAdded: func(path dbus.ObjectPath) {
+			events <- "object added " + string(path)
+		},
+		ObjectRemoved: func(path dbus.ObjectPath) {
+			events <- "object removed " + string(path)
+		},
+		InterfaceAdded: func(path dbus.ObjectPath, iface string, props map[string]dbus.Variant) {
+			events <- "interface added " + string(path) + " " + iface
+		},
+		InterfaceRemoved: func(path dbus.ObjectPath, iface string) {
+			events <- "interface removed " + string(path) + " " + iface
+		},
+		PropertiesChanged: func(path dbus.ObjectPath, iface string, changed map[string]dbus.Variant, invalidated []string) {
+			events <- "properties changed " + string(path) + " " + iface
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if v, ok := c.Property("/org/godbus/om/dev0", "org.godbus.Device", "Name"); !ok || v.Value() != "dev0" {
+		t.Errorf("Property returned %v, %v", v, ok)
+	}
+	expect := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got := <-events:
+				if got != w {
+					t.Fatalf("got %q, want %q", got, w)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %q", w)
+			}
+		}
+	}
+
+	props.SetMust("org.godbus.Device", "Name", "renamed")
+	expect("properties changed /org/godbus/om/dev0 org.godbus.Device")
+	if v, _ := c.Property("/org/godbus/om/dev0", "org.godbus.Device", "Name"); v.Value() != "renamed" {
+		t.Errorf("Name wasn't updated: %v", v)
+	}
+
+	if err := srv.Export(device{}, "/org/godbus/om/dev1", "org.godbus.Device"); err != nil {
+		t.Fatal(err)
+	}
+	expect(
+		"object added /org/godbus/om/dev1",
+		"interface added /org/godbus/om/dev1 org.godbus.Device",
+	)
+	if err := srv.Export(nil, "/org/godbus/om/dev1", "org.godbus.Device"); err != nil {
+		t.Fatal(err)
+	}
+	expect(
+		"interface removed /org/godbus/om/dev1 org.godbus.Device",
+		"object removed /org/godbus/om/dev1",
+	)
+	if paths := c.Objects(); len(paths) != 1 || paths[0] != "/org/godbus/om/dev0" {
+		t.Errorf("Objects returned %v", paths)
+	}
+	ifaces := c.Interfaces("/org/godbus/om/dev0")
+	if len(ifaces) != 2 || ifaces[0] != "org.freedesktop.DBus.Properties" || ifaces[1] != "org.godbus.Device" {
+		t.Errorf("Interfaces returned %v", ifaces)
+	}
+}
@@ -0,0 +1,181 @@
+// Package pcap reads and writes D-Bus messages in the pcap capture file format
+// with the link type DLT_DBUS, as written by dbus-monitor --pcap and busctl
+// capture and understood by Wireshark.
+//
+// A Writer can record the messages of a connection through its interceptors:
+//
+//	w, err := pcap.NewWriter(f)
+//	...
+//	conn, err := dbus.ConnectSessionBus(
+//		dbus.WithIncomingInterceptor(w.Interceptor()),
+//		dbus.WithOutgoingInterceptor(w.Interceptor()),
+//	)
+//
+// or all messages on a bus by writing the messages received by a monitor, see
+// Conn.BecomeMonitor. Captures are read back with a Reader and can be sent to a
+// peer again with Replay.
+package pcap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/yaamai/dbus/v5"
+)
+
+// LinkType is the pcap link type of D-Bus messages, DLT_DBUS.
+const LinkType = 231
+
+// snapLen is the maximum length of a D-Bus message, which is also used by
+// dbus-monitor.
+const snapLen = 128 * 1024 * 1024
+
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+)
+
+// Writer writes messages to a pcap file. It is safe for concurrent use by
+// multiple goroutines.
+type Writer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf bytes.Buffer
+	err error
+}
+
+// NewWriter writes the header of a pcap file to w and returns a Writer that
+// writes messages to it.
+func NewWriter(w io.Writer) (*Writer, error) {
+	var hdr [24]byte
+	binary.LittleEndian.PutUint32(hdr[0:], magicMicroseconds)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], snapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], LinkType)
+	if _, err := w.Write(hdr[:]); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// WriteMessage writes msg with the current time as its timestamp.
+func (w *Writer) WriteMessage(msg *dbus.Message) error {
+	return w.WriteMessageAt(msg, time.Now())
+}
+
+// WriteMessageAt writes msg with the timestamp t.
+func (w *Writer) WriteMessageAt(msg *dbus.Message, t time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Reset()
+	w.buf.Write(make([]byte, 16))
+	if err := msg.EncodeTo(&w.buf, binary.LittleEndian); err != nil {
+		return err
+	}
+	b := w.buf.Bytes()
+	n := uint32(len(b) - 16)
+	binary.LittleEndian.PutUint32(b[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(b[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(b[8:], n)
+	binary.LittleEndian.PutUint32(b[12:], n)
+	_, err := w.w.Write(b)
+	return err
+}
+
+// Interceptor returns an interceptor for WithIncomingInterceptor and
+// WithOutgoingInterceptor that writes all messages to w. Since interceptors
+// can't fail, the first error is recorded and returned by Err.
+func (w *Writer) Interceptor() dbus.Interceptor {
+	return func(msg *dbus.Message) {
+		if err := w.WriteMessage(msg); err != nil {
+			w.mu.Lock()
+			if w.err == nil {
+				w.err = err
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// Err returns the first error that occurred when writing a message passed to
+// an interceptor returned by Interceptor.
+func (w *Writer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Reader reads messages from a pcap file.
+type Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	nanos bool
+}
+
+// NewReader reads the header of a pcap file from r and returns a Reader that
+// reads the messages of the file. Files with a link type other than DLT_DBUS
+// are rejected.
+func NewReader(r io.Reader) (*Reader, error) {
+	rd := &Reader{r: bufio.NewReader(r)}
+	var hdr [24]byte
+	if _, err := io.ReadFull(rd.r, hdr[:]); err != nil {
+		return nil, err
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(hdr[0:]) {
+		case magicMicroseconds:
+			rd.order = order
+		case magicNanoseconds:
+			rd.order = order
+			rd.nanos = true
+		}
+	}
+	if rd.order == nil {
+		return nil, errors.New("pcap: not a pcap file")
+	}
+	if linkType := rd.order.Uint32(hdr[20:]); linkType != LinkType {
+		return nil, fmt.Errorf("pcap: unsupported link type %d", linkType)
+	}
+	return rd, nil
+}
+
+// ReadMessage reads the next message and returns it with its timestamp. At the
+// end of the file, it returns io.EOF.
+func (r *Reader) ReadMessage() (*dbus.Message, time.Time, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errors.New("pcap: truncated packet header")
+		}
+		return nil, time.Time{}, err
+	}
+	sec := r.order.Uint32(hdr[0:])
+	frac := r.order.Uint32(hdr[4:])
+	if !r.nanos {
+		frac *= 1000
+	}
+	t := time.Unix(int64(sec), int64(frac))
+	n := r.order.Uint32(hdr[8:])
+	if n > snapLen {
+		return nil, t, fmt.Errorf("pcap: packet of %d bytes is too large", n)
+	}
+	if n != r.order.Uint32(hdr[12:]) {
+		return nil, t, errors.New("pcap: message was truncated when captured")
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, t, err
+	}
+	msg, err := dbus.DecodeMessage(bytes.NewReader(data))
+	return msg, t, err
+}
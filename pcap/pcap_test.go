@@ -0,0 +1,172 @@
+package pcap
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/yaamai/dbus/v5"
+)
+
+// capture returns a capture of the messages of a connection that emits the
+// signal org.godbus.Pcap.Signal with the given argument.
+func capture(t *testing.T, arg string) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := dbus.ConnectSessionBus(
+		dbus.WithIncomingInterceptor(w.Interceptor()),
+		dbus.WithOutgoingInterceptor(w.Interceptor()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Emit("/org/godbus/pcap", "org.godbus.Pcap.Signal", arg); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteRead(t *testing.T) {
+	data := capture(t, "foo")
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []*dbus.Message
+	for {
+		msg, ts, err := r.ReadMessage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if time.Since(ts) > time.Minute {
+			t.Errorf("got timestamp %v", ts)
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) < 3 {
+		t.Fatalf("got %d messages, want at least 3: %v", len(msgs), msgs)
+	}
+	if msgs[0].Type != dbus.TypeMethodCall || msgs[1].Type != dbus.TypeMethodReply {
+		t.Errorf("got %v and %v, want Hello call and reply", msgs[0], msgs[1])
+	}
+	var found bool
+	for _, msg := range msgs[2:] {
+		if msg.Headers[dbus.FieldMember] == dbus.MakeVariant("Signal") {
+			found = true
+			if len(msg.Body) != 1 || msg.Body[0] != "foo" {
+				t.Errorf("got %v, want signal with body [foo]", msg)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("signal not captured: %v", msgs)
+	}
+}
+
+func TestReaderFormats(t *testing.T) {
+	data := capture(t, "foo")
+	msg, _, err := mustReader(t, data).ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A big endian file with nanosecond timestamps.
+	var buf bytes.Buffer
+	hdr := make([]byte, 24)
+	binary.BigEndian.PutUint32(hdr[0:], magicNanoseconds)
+	binary.BigEndian.PutUint32(hdr[20:], LinkType)
+	buf.Write(hdr)
+	var body bytes.Buffer
+	if err := msg.EncodeTo(&body, binary.BigEndian); err != nil {
+		t.Fatal(err)
+	}
+	rec := make([]byte, 16)
+	binary.BigEndian.PutUint32(rec[0:], 1000)
+	binary.BigEndian.PutUint32(rec[4:], 5)
+	binary.BigEndian.PutUint32(rec[8:], uint32(body.Len()))
+	binary.BigEndian.PutUint32(rec[12:], uint32(body.Len()))
+	buf.Write(rec)
+	buf.Write(body.Bytes())
+
+	got, ts, err := mustReader(t, buf.Bytes()).ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ts.Equal(time.Unix(1000, 5)) {
+		t.Errorf("got timestamp %v, want %v", ts, time.Unix(1000, 5))
+	}
+	if got.String() != msg.String() {
+		t.Errorf("got %v, want %v", got, msg)
+	}
+
+	binary.BigEndian.PutUint32(hdr[20:], 1)
+	if _, err := NewReader(bytes.NewReader(hdr)); err == nil {
+		t.Error("NewReader accepted link type 1")
+	}
+	if _, err := NewReader(bytes.NewReader(make([]byte, 24))); err == nil {
+		t.Error("NewReader accepted invalid magic")
+	}
+	if _, _, err := mustReader(t, data[:len(data)-1]).ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	r := mustReader(t, data[:30])
+	if _, _, err := r.ReadMessage(); err == nil || err == io.EOF {
+		t.Errorf("got %v for truncated file, want error", err)
+	}
+}
+
+func mustReader(t *testing.T, data []byte) *Reader {
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestReplay(t *testing.T) {
+	data := capture(t, "replayed")
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sub, err := conn.Subscribe(context.Background(), dbus.WithMatchInterface("org.godbus.Pcap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	n, err := Replay(conn, mustReader(t, data), ReplayOptions{
+		Filter: func(msg *dbus.Message) bool {
+			return msg.Type == dbus.TypeSignal && msg.Headers[dbus.FieldInterface] == dbus.MakeVariant("org.godbus.Pcap")
+		},
+		Timing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("replayed %d messages, want 1", n)
+	}
+	select {
+	case sig := <-sub.C:
+		if sig.Name != "org.godbus.Pcap.Signal" || len(sig.Body) != 1 || sig.Body[0] != "replayed" {
+			t.Errorf("got %v", sig)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for replayed signal")
+	}
+}
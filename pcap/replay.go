@@ -0,0 +1,54 @@
+package pcap
+
+import (
+	"io"
+	"time"
+
+	"github.com/yaamai/dbus/v5"
+)
+
+// ReplayOptions controls how Replay sends messages.
+type ReplayOptions struct {
+	// Filter is called for every message read. Only messages for which it
+	// returns true are sent. It may modify the message, for example to
+	// change its destination to the name of the peer. If Filter is nil,
+	// all messages are sent.
+	Filter func(msg *dbus.Message) bool
+
+	// Timing makes Replay wait between messages as long as the time that
+	// passed between them when they were captured.
+	Timing bool
+}
+
+// Replay sends the messages read from r to conn's peer until the end of the
+// capture and returns the number of messages sent. The messages are sent with
+// Conn.ForwardMessage, so they keep their serials and headers, and replies to
+// them are discarded by conn.
+func Replay(conn *dbus.Conn, r *Reader, opts ReplayOptions) (int, error) {
+	var n int
+	var last time.Time
+	for {
+		msg, t, err := r.ReadMessage()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if opts.Filter != nil && !opts.Filter(msg) {
+			continue
+		}
+		if opts.Timing && !last.IsZero() && t.After(last) {
+			select {
+			case <-time.After(t.Sub(last)):
+			case <-conn.Context().Done():
+				return n, dbus.ErrClosed
+			}
+		}
+		last = t
+		if err := conn.ForwardMessage(msg); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
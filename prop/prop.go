@@ -3,6 +3,7 @@
 package prop
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/yaamai/dbus/v5"
@@ -237,6 +238,32 @@ func (p *Properties) Introspection(iface string) []introspect.Property {
 	return s
 }
 
+// PropertySpecs implements dbus.PropertiesIntrospector, so that the properties
+// of iface are described in the introspection data that is generated for the
+// object that p is exported on. Properties that don't emit PropertiesChanged
+// with their values are annotated accordingly.
+func (p *Properties) PropertySpecs(iface string) []dbus.PropertySpec {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	m := p.m[iface]
+	specs := make([]dbus.PropertySpec, 0, len(m))
+	for k, v := range m {
+		spec := dbus.PropertySpec{Name: k, Type: dbus.SignatureOf(v.Value), Access: "read"}
+		if v.Writable {
+			spec.Access = "readwrite"
+		}
+		switch v.Emit {
+		case EmitFalse:
+			spec.Annotations = []dbus.Annotation{{Name: dbus.AnnotationEmitsChangedSignal, Value: "false"}}
+		case EmitInvalidates:
+			spec.Annotations = []dbus.Annotation{{Name: dbus.AnnotationEmitsChangedSignal, Value: "invalidates"}}
+		}
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs
+}
+
 // set sets the given property and emits PropertyChanged if appropriate. p.mut
 // must already be locked.
 func (p *Properties) set(iface, property string, v interface{}) error {
@@ -0,0 +1,258 @@
+package prop
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/yaamai/dbus/v5"
+)
+
+// ErrUnknownProperty is returned by the getters of a Proxy for properties
+// whose value isn't known.
+var ErrUnknownProperty = errors.New("dbus: unknown property")
+
+// Proxy caches the properties of an interface of a remote object, like
+// GDBusProxy does. It is safe for concurrent use by multiple goroutines.
+//
+// The properties are fetched with GetAll when the Proxy is created and kept
+// up to date through the PropertiesChanged signal of the object. Properties
+// that are invalidated by the signal are fetched again with Get.
+type Proxy struct {
+	obj   dbus.BusObject
+	iface string
+	sub   *dbus.Subscription
+
+	mut   sync.RWMutex
+	props map[string]dbus.Variant
+
+	handlersMut sync.Mutex
+	handlers    map[int]func(changed map[string]dbus.Variant, invalidated []string)
+	nextHandler int
+}
+
+// NewProxy returns a new Proxy for the properties of the interface iface of
+// obj, which must be an object on conn.
+func NewProxy(conn *dbus.Conn, obj dbus.BusObject, iface string) (*Proxy, error) {
+	sub, err := conn.Subscribe(context.Background(),
+		dbus.WithMatchSender(obj.Destination()),
+		dbus.WithMatchObjectPath(obj.Path()),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+		dbus.WithMatchArg(0, iface),
+	)
+	if err != nil {
+		return nil, err
+	}
+	p := &Proxy{
+		obj:      obj,
+		iface:    iface,
+		sub:      sub,
+		handlers: make(map[int]func(map[string]dbus.Variant, []string)),
+	}
+	call := obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, iface)
+	if err := call.Store(&p.props); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	if p.props == nil {
+		p.props = make(map[string]dbus.Variant)
+	}
+	go p.run(call.ResponseSequence)
+	return p, nil
+}
+
+// Close stops updating the Proxy. The cached properties stay available. The
+// report of a change that is in progress when Close is called may still
+// complete.
+func (p *Proxy) Close() error {
+	return p.sub.Close()
+}
+
+// Interface returns the name of the interface whose properties are cached.
+func (p *Proxy) Interface() string {
+	return p.iface
+}
+
+// Names returns the names of all properties whose values are known.
+func (p *Proxy) Names() []string {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	names := make([]string, 0, len(p.props))
+	for name := range p.props {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Get returns the cached value of the named property. The returned bool is
+// false if the value isn't known.
+func (p *Proxy) Get(name string) (dbus.Variant, bool) {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	v, ok := p.props[name]
+	return v, ok
+}
+
+// GetAll returns a copy of all cached properties.
+func (p *Proxy) GetAll() map[string]dbus.Variant {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	m := make(map[string]dbus.Variant, len(p.props))
+	for k, v := range p.props {
+		m[k] = v
+	}
+	return m
+}
+
+// Store stores the cached value of the named property into the value pointed
+// to by v, converting it like dbus.Store does.
+func (p *Proxy) Store(name string, v interface{}) error {
+	value, ok := p.Get(name)
+	if !ok {
+		return ErrUnknownProperty
+	}
+	return value.Store(v)
+}
+
+// String returns the cached value of a property of type STRING.
+func (p *Proxy) String(name string) (string, error) {
+	var v string
+	err := p.Store(name, &v)
+	return v, err
+}
+
+// Bool returns the cached value of a property of type BOOLEAN.
+func (p *Proxy) Bool(name string) (bool, error) {
+	var v bool
+	err := p.Store(name, &v)
+	return v, err
+}
+
+// Int32 returns the cached value of a property of type INT32.
+func (p *Proxy) Int32(name string) (int32, error) {
+	var v int32
+	err := p.Store(name, &v)
+	return v, err
+}
+
+// Uint32 returns the cached value of a property of type UINT32.
+func (p *Proxy) Uint32(name string) (uint32, error) {
+	var v uint32
+	err := p.Store(name, &v)
+	return v, err
+}
+
+// Int64 returns the cached value of a property of type INT64.
+func (p *Proxy) Int64(name string) (int64, error) {
+	var v int64
+	err := p.Store(name, &v)
+	return v, err
+}
+
+// Uint64 returns the cached value of a property of type UINT64.
+func (p *Proxy) Uint64(name string) (uint64, error) {
+	var v uint64
+	err := p.Store(name, &v)
+	return v, err
+}
+
+// Float64 returns the cached value of a property of type DOUBLE.
+func (p *Proxy) Float64(name string) (float64, error) {
+	var v float64
+	err := p.Store(name, &v)
+	return v, err
+}
+
+// ObjectPath returns the cached value of a property of type OBJECT_PATH.
+func (p *Proxy) ObjectPath(name string) (dbus.ObjectPath, error) {
+	var v dbus.ObjectPath
+	err := p.Store(name, &v)
+	return v, err
+}
+
+// Strings returns the cached value of a property of type ARRAY of STRING.
+func (p *Proxy) Strings(name string) ([]string, error) {
+	var v []string
+	err := p.Store(name, &v)
+	return v, err
+}
+
+// Set calls org.freedesktop.DBus.Properties.Set for the named property. v may
+// be a dbus.Variant or a plain value. The cache is updated once the object
+// reports the change.
+func (p *Proxy) Set(name string, v interface{}) error {
+	value, ok := v.(dbus.Variant)
+	if !ok {
+		value = dbus.MakeVariant(v)
+	}
+	return p.obj.Call("org.freedesktop.DBus.Properties.Set", 0, p.iface, name, value).Err
+}
+
+// OnChange registers fn to be called whenever properties change, after the
+// cache was updated. changed contains the new values of the properties,
+// including those that were fetched again after being invalidated, and
+// invalidated the names of the properties that couldn't be fetched and were
+// removed from the cache. The callbacks are called from a single goroutine,
+// in order. Calling the returned function unregisters fn.
+func (p *Proxy) OnChange(fn func(changed map[string]dbus.Variant, invalidated []string)) (remove func()) {
+	p.handlersMut.Lock()
+	defer p.handlersMut.Unlock()
+	id := p.nextHandler
+	p.nextHandler++
+	p.handlers[id] = fn
+	return func() {
+		p.handlersMut.Lock()
+		defer p.handlersMut.Unlock()
+		delete(p.handlers, id)
+	}
+}
+
+// run applies the signals received after the reply to GetAll, which has the
+// given sequence, until the subscription is closed.
+func (p *Proxy) run(sequence dbus.Sequence) {
+	for sig := range p.sub.C {
+		var iface string
+		var changed map[string]dbus.Variant
+		var invalidated []string
+		if sig.Sequence < sequence ||
+			dbus.Store(sig.Body, &iface, &changed, &invalidated) != nil ||
+			iface != p.iface {
+			continue
+		}
+		if changed == nil {
+			changed = make(map[string]dbus.Variant)
+		}
+		var removed []string
+		for _, name := range invalidated {
+			var v dbus.Variant
+			err := p.obj.Call("org.freedesktop.DBus.Properties.Get", 0, p.iface, name).Store(&v)
+			if err != nil {
+				removed = append(removed, name)
+				continue
+			}
+			changed[name] = v
+		}
+
+		p.mut.Lock()
+		for name, v := range changed {
+			p.props[name] = v
+		}
+		for _, name := range removed {
+			delete(p.props, name)
+		}
+		p.mut.Unlock()
+
+		p.handlersMut.Lock()
+		handlers := make([]func(map[string]dbus.Variant, []string), 0, len(p.handlers))
+		for id := 0; id < p.nextHandler; id++ {
+			if fn, ok := p.handlers[id]; ok {
+				handlers = append(handlers, fn)
+			}
+		}
+		p.handlersMut.Unlock()
+		for _, fn := range handlers {
+			fn(changed, removed)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package prop
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yaamai/dbus/v5"
+)
+
+func TestProxy(t *testing.T) {
+	srv, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const iface = "org.godbus.Proxy"
+	props, err := Export(srv, "/org/godbus/proxy", map[string]map[string]*Prop{
+		iface: {
+			"Name":    {Value: "first", Writable: true, Emit: EmitTrue},
+			"Counter": {Value: uint32(1), Emit: EmitInvalidates},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewProxy(conn, conn.Object(srv.Names()[0], "/org/godbus/proxy"), iface)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	changes := make(chan map[string]dbus.Variant, 10)
+	p.OnChange(func(changed map[string]dbus.Variant, invalidated []string) {
+		changes <- changed
+	})
+
+	if name, err := p.String("Name"); err != nil || name != "first" {
+		t.Errorf("Name = %q, %v; want first", name, err)
+	}
+	if _, err := p.Bool("Missing"); err != ErrUnknownProperty {
+		t.Errorf("getting a missing property returned %v", err)
+	}
+	next := func() map[string]dbus.Variant {
+		select {
+		case changed := <-changes:
+			return changed
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for change")
+		}
+		return nil
+	}
+
+	if err := p.Set("Name", "second"); err != nil {
+		t.Fatal(err)
+	}
+	if changed := next(); changed["Name"].Value() != "second" {
+		t.Errorf("got change %v, want Name = second", changed)
+	}
+	if name, _ := p.String("Name"); name != "second" {
+		t.Errorf("Name = %q after Set, want second", name)
+	}
+
+	// Invalidated properties are fetched again.
+	props.SetMust(iface, "Counter", uint32(2))
+	if changed := next(); changed["Counter"].Value() != uint32(2) {
+		t.Errorf("got change %v, want Counter = 2", changed)
+	}
+	if counter, _ := p.Uint32("Counter"); counter != 2 {
+		t.Errorf("Counter = %d after invalidation, want 2", counter)
+	}
+}
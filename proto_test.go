@@ -258,6 +258,56 @@ func TestMessage(t *testing.T) {
 	}
 }
 
+func TestMessageUnixFDs(t *testing.T) {
+	message := &Message{
+		Type: TypeSignal,
+		Headers: map[HeaderField]Variant{
+			FieldPath:      MakeVariant(ObjectPath("/org/foo/bar")),
+			FieldInterface: MakeVariant("org.foo"),
+			FieldMember:    MakeVariant("baz"),
+			FieldSignature: MakeVariant(SignatureOf([]UnixFD{})),
+		},
+		Body:   []interface{}{[]UnixFD{7, 9}},
+		serial: 1,
+	}
+	buf := new(bytes.Buffer)
+	if err := message.EncodeTo(buf, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := message.Headers[FieldUnixFDs]; ok {
+		t.Error("EncodeTo set the UnixFDs header field")
+	}
+	got, err := DecodeMessage(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{[]UnixFDIndex{7, 9}}; !reflect.DeepEqual(got.Body, want) {
+		t.Errorf("EncodeTo: got %v, want %v", got.Body, want)
+	}
+
+	buf.Reset()
+	fds, err := message.encodeWithFDs(buf, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fds, []int{7, 9}) {
+		t.Errorf("got fds %v, want [7 9]", fds)
+	}
+	if _, ok := message.Headers[FieldUnixFDs]; ok {
+		t.Error("encodeWithFDs set the UnixFDs header field")
+	}
+	got, err = DecodeMessage(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := got.Headers[FieldUnixFDs].Value(); n != uint32(2) {
+		t.Errorf("got %v unix fds, want 2", n)
+	}
+	if want := []interface{}{[]UnixFDIndex{0, 1}}; !reflect.DeepEqual(got.Body, want) {
+		t.Errorf("encodeWithFDs: got %v, want %v", got.Body, want)
+	}
+}
+
 func TestProtoStructInterfaces(t *testing.T) {
 	b := []byte{42}
 	vs, err := newDecoder(bytes.NewReader(b), binary.LittleEndian).Decode(Signature{"(y)"})
@@ -0,0 +1,322 @@
+package dbus
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrDisconnected is the error returned by calls that are made while a
+// connection with automatic reconnection is lost.
+var ErrDisconnected = errors.New("dbus: connection lost")
+
+// ConnState is the state of a connection with automatic reconnection.
+type ConnState int
+
+const (
+	// ConnStateConnected means that the connection was reestablished and its
+	// names and match rules were restored.
+	ConnStateConnected ConnState = iota
+	// ConnStateDisconnected means that the connection was lost and is being
+	// reestablished. Calls fail with ErrDisconnected in this state.
+	ConnStateDisconnected
+	// ConnStateClosed means that reconnection was given up and the connection
+	// was closed.
+	ConnStateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnStateConnected:
+		return "connected"
+	case ConnStateDisconnected:
+		return "disconnected"
+	case ConnStateClosed:
+		return "closed"
+	}
+	return "invalid"
+}
+
+// ReconnectPolicy controls the automatic reconnection of a connection.
+type ReconnectPolicy struct {
+	// Delay returns how long to wait before the given reconnection attempt,
+	// counting from 1 after each loss of the connection. If it returns false,
+	// reconnection is given up and the connection is closed. If Delay is
+	// nil, ExponentialBackoff(100*time.Millisecond, 30*time.Second, 0) is
+	// used.
+	Delay func(attempt int) (time.Duration, bool)
+
+	// OnStateChange, if not nil, is called whenever the state of the
+	// connection changes. err is the error that caused the change, if any.
+	// It is called from the goroutine that reconnects, which is blocked
+	// until it returns.
+	OnStateChange func(state ConnState, err error)
+}
+
+// ExponentialBackoff returns a function for ReconnectPolicy.Delay that waits
+// min before the first attempt and doubles the delay for each following one,
+// up to max. If attempts is greater than 0, reconnection is given up after
+// that many attempts.
+func ExponentialBackoff(min, max time.Duration, attempts int) func(attempt int) (time.Duration, bool) {
+	return func(attempt int) (time.Duration, bool) {
+		if attempts > 0 && attempt > attempts {
+			return 0, false
+		}
+		d := min
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d, true
+	}
+}
+
+// WithReconnect causes the connection to be reestablished when it is lost,
+// instead of being closed. Only connections created with Dial or the
+// functions using it can be reconnected.
+//
+// After redialing the original address, the connection is authenticated with
+// the mechanisms passed to the last call of Auth and, if Hello was called
+// before, registered on the bus again, receiving a new unique name. Then, the
+// well-known names requested with RequestName are requested again with the
+// same flags and the match rules added with AddMatchSignal and Subscribe are
+// added again. Exported objects, signal channels and subscriptions stay in
+// place. Calls that were pending when the connection was lost fail with the
+// error that caused the loss.
+func WithReconnect(policy ReconnectPolicy) ConnOption {
+	return func(conn *Conn) error {
+		if policy.Delay == nil {
+			policy.Delay = ExponentialBackoff(100*time.Millisecond, 30*time.Second, 0)
+		}
+		conn.reconnect = &policy
+		return nil
+	}
+}
+
+// reconnectTransport is the transport of connections with automatic
+// reconnection, which allows replacing the underlying transport.
+type reconnectTransport struct {
+	mu        sync.RWMutex
+	tr        transport
+	connected bool
+	closed    bool
+}
+
+func (t *reconnectTransport) current() transport {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tr
+}
+
+func (t *reconnectTransport) Read(p []byte) (int, error) {
+	return t.current().Read(p)
+}
+
+func (t *reconnectTransport) Write(p []byte) (int, error) {
+	return t.current().Write(p)
+}
+
+func (t *reconnectTransport) SendNullByte() error {
+	return t.current().SendNullByte()
+}
+
+func (t *reconnectTransport) SupportsUnixFDs() bool {
+	return t.current().SupportsUnixFDs()
+}
+
+func (t *reconnectTransport) EnableUnixFDs() {
+	t.current().EnableUnixFDs()
+}
+
+func (t *reconnectTransport) ReadMessage() (*Message, error) {
+	return t.current().ReadMessage()
+}
+
+// SendMessage sends msg if the connection is established and fails with
+// ErrDisconnected otherwise.
+func (t *reconnectTransport) SendMessage(msg *Message) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if !t.connected {
+		return ErrDisconnected
+	}
+	return t.tr.SendMessage(msg)
+}
+
+func (t *reconnectTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return t.tr.Close()
+}
+
+func (t *reconnectTransport) peerCredentials() (pid, uid uint32, err error) {
+	ct, ok := t.current().(credentialsTransport)
+	if !ok {
+		return 0, 0, errors.New("dbus: transport does not support peer credentials")
+	}
+	return ct.peerCredentials()
+}
+
+// disconnect marks the connection as lost and closes the underlying transport.
+func (t *reconnectTransport) disconnect() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connected = false
+	t.tr.Close()
+}
+
+// replace replaces the underlying transport with tr. It returns false if the
+// connection was closed in the meantime.
+func (t *reconnectTransport) replace(tr transport) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	t.tr = tr
+	return true
+}
+
+func (t *reconnectTransport) setConnected() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connected = true
+}
+
+// handleDisconnect is called by inWorker when reading from the connection
+// failed with err. It reestablishes the connection and returns true, or
+// returns false if the connection should be closed.
+func (conn *Conn) handleDisconnect(sequenceGen *sequenceGenerator, err error) bool {
+	rt, ok := conn.transport.(*reconnectTransport)
+	// A monitor can't be restored after reconnecting, so it is closed
+	// instead.
+	if !ok || conn.address == "" || conn.ctx.Err() != nil || conn.isMonitor() {
+		return false
+	}
+	rt.disconnect()
+	conn.calls.finalizeAllWithError(sequenceGen, err)
+	for _, o := range conn.names.loseAllNames() {
+		o.queue.deliver(nameLostSignal(o.name))
+	}
+	conn.reconnectStateChanged(ConnStateDisconnected, err)
+
+	registered := conn.names.uniqueNameIsKnown()
+	for attempt := 1; ; attempt++ {
+		delay, ok := conn.reconnect.Delay(attempt)
+		if !ok {
+			conn.Close()
+			conn.reconnectStateChanged(ConnStateClosed, err)
+			return true
+		}
+		select {
+		case <-time.After(delay):
+		case <-conn.ctx.Done():
+			return true
+		}
+		if err = conn.redial(rt, registered); err == nil {
+			break
+		}
+	}
+	go conn.inWorker()
+	conn.reconnectStateChanged(ConnStateConnected, conn.restore())
+	return true
+}
+
+// redial replaces the underlying transport of rt with a new connection to
+// the original address and authenticates it.
+func (conn *Conn) redial(rt *reconnectTransport, hello bool) error {
+	tr, err := getTransport(conn.address)
+	if err != nil {
+		return err
+	}
+	if !rt.replace(tr) {
+		tr.Close()
+		return ErrClosed
+	}
+	if err = conn.authenticate(conn.auth); err != nil {
+		tr.Close()
+		return err
+	}
+	if hello {
+		name, err := conn.rawHello(tr)
+		if err != nil {
+			tr.Close()
+			return err
+		}
+		conn.names.reset(name)
+	}
+	rt.setConnected()
+	return nil
+}
+
+// rawHello calls Hello directly on tr, before inWorker is running, so that no
+// other message can be sent to the bus before it.
+func (conn *Conn) rawHello(tr transport) (string, error) {
+	msg := &Message{
+		Type: TypeMethodCall,
+		Headers: map[HeaderField]Variant{
+			FieldPath:        MakeVariant(ObjectPath("/org/freedesktop/DBus")),
+			FieldDestination: MakeVariant("org.freedesktop.DBus"),
+			FieldInterface:   MakeVariant("org.freedesktop.DBus"),
+			FieldMember:      MakeVariant("Hello"),
+		},
+	}
+	msg.serial = conn.getSerial()
+	defer conn.serialGen.RetireSerial(msg.serial)
+	if err := tr.SendMessage(msg); err != nil {
+		return "", err
+	}
+	for {
+		reply, err := tr.ReadMessage()
+		if err != nil {
+			return "", err
+		}
+		serial, _ := reply.Headers[FieldReplySerial].value.(uint32)
+		if serial != msg.serial {
+			continue
+		}
+		if reply.Type == TypeError {
+			name, _ := reply.Headers[FieldErrorName].value.(string)
+			return "", Error{name, reply.Body}
+		}
+		var name string
+		if err := Store(reply.Body, &name); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+}
+
+// restore requests the names and adds the match rules of the connection
+// again after it was reestablished, and queries the owners of the watched
+// names, which may have changed in the meantime. The first error that
+// occurred is returned.
+func (conn *Conn) restore() error {
+	var firstErr error
+	check := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for name, flags := range conn.names.listRequestedNames() {
+		_, err := conn.RequestName(name, flags)
+		check(err)
+	}
+	for _, rule := range conn.subs.listRules() {
+		check(conn.busObj.Call("org.freedesktop.DBus.AddMatch", 0, rule).Store())
+	}
+	check(conn.subs.refreshOwners(conn))
+	for _, w := range conn.names.listWatchers() {
+		check(w.refresh())
+	}
+	return firstErr
+}
+
+func (conn *Conn) reconnectStateChanged(state ConnState, err error) {
+	if conn.reconnect.OnStateChange != nil {
+		conn.reconnect.OnStateChange(state, err)
+	}
+}
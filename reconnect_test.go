@@ -0,0 +1,228 @@
+package dbus
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBus implements the parts of org.freedesktop.DBus that are needed for
+// restoring a connection.
+type fakeBus struct {
+	mu     sync.Mutex
+	serial int
+	names  map[string]uint32
+	rules  []string
+	owners map[string]string
+}
+
+func (b *fakeBus) Hello() (string, *Error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.serial++
+	return ":1." + strconv.Itoa(b.serial), nil
+}
+
+func (b *fakeBus) RequestName(name string, flags uint32) (uint32, *Error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.names[name] = flags
+	return uint32(RequestNameReplyPrimaryOwner), nil
+}
+
+func (b *fakeBus) AddMatch(rule string) *Error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rules = append(b.rules, rule)
+	return nil
+}
+
+func (b *fakeBus) RemoveMatch(rule string) *Error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, r := range b.rules {
+		if r == rule {
+			b.rules = append(b.rules[:i], b.rules[i+1:]...)
+			return nil
+		}
+	}
+	return &Error{Name: "org.freedesktop.DBus.Error.MatchRuleNotFound"}
+}
+
+func (b *fakeBus) GetNameOwner(name string) (string, *Error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if owner, ok := b.owners[name]; ok {
+		return owner, nil
+	}
+	return "", &Error{Name: "org.freedesktop.DBus.Error.NameHasNoOwner"}
+}
+
+func (b *fakeBus) setOwner(name, owner string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.owners == nil {
+		b.owners = make(map[string]string)
+	}
+	b.owners[name] = owner
+}
+
+func (b *fakeBus) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.names = make(map[string]uint32)
+	b.rules = nil
+}
+
+func TestReconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbus-reconnect-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srv, err := Listen("unix:tmpdir=" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	bus := new(fakeBus)
+	bus.reset()
+	peers := make(chan *Conn, 2)
+	go func() {
+		for {
+			peer, err := srv.Accept()
+			if err != nil {
+				return
+			}
+			peer.Export(bus, "/org/freedesktop/DBus", "org.freedesktop.DBus")
+			peers <- peer
+		}
+	}()
+
+	states := make(chan ConnState, 4)
+	conn, err := Connect(srv.Address(), WithReconnect(ReconnectPolicy{
+		Delay: ExponentialBackoff(10*time.Millisecond, 100*time.Millisecond, 0),
+		OnStateChange: func(state ConnState, err error) {
+			states <- state
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = conn.RequestName("org.godbus.reconnect", NameFlagAllowReplacement); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.AddMatchSignal(WithMatchInterface("org.godbus.reconnect")); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.AddMatchSignal(WithMatchMember("Reconnect")); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.RemoveMatchSignal(WithMatchMember("Reconnect")); err != nil {
+		t.Fatal(err)
+	}
+	name := conn.Names()[0]
+
+	bus.reset()
+	(<-peers).Close()
+	for _, want := range []ConnState{ConnStateDisconnected, ConnStateConnected} {
+		select {
+		case state := <-states:
+			if state != want {
+				t.Fatalf("got state %v, want %v", state, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for state %v", want)
+		}
+	}
+	defer (<-peers).Close()
+
+	if conn.Names()[0] == name {
+		t.Errorf("unique name %s wasn't renewed", name)
+	}
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if flags, ok := bus.names["org.godbus.reconnect"]; !ok || flags != uint32(NameFlagAllowReplacement) {
+		t.Errorf("name wasn't requested again with the same flags: %v", bus.names)
+	}
+	want := "type='signal',interface='org.godbus.reconnect'"
+	if len(bus.rules) != 1 || bus.rules[0] != want {
+		t.Errorf("match rules restored as %q, want %q", bus.rules, want)
+	}
+}
+
+func TestReconnectWatchName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbus-reconnect-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srv, err := Listen("unix:tmpdir=" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	bus := new(fakeBus)
+	bus.reset()
+	peers := make(chan *Conn, 2)
+	go func() {
+		for {
+			peer, err := srv.Accept()
+			if err != nil {
+				return
+			}
+			peer.Export(bus, "/org/freedesktop/DBus", "org.freedesktop.DBus")
+			peers <- peer
+		}
+	}()
+
+	conn, err := Connect(srv.Address(), WithReconnect(ReconnectPolicy{
+		Delay: ExponentialBackoff(10*time.Millisecond, 100*time.Millisecond, 0),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const name = "org.godbus.reconnect"
+	events := make(chan string, 4)
+	w, err := conn.WatchName(name, func(n, owner string, seq Sequence) {
+		events <- "appeared " + owner
+	}, func(n string, seq Sequence) {
+		events <- "vanished"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case ev := <-events:
+			if ev != want {
+				t.Fatalf("got %q, want %q", ev, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	expect("vanished")
+
+	// The name gets an owner while the connection is lost.
+	bus.setOwner(name, ":1.42")
+	(<-peers).Close()
+	defer func() {
+		select {
+		case peer := <-peers:
+			peer.Close()
+		default:
+		}
+	}()
+	expect("appeared :1.42")
+}
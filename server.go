@@ -0,0 +1,195 @@
+package dbus
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serverAuthTimeout is the time a peer has to authenticate before it is
+// disconnected.
+const serverAuthTimeout = 30 * time.Second
+
+// Server listens on a D-Bus address and accepts connections from peers.
+// Accepted connections are peer-to-peer connections; there is no message bus
+// between the server and its peers, so Hello must not be called on them.
+type Server struct {
+	listener listener
+	guid     string
+	auth     []ServerAuth
+
+	serveOnce sync.Once
+	// peers receives the connections to peers that have authenticated.
+	peers chan *Conn
+	// done is closed when the listener fails, with the error in err.
+	done chan struct{}
+	err  error
+}
+
+// ServerOption is a server option.
+type ServerOption func(srv *Server) error
+
+// WithServerAuth sets the authentication mechanisms offered to peers. By
+// default, only the EXTERNAL mechanism for the user the server runs as is
+// offered.
+func WithServerAuth(methods ...ServerAuth) ServerOption {
+	return func(srv *Server) error {
+		srv.auth = methods
+		return nil
+	}
+}
+
+// listener is the server side of a D-Bus transport.
+type listener interface {
+	// Accept waits for and returns the next connection to the listener.
+	Accept() (transport, error)
+
+	// Close closes the listener.
+	Close() error
+
+	// Address returns an address that peers can use to connect to the
+	// listener, without the guid key.
+	Address() string
+}
+
+var (
+	listeners = make(map[string]func(string) (listener, error))
+)
+
+// Listen announces on the given address and returns a Server that accepts
+// peer connections on it. As with Dial, address may contain several
+// semicolon-separated addresses; the first one that can be listened on is
+// used.
+func Listen(address string, opts ...ServerOption) (*Server, error) {
+	srv := &Server{peers: make(chan *Conn), done: make(chan struct{})}
+	for _, opt := range opts {
+		if err := opt(srv); err != nil {
+			return nil, err
+		}
+	}
+	if srv.auth == nil {
+		srv.auth = []ServerAuth{ServerAuthExternal()}
+	}
+	guid, err := newGUID()
+	if err != nil {
+		return nil, err
+	}
+	srv.guid = guid
+	srv.listener, err = getListener(address)
+	if err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// Accept waits for the next peer to connect and authenticate and returns the
+// connection to it. The given options are applied to the returned connection,
+// so that every peer can for example be given its own Handler.
+//
+// Peers authenticate concurrently, so that a slow peer doesn't hold up others.
+// Peers that fail to authenticate within 30 seconds are disconnected and
+// Accept continues to wait for the next peer. An error is returned if the
+// listener fails, for example because the server was closed, or if one of the
+// options fails, in which case the peer is disconnected.
+func (srv *Server) Accept(opts ...ConnOption) (*Conn, error) {
+	srv.serveOnce.Do(func() { go srv.serve() })
+	select {
+	case peer := <-srv.peers:
+		conn, err := newConn(peer.transport, opts...)
+		if err != nil {
+			peer.transport.Close()
+			return nil, err
+		}
+		conn.uuid = peer.uuid
+		conn.unixFD = peer.unixFD
+		go conn.inWorker()
+		return conn, nil
+	case <-srv.done:
+		return nil, srv.err
+	}
+}
+
+// serve accepts connections until the listener fails and authenticates each
+// peer in its own goroutine.
+func (srv *Server) serve() {
+	for {
+		tr, err := srv.listener.Accept()
+		if err != nil {
+			srv.err = err
+			close(srv.done)
+			return
+		}
+		go srv.authenticate(tr)
+	}
+}
+
+// authenticate runs the authentication protocol with the peer of tr and hands
+// the connection over to Accept on success.
+func (srv *Server) authenticate(tr transport) {
+	timer := time.AfterFunc(serverAuthTimeout, func() { tr.Close() })
+	peer := &Conn{transport: tr}
+	err := peer.serverAuth(srv.guid, srv.auth)
+	if !timer.Stop() || err != nil {
+		tr.Close()
+		return
+	}
+	select {
+	case srv.peers <- peer:
+	case <-srv.done:
+		tr.Close()
+	}
+}
+
+// Address returns the address of the server, including its guid, in a format
+// suitable for Dial.
+func (srv *Server) Address() string {
+	return srv.listener.Address() + ",guid=" + srv.guid
+}
+
+// GUID returns the globally unique identifier of the server, which is sent to
+// peers on successful authentication.
+func (srv *Server) GUID() string {
+	return srv.guid
+}
+
+// Close stops listening. Connections that were already accepted are not
+// affected.
+func (srv *Server) Close() error {
+	return srv.listener.Close()
+}
+
+func getListener(address string) (listener, error) {
+	var err error
+	var l listener
+
+	addresses := strings.Split(address, ";")
+	for _, v := range addresses {
+		i := strings.IndexRune(v, ':')
+		if i == -1 {
+			err = errors.New("dbus: invalid bus address (no transport)")
+			continue
+		}
+		f := listeners[v[:i]]
+		if f == nil {
+			err = errors.New("dbus: invalid bus address (invalid or unsupported transport)")
+			continue
+		}
+		l, err = f(v[i+1:])
+		if err == nil {
+			return l, nil
+		}
+	}
+	return nil, err
+}
+
+// newGUID returns a new random, hex-encoded server GUID.
+func newGUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,211 @@
+package dbus
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type serverTest struct{}
+
+func (serverTest) Echo(s string) (string, *Error) {
+	return s, nil
+}
+
+func TestServerAccept(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbus-server-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv, err := Listen("unix:tmpdir=" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		peer, err := srv.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		errc <- peer.Export(serverTest{}, "/org/godbus/test", "org.godbus.test")
+	}()
+
+	conn, err := Dial(srv.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.Auth(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if conn.uuid != srv.GUID() {
+		t.Errorf("got guid %q, want %q", conn.uuid, srv.GUID())
+	}
+
+	var s string
+	err = conn.Object("", "/org/godbus/test").Call("org.godbus.test.Echo", 0, "hello").Store(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "hello" {
+		t.Errorf("got %q, want %q", s, "hello")
+	}
+}
+
+func TestServerAuthMechanisms(t *testing.T) {
+	home, err := ioutil.TempDir("", "dbus-server-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	uid := strconv.Itoa(os.Getuid())
+	for _, tc := range []struct {
+		address string
+		auth    Auth
+		unixFD  bool
+	}{
+		{"unix:tmpdir=" + home, AuthExternal(uid), true},
+		{"unix:tmpdir=" + home, AuthCookieSha1(uid, home), true},
+		{"tcp:host=127.0.0.1", AuthAnonymous(), false},
+	} {
+		name, _, _ := tc.auth.FirstData()
+		srv, err := Listen(tc.address, WithServerAuth(
+			ServerAuthExternal(), ServerAuthCookieSha1(home), ServerAuthAnonymous()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		accepted := make(chan *Conn, 1)
+		go func() {
+			peer, err := srv.Accept()
+			if err != nil {
+				t.Error(err)
+			}
+			accepted <- peer
+		}()
+		conn, err := Dial(srv.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = conn.Auth([]Auth{tc.auth}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		peer := <-accepted
+		if peer == nil {
+			t.FailNow()
+		}
+		if conn.SupportsUnixFDs() != tc.unixFD || peer.SupportsUnixFDs() != tc.unixFD {
+			t.Errorf("%s: unix fd passing negotiated: client %v, server %v, want %v",
+				name, conn.SupportsUnixFDs(), peer.SupportsUnixFDs(), tc.unixFD)
+		}
+		conn.Close()
+		peer.Close()
+		srv.Close()
+	}
+}
+
+func TestServerAuthRejected(t *testing.T) {
+	srv, err := Listen("tcp:host=127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	go srv.Accept()
+
+	conn, err := Dial(srv.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.Auth([]Auth{AuthAnonymous()}); err == nil {
+		t.Error("anonymous authentication succeeded, but wasn't offered")
+	}
+}
+
+func TestServerSlowPeer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbus-server-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "socket")
+	srv, err := Listen("unix:path=" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	accepted := make(chan *Conn, 1)
+	go func() {
+		peer, err := srv.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- peer
+	}()
+
+	// A peer that never authenticates doesn't hold up the next one.
+	slow, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	conn, err := Dial(srv.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.Auth(nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case peer := <-accepted:
+		if peer != nil {
+			peer.Close()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer not accepted while another one is authenticating")
+	}
+}
+
+func TestServerCloseRemovesSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbus-server-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, address := range []string{
+		"unix:path=" + filepath.Join(dir, "socket"),
+		"unix:dir=" + dir,
+		"unix:tmpdir=" + dir,
+	} {
+		srv, err := Listen(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := strings.TrimPrefix(srv.listener.Address(), "unix:path=")
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("%s: %v", address, err)
+		}
+		if err := srv.Close(); err != nil {
+			t.Errorf("%s: %v", address, err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: socket file not removed: %v", address, err)
+		}
+	}
+}
@@ -47,6 +47,12 @@ func SignatureOfType(t reflect.Type) Signature {
 
 // getSignature returns the signature of the given type and panics on unknown types.
 func getSignature(t reflect.Type) string {
+	if s, ok, err := marshalerSignature(t); ok {
+		if err != nil {
+			panic(err)
+		}
+		return s
+	}
 	// handle simple types first
 	switch t.Kind() {
 	case reflect.Uint8:
@@ -85,15 +91,10 @@ func getSignature(t reflect.Type) string {
 			return "v"
 		} else if t == signatureType {
 			return "g"
+		} else if t == fdType {
+			return "h"
 		}
-		var s string
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
-			if field.PkgPath == "" && field.Tag.Get("dbus") != "-" {
-				s += getSignature(t.Field(i).Type)
-			}
-		}
-		return "(" + s + ")"
+		return structSignature(t)
 	case reflect.Array, reflect.Slice:
 		return "a" + getSignature(t.Elem())
 	case reflect.Map:
@@ -148,6 +149,12 @@ func (s Signature) Single() bool {
 	return err != nil && r == ""
 }
 
+// isSingle returns whether s is a single complete type.
+func isSingle(s string) bool {
+	err, r := validSingle(s, 0)
+	return err == nil && r == ""
+}
+
 // String returns the signature's string representation.
 func (s Signature) String() string {
 	return s.str
@@ -97,3 +97,29 @@ func TestStoreNested(t *testing.T) {
 			dest, src)
 	}
 }
+
+func TestStoreFD(t *testing.T) {
+	src := []interface{}{
+		UnixFD(3),
+		map[string]UnixFD{"a": 4},
+		[]interface{}{"b", UnixFD(5)},
+	}
+	var fd *FD
+	var m map[string]FD
+	var s struct {
+		S  string
+		FD FD
+	}
+	if err := Store(src, &fd, &m, &s); err != nil {
+		t.Fatal(err)
+	}
+	if fd.Fd() != 3 || m["a"].fd != NewFD(4).fd || s.S != "b" || s.FD.fd != NewFD(5).fd {
+		t.Errorf("got %v, %v, %+v", fd, m, &s)
+	}
+	if new(FD).Fd() != -1 {
+		t.Error("zero FD is not closed")
+	}
+	if got := SignatureOf(FD{}, []*FD{}); got.String() != "hah" {
+		t.Errorf("got signature %v, want hah", got)
+	}
+}
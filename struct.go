@@ -0,0 +1,265 @@
+package dbus
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// A structField is a field of a struct that is encoded.
+type structField struct {
+	// index is the index sequence of the field for FieldByIndex.
+	index []int
+	// name is the key of the field in dictionaries.
+	name string
+	// sig is the signature that the field is encoded with, or "" if it is
+	// the signature of its type.
+	sig string
+	// omitEmpty omits the field from dictionaries if it has its zero value.
+	omitEmpty bool
+}
+
+// structInfo describes how values of a struct type are encoded.
+type structInfo struct {
+	fields []structField
+	// dict is set if the struct is encoded as a dictionary of the type a{sv}
+	// instead of a STRUCT.
+	dict bool
+	// err is the error in the tags of the fields, if any. It prevents values
+	// of the struct from being encoded, but not from being stored into.
+	err error
+}
+
+var structInfos sync.Map // map[reflect.Type]*structInfo
+
+// getStructInfo returns the encoding of the struct type t, as given by the tags
+// of its fields. Unknown tag options are ignored.
+func getStructInfo(t reflect.Type) *structInfo {
+	if info, ok := structInfos.Load(t); ok {
+		return info.(*structInfo)
+	}
+	info := new(structInfo)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("dbus")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		if field.Anonymous && hasOption(opts[1:], "inline") && isPlainStruct(field.Type) {
+			// The fields of inlined structs are encoded as if they were
+			// fields of t.
+			embedded := getStructInfo(field.Type)
+			for _, f := range embedded.fields {
+				f.index = append([]int{i}, f.index...)
+				info.fields = append(info.fields, f)
+			}
+			info.dict = info.dict || embedded.dict
+			if info.err == nil {
+				info.err = embedded.err
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		f := structField{index: []int{i}, name: opts[0]}
+		if f.name == "" {
+			f.name = field.Name
+		}
+		for _, opt := range opts[1:] {
+			switch {
+			case opt == "dict":
+				info.dict = true
+			case opt == "omitempty":
+				f.omitEmpty = true
+			case strings.HasPrefix(opt, "signature="):
+				sig, err := ParseSignature(strings.TrimPrefix(opt, "signature="))
+				if err == nil && !isSingle(sig.str) {
+					err = SignatureError{Sig: sig.str, Reason: "not a single complete type"}
+				}
+				if err != nil {
+					if info.err == nil {
+						info.err = fmt.Errorf("dbus: field %s of %s: %v", field.Name, t, err)
+					}
+					continue
+				}
+				f.sig = sig.str
+			}
+		}
+		info.fields = append(info.fields, f)
+	}
+	structInfos.Store(t, info)
+	return info
+}
+
+// hasOption returns whether opts contains the option opt.
+func hasOption(opts []string, opt string) bool {
+	for _, o := range opts {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// isPlainStruct returns whether t is a struct type that is encoded by its
+// fields, unlike Variant, Signature and FD.
+func isPlainStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != variantType && t != signatureType && t != fdType
+}
+
+// isDictStruct returns whether t is a struct type that is encoded as a
+// dictionary.
+func isDictStruct(t reflect.Type) bool {
+	return isPlainStruct(t) && getStructInfo(t).dict
+}
+
+// structSignature returns the signature of the struct type t. It panics if the
+// tags of t are invalid.
+func structSignature(t reflect.Type) string {
+	info := getStructInfo(t)
+	if info.err != nil {
+		panic(info.err)
+	}
+	if info.dict {
+		return "a{sv}"
+	}
+	var s string
+	for _, f := range info.fields {
+		if f.sig != "" {
+			s += f.sig
+		} else {
+			s += getSignature(t.FieldByIndex(f.index).Type)
+		}
+	}
+	return "(" + s + ")"
+}
+
+// structValues returns the values of the members of the STRUCT that the struct
+// v is encoded as.
+func structValues(v reflect.Value) []reflect.Value {
+	info := getStructInfo(v.Type())
+	if info.err != nil {
+		panic(info.err)
+	}
+	vs := make([]reflect.Value, len(info.fields))
+	for i, f := range info.fields {
+		vs[i] = v.FieldByIndex(f.index)
+		if f.sig != "" {
+			vs[i] = convertToSignature(vs[i], f.sig)
+		}
+	}
+	return vs
+}
+
+// structDict returns the dictionary that the struct v is encoded as if it is a
+// dict struct.
+func structDict(v reflect.Value) map[string]Variant {
+	info := getStructInfo(v.Type())
+	if info.err != nil {
+		panic(info.err)
+	}
+	m := make(map[string]Variant, len(info.fields))
+	for _, f := range info.fields {
+		fv := v.FieldByIndex(f.index)
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		if f.sig != "" {
+			m[f.name] = Variant{Signature{f.sig}, convertToSignature(fv, f.sig).Interface()}
+		} else {
+			m[f.name] = MakeVariant(fv.Interface())
+		}
+	}
+	return m
+}
+
+// storeDictStruct stores the dictionary src into the dict struct dest. Fields
+// whose keys are missing from src are left unchanged.
+func storeDictStruct(dest, src reflect.Value) error {
+	if src.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("dbus.Store: type mismatch: cannot store %s into %s", src.Type(), dest.Type())
+	}
+	for _, f := range getStructInfo(dest.Type()).fields {
+		v := src.MapIndex(reflect.ValueOf(f.name).Convert(src.Type().Key()))
+		if !v.IsValid() {
+			continue
+		}
+		if v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+		if err := store(dest.FieldByIndex(f.index), v); err != nil {
+			return fmt.Errorf("dbus.Store: field %s: %v", f.name, err)
+		}
+	}
+	return nil
+}
+
+// convertToSignature converts v to the type of the values with the signature
+// sig, e.g. a string to an ObjectPath for "o". It panics if this isn't
+// possible.
+func convertToSignature(v reflect.Value, sig string) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if getSignature(v.Type()) == sig {
+		return v
+	}
+	switch sig[0] {
+	case 'g':
+		if v.Kind() == reflect.String {
+			s, err := ParseSignature(v.String())
+			if err != nil {
+				panic(err)
+			}
+			return reflect.ValueOf(s)
+		}
+	case 'v':
+		return reflect.ValueOf(MakeVariant(v.Interface()))
+	case 'h':
+		if v.Type().ConvertibleTo(unixFDType) {
+			return v.Convert(unixFDType)
+		}
+	case 'a':
+		if sig[1] != '{' && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) {
+			s := reflect.MakeSlice(typeFor(sig), v.Len(), v.Len())
+			for i := 0; i < v.Len(); i++ {
+				s.Index(i).Set(convertToSignature(v.Index(i), sig[1:]))
+			}
+			return s
+		}
+	case 's', 'o':
+		if v.Kind() == reflect.String {
+			return v.Convert(typeFor(sig))
+		}
+	case 'y', 'n', 'q', 'i', 'u', 'x', 't', 'd':
+		if v.Kind() != reflect.String && v.Type().ConvertibleTo(typeFor(sig)) {
+			return v.Convert(typeFor(sig))
+		}
+	}
+	panic(errors.New("dbus: cannot encode " + v.Type().String() + " with signature " + sig))
+}
+
+// isEmptyValue returns whether v is empty in the sense of the omitempty
+// option: false, 0, a nil pointer or interface and an empty string, slice or
+// map.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package dbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+type tagIPv4 struct {
+	Method    string   `dbus:"method,dict"`
+	Addresses []string `dbus:"addresses,omitempty"`
+	Gateway   *string  `dbus:"gateway,omitempty"`
+	MTU       uint32   `dbus:",omitempty"`
+	Ignored   string   `dbus:"-"`
+}
+
+type tagBase struct {
+	Name string
+	Path string `dbus:",signature=o"`
+}
+
+type tagStruct struct {
+	tagBase `dbus:",inline"`
+	Sig     string   `dbus:",signature=g"`
+	Paths   []string `dbus:",signature=ao"`
+	Count   int      `dbus:",signature=u"`
+	IPv4    tagIPv4
+}
+
+func encodeDecode(t *testing.T, v interface{}) []interface{} {
+	buf := new(bytes.Buffer)
+	enc := newEncoder(buf, binary.LittleEndian)
+	if err := enc.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	dec := newDecoder(buf, binary.LittleEndian)
+	vs, err := dec.Decode(SignatureOf(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vs
+}
+
+func TestStructTagsSignature(t *testing.T) {
+	if sig := SignatureOf(tagIPv4{}).String(); sig != "a{sv}" {
+		t.Errorf("got %s, want a{sv}", sig)
+	}
+	if sig := SignatureOf(tagStruct{}).String(); sig != "(sogaoua{sv})" {
+		t.Errorf("got %s, want (sogaoua{sv})", sig)
+	}
+	if sig := SignatureOf(map[string]tagIPv4{}).String(); sig != "a{sa{sv}}" {
+		t.Errorf("got %s, want a{sa{sv}}", sig)
+	}
+}
+
+func TestStructTagsDict(t *testing.T) {
+	gw := "10.0.0.1"
+	v := tagIPv4{Method: "manual", Gateway: &gw, Ignored: "x"}
+	vs := encodeDecode(t, v)
+	want := map[string]Variant{
+		"method":  MakeVariant("manual"),
+		"gateway": MakeVariant("10.0.0.1"),
+	}
+	if !reflect.DeepEqual(vs[0], want) {
+		t.Errorf("got %v, want %v", vs[0], want)
+	}
+
+	var got tagIPv4
+	if err := Store(vs, &got); err != nil {
+		t.Fatal(err)
+	}
+	v.Ignored = ""
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("got %+v, want %+v", got, v)
+	}
+
+	src := map[string]Variant{
+		"method":    MakeVariant("auto"),
+		"addresses": MakeVariant([]string{"10.0.0.2/8"}),
+		"MTU":       MakeVariant(uint32(1500)),
+		"unknown":   MakeVariant(true),
+	}
+	got = tagIPv4{}
+	if err := Store([]interface{}{src}, &got); err != nil {
+		t.Fatal(err)
+	}
+	want2 := tagIPv4{Method: "auto", Addresses: []string{"10.0.0.2/8"}, MTU: 1500}
+	if !reflect.DeepEqual(got, want2) {
+		t.Errorf("got %+v, want %+v", got, want2)
+	}
+
+	var m map[string]tagIPv4
+	if err := Store([]interface{}{map[string]map[string]Variant{"ipv4": src}}, &m); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m["ipv4"], want2) {
+		t.Errorf("got %+v, want %+v", m["ipv4"], want2)
+	}
+
+	src["MTU"] = MakeVariant("large")
+	if err := Store([]interface{}{src}, &got); err == nil {
+		t.Error("storing a string into a uint32 field succeeded")
+	}
+}
+
+func TestStructTagsStruct(t *testing.T) {
+	v := tagStruct{
+		tagBase: tagBase{"name", "/org/godbus"},
+		Sig:     "a{sv}",
+		Paths:   []string{"/a", "/b"},
+		Count:   3,
+		IPv4:    tagIPv4{Method: "auto"},
+	}
+	vs := encodeDecode(t, v)
+	want := []interface{}{
+		"name",
+		ObjectPath("/org/godbus"),
+		Signature{"a{sv}"},
+		[]ObjectPath{"/a", "/b"},
+		uint32(3),
+		map[string]Variant{"method": MakeVariant("auto")},
+	}
+	if !reflect.DeepEqual(vs[0], want) {
+		t.Errorf("got %#v, want %#v", vs[0], want)
+	}
+	var got tagStruct
+	if err := Store(vs, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("got %+v, want %+v", got, v)
+	}
+}
+
+func TestStructTagsInvalid(t *testing.T) {
+	for _, v := range []interface{}{
+		struct {
+			A string `dbus:",signature=x"`
+		}{"foo"},
+		struct {
+			A string `dbus:",signature=ii"`
+		}{},
+	} {
+		buf := new(bytes.Buffer)
+		if err := newEncoder(buf, binary.LittleEndian).Encode(v); err == nil {
+			t.Errorf("encoding %#v succeeded", v)
+		}
+	}
+}
+
+type TagEmbedded struct {
+	A, B int32
+}
+
+type tagEmbedded struct {
+	A int32
+}
+
+func TestStructTagsEmbedded(t *testing.T) {
+	v := struct {
+		TagEmbedded
+		tagEmbedded
+		S string
+	}{TagEmbedded{1, 2}, tagEmbedded{3}, "foo"}
+	if sig := SignatureOf(v).String(); sig != "((ii)s)" {
+		t.Errorf("got %s, want ((ii)s)", sig)
+	}
+	vs := encodeDecode(t, v)
+	want := []interface{}{[]interface{}{int32(1), int32(2)}, "foo"}
+	if !reflect.DeepEqual(vs[0], want) {
+		t.Errorf("got %#v, want %#v", vs[0], want)
+	}
+}
+
+func TestStructTagsUnknownOption(t *testing.T) {
+	var v struct {
+		X string `dbus:"x,readonly"`
+	}
+	if err := Store([]interface{}{[]interface{}{"foo"}}, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.X != "foo" {
+		t.Errorf("got %q, want foo", v.X)
+	}
+	if sig := SignatureOf(v).String(); sig != "(s)" {
+		t.Errorf("got %s, want (s)", sig)
+	}
+}
+
+func TestStructTagsGVariant(t *testing.T) {
+	v := tagIPv4{Method: "auto", MTU: 1500}
+	b, err := MarshalGVariant(v, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := MarshalGVariant(map[string]Variant{
+		"method": MakeVariant("auto"),
+		"MTU":    MakeVariant(uint32(1500)),
+	}, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, want) {
+		t.Errorf("got %x, want %x", b, want)
+	}
+	var got tagIPv4
+	if err := UnmarshalGVariant(b, Signature{"a{sv}"}, binary.LittleEndian, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("got %+v, want %+v", got, v)
+	}
+}
@@ -0,0 +1,417 @@
+package dbus
+
+import (
+	"context"
+	"sync"
+)
+
+// Subscription is a match rule installed with Subscribe together with the
+// channel that the signals matching it are delivered to.
+type Subscription struct {
+	// C receives the signals that match the rule of the subscription, in
+	// the order in which they were received. Signals are buffered until
+	// they are read. C is closed when the subscription or the connection is
+	// closed.
+	C <-chan *Signal
+
+	conn  *Conn
+	rule  *MatchRule
+	queue *signalQueue
+	owner string // well-known sender name whose owner is tracked
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Subscribe adds a match rule for signals built from options to the bus and
+// returns a Subscription that receives exactly the signals matching it, as
+// opposed to the channels registered with Signal, which receive all signals.
+//
+// Subscriptions with identical rules share a single rule on the bus, which
+// is removed once the last of them is closed. The subscription is closed
+// automatically when ctx is done; ctx is also used for the AddMatch call.
+func (conn *Conn) Subscribe(ctx context.Context, options ...MatchOption) (*Subscription, error) {
+	rule, err := newMatchRule(append([]MatchOption{withMatchType("signal")}, options...), true)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := newSignalQueue()
+	sub := &Subscription{
+		C:     queue.ch,
+		conn:  conn,
+		rule:  rule,
+		queue: queue,
+	}
+	if rule.Sender != "" && rule.Sender[0] != ':' && rule.Sender != "org.freedesktop.DBus" {
+		// Signals carry the unique name of their sender, so the owner of
+		// the well-known name has to be known to match them.
+		if err := conn.subs.watchOwner(ctx, conn, rule.Sender); err != nil {
+			queue.close()
+			return nil, err
+		}
+		sub.owner = rule.Sender
+	}
+	if err := conn.subs.addMatch(ctx, conn, rule.String()); err != nil {
+		queue.close()
+		if sub.owner != "" {
+			conn.subs.unwatchOwner(conn, sub.owner)
+		}
+		return nil, err
+	}
+	if !conn.subs.add(sub) {
+		queue.close()
+		sub.release()
+		return nil, ErrClosed
+	}
+
+	if done := ctx.Done(); done != nil {
+		go func() {
+			select {
+			case <-done:
+				sub.Close()
+			case <-queue.done:
+			}
+		}()
+	}
+	return sub, nil
+}
+
+// Close removes the subscription, closes its channel and removes the match
+// rule from the bus if no other subscription uses it. Calling Close more
+// than once has no effect.
+func (sub *Subscription) Close() error {
+	sub.closeOnce.Do(func() {
+		sub.conn.subs.remove(sub)
+		sub.queue.close()
+		sub.closeErr = sub.release()
+	})
+	return sub.closeErr
+}
+
+// release removes the bus rules that were added for the subscription.
+func (sub *Subscription) release() error {
+	err := sub.conn.subs.removeMatch(sub.conn, sub.rule.String())
+	if sub.owner != "" {
+		sub.conn.subs.unwatchOwner(sub.conn, sub.owner)
+	}
+	return err
+}
+
+// Rule returns the match rule of the subscription. It must not be modified.
+func (sub *Subscription) Rule() *MatchRule {
+	return sub.rule
+}
+
+// subscriptionTracker keeps track of the subscriptions of a connection and
+// the reference counts of the match rules they added to the bus.
+type subscriptionTracker struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	owners map[string]*trackedOwner
+	closed bool
+
+	// matchMu serializes changes to the rules on the bus.
+	matchMu sync.Mutex
+	rules   map[string]int
+	watched map[string]int
+
+	// rules added with AddMatchSignal, for restoring them after reconnecting
+	signalRules map[string]int
+}
+
+// trackedOwner is the owner of a well-known name as learned from the message
+// with the given sequence.
+type trackedOwner struct {
+	owner    string
+	sequence Sequence
+}
+
+func newSubscriptionTracker() *subscriptionTracker {
+	return &subscriptionTracker{
+		subs:        make(map[*Subscription]struct{}),
+		owners:      make(map[string]*trackedOwner),
+		rules:       make(map[string]int),
+		watched:     make(map[string]int),
+		signalRules: make(map[string]int),
+	}
+}
+
+func (tracker *subscriptionTracker) add(sub *Subscription) bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if tracker.closed {
+		return false
+	}
+	tracker.subs[sub] = struct{}{}
+	return true
+}
+
+func (tracker *subscriptionTracker) remove(sub *Subscription) bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if _, ok := tracker.subs[sub]; !ok {
+		return false
+	}
+	delete(tracker.subs, sub)
+	return true
+}
+
+// addMatch adds rule to the bus unless it was already added.
+func (tracker *subscriptionTracker) addMatch(ctx context.Context, conn *Conn, rule string) error {
+	tracker.matchMu.Lock()
+	defer tracker.matchMu.Unlock()
+	if tracker.rules[rule] == 0 {
+		err := conn.busObj.CallWithContext(ctx, "org.freedesktop.DBus.AddMatch", 0, rule).Store()
+		if err != nil {
+			return err
+		}
+	}
+	tracker.rules[rule]++
+	return nil
+}
+
+// removeMatch removes rule from the bus if it isn't used anymore.
+func (tracker *subscriptionTracker) removeMatch(conn *Conn, rule string) error {
+	tracker.matchMu.Lock()
+	defer tracker.matchMu.Unlock()
+	tracker.rules[rule]--
+	if tracker.rules[rule] > 0 {
+		return nil
+	}
+	delete(tracker.rules, rule)
+	return conn.busObj.Call("org.freedesktop.DBus.RemoveMatch", 0, rule).Store()
+}
+
+func ownerChangedRule(name string) string {
+	r := MatchRule{
+		Type:      TypeSignal,
+		Sender:    "org.freedesktop.DBus",
+		Interface: "org.freedesktop.DBus",
+		Member:    "NameOwnerChanged",
+		Args:      map[int]string{0: name},
+	}
+	return r.String()
+}
+
+// watchOwner starts tracking the owner of the well-known name.
+func (tracker *subscriptionTracker) watchOwner(ctx context.Context, conn *Conn, name string) error {
+	tracker.matchMu.Lock()
+	tracker.watched[name]++
+	tracker.mu.Lock()
+	if tracker.owners[name] == nil {
+		tracker.owners[name] = &trackedOwner{}
+	}
+	tracker.mu.Unlock()
+	tracker.matchMu.Unlock()
+	if err := tracker.addMatch(ctx, conn, ownerChangedRule(name)); err != nil {
+		tracker.matchMu.Lock()
+		tracker.unwatch(name)
+		tracker.matchMu.Unlock()
+		return err
+	}
+
+	if err := tracker.updateOwner(ctx, conn, name); err != nil {
+		tracker.unwatchOwner(conn, name)
+		return err
+	}
+	return nil
+}
+
+// updateOwner queries the current owner of name.
+func (tracker *subscriptionTracker) updateOwner(ctx context.Context, conn *Conn, name string) error {
+	var owner string
+	call := conn.busObj.CallWithContext(ctx, "org.freedesktop.DBus.GetNameOwner", 0, name)
+	if err := call.Store(&owner); err != nil {
+		if e, ok := err.(Error); !ok || e.Name != "org.freedesktop.DBus.Error.NameHasNoOwner" {
+			return err
+		}
+	}
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	// A NameOwnerChanged signal received after the reply is more recent.
+	if o := tracker.owners[name]; o != nil && o.sequence < call.ResponseSequence {
+		o.owner = owner
+		o.sequence = call.ResponseSequence
+	}
+	return nil
+}
+
+// unwatchOwner stops tracking the owner of the well-known name if no other
+// subscription needs it.
+func (tracker *subscriptionTracker) unwatchOwner(conn *Conn, name string) {
+	tracker.matchMu.Lock()
+	tracker.unwatch(name)
+	tracker.matchMu.Unlock()
+	tracker.removeMatch(conn, ownerChangedRule(name))
+}
+
+// unwatch decrements the reference count of name and forgets its owner once
+// it drops to zero. tracker.matchMu must be locked.
+func (tracker *subscriptionTracker) unwatch(name string) {
+	tracker.watched[name]--
+	if tracker.watched[name] > 0 {
+		return
+	}
+	delete(tracker.watched, name)
+	tracker.mu.Lock()
+	delete(tracker.owners, name)
+	tracker.mu.Unlock()
+}
+
+// recordSignalRule adjusts the number of times that rule was added with
+// AddMatchSignal by delta.
+func (tracker *subscriptionTracker) recordSignalRule(rule string, delta int) {
+	tracker.matchMu.Lock()
+	defer tracker.matchMu.Unlock()
+	tracker.signalRules[rule] += delta
+	if tracker.signalRules[rule] <= 0 {
+		delete(tracker.signalRules, rule)
+	}
+}
+
+// listRules returns all rules that were added to the bus, as often as they
+// were added.
+func (tracker *subscriptionTracker) listRules() []string {
+	tracker.matchMu.Lock()
+	defer tracker.matchMu.Unlock()
+	var rules []string
+	for rule := range tracker.rules {
+		rules = append(rules, rule)
+	}
+	for rule, n := range tracker.signalRules {
+		for i := 0; i < n; i++ {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// refreshOwners queries the owners of all tracked names again.
+func (tracker *subscriptionTracker) refreshOwners(conn *Conn) error {
+	tracker.mu.RLock()
+	names := make([]string, 0, len(tracker.owners))
+	for name := range tracker.owners {
+		names = append(names, name)
+	}
+	tracker.mu.RUnlock()
+	for _, name := range names {
+		if err := tracker.updateOwner(context.Background(), conn, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleSignal delivers signal, which was received in msg, to the matching
+// subscriptions.
+func (tracker *subscriptionTracker) handleSignal(msg *Message, signal *Signal) {
+	if signal.Sender == "org.freedesktop.DBus" && signal.Name == "org.freedesktop.DBus.NameOwnerChanged" {
+		var name, oldOwner, newOwner string
+		if Store(msg.Body, &name, &oldOwner, &newOwner) == nil {
+			tracker.mu.Lock()
+			if o := tracker.owners[name]; o != nil {
+				o.owner = newOwner
+				o.sequence = signal.Sequence
+			}
+			tracker.mu.Unlock()
+		}
+	}
+
+	tracker.mu.RLock()
+	defer tracker.mu.RUnlock()
+	ownsName := func(sender, name string) bool {
+		o := tracker.owners[name]
+		return o != nil && o.owner != "" && o.owner == sender
+	}
+	for sub := range tracker.subs {
+		if sub.rule.MatchesOwner(msg, ownsName) {
+			sub.queue.deliver(signal)
+		}
+	}
+}
+
+// terminate closes all subscriptions when the connection is closed.
+func (tracker *subscriptionTracker) terminate() {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	tracker.closed = true
+	for sub := range tracker.subs {
+		sub.queue.close()
+	}
+	tracker.subs = make(map[*Subscription]struct{})
+}
+
+// signalQueue delivers signals to a channel in the order in which they were
+// received, buffering as many as necessary.
+type signalQueue struct {
+	ch       chan *Signal
+	done     chan struct{} // closed by close
+	finished chan struct{} // closed when run returns
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	signals []*Signal
+	closed  bool
+}
+
+func newSignalQueue() *signalQueue {
+	q := &signalQueue{
+		ch:       make(chan *Signal),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	go q.run()
+	return q
+}
+
+func (q *signalQueue) deliver(signal *Signal) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.signals = append(q.signals, signal)
+	q.cond.Signal()
+}
+
+func (q *signalQueue) run() {
+	defer close(q.finished)
+	defer close(q.ch)
+	for {
+		q.mu.Lock()
+		for len(q.signals) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		signal := q.signals[0]
+		q.signals[0] = nil
+		q.signals = q.signals[1:]
+		q.mu.Unlock()
+
+		select {
+		case q.ch <- signal:
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// close discards the queued signals and closes the channel.
+func (q *signalQueue) close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	q.signals = nil
+	close(q.done)
+	q.cond.Signal()
+	q.mu.Unlock()
+	<-q.finished
+}
@@ -0,0 +1,162 @@
+package dbus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	conn, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	foo, err := conn.Subscribe(context.Background(),
+		WithMatchInterface("org.test"), WithMatchMember("Foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer foo.Close()
+	bar, err := conn.Subscribe(context.Background(),
+		WithMatchInterface("org.test"), WithMatchMember("Bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bar.Close()
+
+	if err = conn.Emit("/", "org.test.Bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Emit("/", "org.test.Foo"); err != nil {
+		t.Fatal(err)
+	}
+	if sig := waitSignal(foo.C, "org.test.Foo", time.Second); sig == nil {
+		t.Fatal("signal receive timed out")
+	}
+	select {
+	case sig := <-foo.C:
+		t.Errorf("subscription received unrelated signal %s", sig.Name)
+	default:
+	}
+	if sig := waitSignal(bar.C, "org.test.Bar", time.Second); sig == nil {
+		t.Fatal("signal receive timed out")
+	}
+}
+
+func TestSubscribeRefcount(t *testing.T) {
+	conn, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	opts := []MatchOption{WithMatchInterface("org.test"), WithMatchMember("Refcount")}
+	sub1, err := conn.Subscribe(context.Background(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sub2, err := conn.Subscribe(ctx, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancelling the context closes sub2, but the rule stays on the bus
+	// for sub1.
+	cancel()
+	select {
+	case _, ok := <-sub2.C:
+		if ok {
+			t.Fatal("received signal on cancelled subscription")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription wasn't closed when its context was cancelled")
+	}
+	if err = conn.Emit("/", "org.test.Refcount"); err != nil {
+		t.Fatal(err)
+	}
+	if sig := waitSignal(sub1.C, "org.test.Refcount", time.Second); sig == nil {
+		t.Fatal("signal receive timed out")
+	}
+
+	if err = sub1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	err = conn.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, sub1.Rule().String()).Err
+	if err == nil {
+		t.Error("match rule wasn't removed after closing the last subscription")
+	}
+}
+
+func TestSubscribeWellKnownSender(t *testing.T) {
+	srv, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	other, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	conn, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const name = "org.godbus.DBus.SubscribeTest"
+	if _, err = srv.RequestName(name, 0); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := conn.Subscribe(context.Background(),
+		WithMatchSender(name), WithMatchInterface("org.test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	// A catch-all rule makes the bus deliver signals of other senders too.
+	all, err := conn.Subscribe(context.Background(), WithMatchInterface("org.test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer all.Close()
+
+	if err = other.Emit("/", "org.test.Other"); err != nil {
+		t.Fatal(err)
+	}
+	if sig := waitSignal(all.C, "org.test.Other", time.Second); sig == nil {
+		t.Fatal("signal receive timed out")
+	}
+	if err = srv.Emit("/", "org.test.Owner"); err != nil {
+		t.Fatal(err)
+	}
+	// Other was delivered before Owner, so it would arrive first if the
+	// sender wasn't checked.
+	select {
+	case sig := <-sub.C:
+		if sig.Name != "org.test.Owner" || sig.Sender != srv.Names()[0] {
+			t.Errorf("got signal %s from %s, want org.test.Owner from %s",
+				sig.Name, sig.Sender, srv.Names()[0])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("signal receive timed out")
+	}
+}
+
+func TestSubscribeInvalidArgIndex(t *testing.T) {
+	conn, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.AddMatchSignal(WithMatchArg(64, "x")); err == nil {
+		t.Error("AddMatchSignal with argument index 64 succeeded")
+	}
+	if _, err := conn.Subscribe(context.Background(), WithMatchArgPath(-1, "/")); err == nil {
+		t.Error("Subscribe with argument index -1 succeeded")
+	}
+}
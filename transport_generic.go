@@ -1,6 +1,7 @@
 package dbus
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"io"
@@ -41,10 +42,14 @@ func (t genericTransport) ReadMessage() (*Message, error) {
 }
 
 func (t genericTransport) SendMessage(msg *Message) error {
-	for _, v := range msg.Body {
-		if _, ok := v.(UnixFD); ok {
-			return errors.New("dbus: unix fd passing not enabled")
-		}
+	buf := new(bytes.Buffer)
+	fds, err := msg.encodeWithFDs(buf, nativeEndian)
+	if err != nil {
+		return err
 	}
-	return msg.EncodeTo(t, nativeEndian)
+	if len(fds) != 0 {
+		return errors.New("dbus: unix fd passing not enabled")
+	}
+	_, err = buf.WriteTo(t)
+	return err
 }
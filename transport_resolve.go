@@ -0,0 +1,151 @@
+package dbus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The transports in this file don't connect by themselves, but resolve their
+// address to the address of another transport.
+func init() {
+	transports["systemd"] = newSystemdTransport
+	transports["launchd"] = newLaunchdTransport
+	transports["autolaunch"] = newAutolaunchTransport
+}
+
+var execCommand = exec.Command
+
+// machineIDFiles are the files that the machine ID is read from, in order.
+var machineIDFiles = []string{"/var/lib/dbus/machine-id", "/etc/machine-id"}
+
+func newSystemdTransport(keys string) (transport, error) {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return nil, errors.New("dbus: invalid address (systemd requires XDG_RUNTIME_DIR)")
+	}
+	return getTransport("unix:path=" + filepath.Join(dir, "bus"))
+}
+
+func newLaunchdTransport(keys string) (transport, error) {
+	env, err := unescapeAddressValue(getKey(keys, "env"))
+	if err != nil {
+		return nil, err
+	}
+	if env == "" {
+		return nil, errors.New("dbus: invalid address (env not set)")
+	}
+	address, err := launchdAddress(env)
+	if err != nil {
+		return nil, err
+	}
+	return getTransport(address)
+}
+
+// launchdAddress returns the address of the socket whose path launchd
+// stores in the environment variable env.
+func launchdAddress(env string) (string, error) {
+	b, err := execCommand("launchctl", "getenv", env).Output()
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimRight(string(b), "\n")
+	if path == "" {
+		return "", fmt.Errorf("dbus: launchd variable %s is not set", env)
+	}
+	return "unix:path=" + path, nil
+}
+
+// newAutolaunchTransport connects to the session bus that dbus-launch started
+// for this machine, as recorded in ~/.dbus/session-bus, or otherwise finds or
+// starts the session bus in the same way as SessionBus.
+func newAutolaunchTransport(keys string) (transport, error) {
+	if address := sessionBusFileAddress(); address != "" {
+		if t, err := getTransport(address); err == nil {
+			return t, nil
+		}
+	}
+	address, err := getSessionBusPlatformAddress()
+	if err != nil {
+		return nil, err
+	}
+	return getTransport(address)
+}
+
+// sessionBusFileAddress returns the address stored in the file that dbus-launch
+// writes to ~/.dbus/session-bus for the machine and, if DISPLAY is set, for
+// the X display. It returns an empty string if there is none.
+func sessionBusFileAddress() string {
+	id := machineID()
+	if id == "" {
+		return ""
+	}
+	dir := filepath.Join(getHomeDir(), ".dbus", "session-bus")
+	var files []string
+	if display := displayNumber(os.Getenv("DISPLAY")); display != "" {
+		files = []string{filepath.Join(dir, id+"-"+display)}
+	} else {
+		files, _ = filepath.Glob(filepath.Join(dir, id+"-*"))
+	}
+	for _, name := range files {
+		if address := readSessionBusFile(name); address != "" {
+			return address
+		}
+	}
+	return ""
+}
+
+// readSessionBusFile returns the value of DBUS_SESSION_BUS_ADDRESS in the named
+// file written by dbus-launch.
+func readSessionBusFile(name string) string {
+	f, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "DBUS_SESSION_BUS_ADDRESS=") {
+			address := strings.TrimPrefix(line, "DBUS_SESSION_BUS_ADDRESS=")
+			return strings.Trim(address, "'\"")
+		}
+	}
+	return ""
+}
+
+// displayNumber returns the number of the X display named by display, which
+// has the format [host]:number[.screen].
+func displayNumber(display string) string {
+	i := strings.LastIndex(display, ":")
+	if i == -1 {
+		return ""
+	}
+	n := display[i+1:]
+	if j := strings.Index(n, "."); j != -1 {
+		n = n[:j]
+	}
+	return n
+}
+
+// machineID returns the D-Bus machine ID, or an empty string if it can't be
+// read.
+func machineID() string {
+	for _, name := range machineIDFiles {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		s := bufio.NewScanner(f)
+		s.Scan()
+		f.Close()
+		if id := strings.TrimSpace(s.Text()); id != "" {
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package dbus
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// listenUnix listens on a socket in dir and returns its path.
+func listenUnix(t *testing.T, dir, name string) (string, net.Listener) {
+	path := filepath.Join(dir, name)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	return path, l
+}
+
+func setenv(key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestSystemdTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbus-systemd-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, l := listenUnix(t, dir, "bus")
+	defer l.Close()
+
+	defer setenv("XDG_RUNTIME_DIR", dir)()
+	conn, err := Dial("systemd:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	os.Unsetenv("XDG_RUNTIME_DIR")
+	if _, err := Dial("systemd:"); err == nil {
+		t.Error("Dial succeeded without XDG_RUNTIME_DIR")
+	}
+}
+
+func TestLaunchdTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbus-launchd-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path, l := listenUnix(t, dir, "socket")
+	defer l.Close()
+
+	execCommand = fakeExecCommand
+	defer func() { execCommand = exec.Command }()
+	mockedExitStatus = 0
+	mockedStdout = path + "\n"
+	conn, err := Dial("launchd:env=DBUS_LAUNCHD_SESSION_BUS_SOCKET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	mockedStdout = ""
+	if _, err := Dial("launchd:env=DBUS_LAUNCHD_SESSION_BUS_SOCKET"); err == nil {
+		t.Error("Dial succeeded for unset variable")
+	}
+	if _, err := Dial("launchd:"); err == nil {
+		t.Error("Dial succeeded without env")
+	}
+}
+
+func TestAutolaunchTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbus-autolaunch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path, l := listenUnix(t, dir, "socket")
+	defer l.Close()
+
+	idFile := filepath.Join(dir, "machine-id")
+	if err := ioutil.WriteFile(idFile, []byte("0123456789abcdef\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldIDFiles := machineIDFiles
+	machineIDFiles = []string{filepath.Join(dir, "nonexistent"), idFile}
+	defer func() { machineIDFiles = oldIDFiles }()
+	homeDirLock.Lock()
+	oldHomeDir := homeDir
+	homeDir = dir
+	homeDirLock.Unlock()
+	defer func() {
+		homeDirLock.Lock()
+		homeDir = oldHomeDir
+		homeDirLock.Unlock()
+	}()
+
+	sessionDir := filepath.Join(dir, ".dbus", "session-bus")
+	if err := os.MkdirAll(sessionDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := "# This file allows processes on the machine to find the bus.\n" +
+		"DBUS_SESSION_BUS_ADDRESS='unix:path=" + path + "'\n" +
+		"DBUS_SESSION_BUS_PID=1\n"
+	if err := ioutil.WriteFile(filepath.Join(sessionDir, "0123456789abcdef-1"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer setenv("DISPLAY", "")()
+	if got := sessionBusFileAddress(); got != "unix:path="+path {
+		t.Errorf("without display: got %q", got)
+	}
+	os.Setenv("DISPLAY", "localhost:1.0")
+	if got := sessionBusFileAddress(); got != "unix:path="+path {
+		t.Errorf("with display 1: got %q", got)
+	}
+	os.Setenv("DISPLAY", ":2")
+	if got := sessionBusFileAddress(); got != "" {
+		t.Errorf("with display 2: got %q, want none", got)
+	}
+
+	os.Setenv("DISPLAY", ":1")
+	conn, err := Dial("autolaunch:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
@@ -4,10 +4,14 @@ package dbus
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"io"
 	"net"
+	"os"
+	"path/filepath"
 	"syscall"
 )
 
@@ -63,6 +67,85 @@ func newUnixTransport(keys string) (transport, error) {
 
 func init() {
 	transports["unix"] = newUnixTransport
+	listeners["unix"] = newUnixListener
+}
+
+type unixListener struct {
+	*net.UnixListener
+	address string
+	// path is the path of the socket file, which is removed on Close, or ""
+	// for abstract sockets.
+	path string
+}
+
+func newUnixListener(keys string) (listener, error) {
+	var err error
+
+	l := new(unixListener)
+	abstract := getKey(keys, "abstract")
+	path := getKey(keys, "path")
+	dir := getKey(keys, "dir")
+	if dir == "" {
+		dir = getKey(keys, "tmpdir")
+	}
+	set := 0
+	for _, v := range []string{abstract, path, dir} {
+		if v != "" {
+			set++
+		}
+	}
+	switch {
+	case set == 0:
+		return nil, errors.New("dbus: invalid address (neither path, abstract, dir nor tmpdir set)")
+	case set > 1:
+		return nil, errors.New("dbus: invalid address (more than one of path, abstract, dir and tmpdir set)")
+	case abstract != "":
+		l.UnixListener, err = net.ListenUnix("unix", &net.UnixAddr{Name: "@" + abstract, Net: "unix"})
+		l.address = "unix:abstract=" + abstract
+	default:
+		if dir != "" {
+			b := make([]byte, 8)
+			if _, err = rand.Read(b); err != nil {
+				return nil, err
+			}
+			path = filepath.Join(dir, "dbus-"+hex.EncodeToString(b))
+		}
+		l.UnixListener, err = net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+		l.address = "unix:path=" + path
+		l.path = path
+	}
+	if err != nil {
+		return nil, err
+	}
+	if l.path != "" {
+		// The socket file is removed by Close below.
+		l.UnixListener.SetUnlinkOnClose(false)
+	}
+	return l, nil
+}
+
+func (l *unixListener) Close() error {
+	if err := l.UnixListener.Close(); err != nil {
+		return err
+	}
+	if l.path != "" {
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *unixListener) Accept() (transport, error) {
+	c, err := l.UnixListener.AcceptUnix()
+	if err != nil {
+		return nil, err
+	}
+	return &unixTransport{UnixConn: c}, nil
+}
+
+func (l *unixListener) Address() string {
+	return l.address
 }
 
 func (t *unixTransport) EnableUnixFDs() {
@@ -147,31 +230,12 @@ func (t *unixTransport) ReadMessage() (*Message, error) {
 		if err != nil {
 			return nil, err
 		}
-		msg, err := DecodeMessage(bytes.NewBuffer(all))
+		msg, err := decodeMessageWithFDs(bytes.NewBuffer(all), fds)
 		if err != nil {
-			return nil, err
-		}
-		// substitute the values in the message body (which are indices for the
-		// array receiver via OOB) with the actual values
-		for i, v := range msg.Body {
-			switch v.(type) {
-			case UnixFDIndex:
-				j := v.(UnixFDIndex)
-				if uint32(j) >= unixfds {
-					return nil, InvalidMessageError("invalid index for unix fd")
-				}
-				msg.Body[i] = UnixFD(fds[j])
-			case []UnixFDIndex:
-				idxArray := v.([]UnixFDIndex)
-				fdArray := make([]UnixFD, len(idxArray))
-				for k, j := range idxArray {
-					if uint32(j) >= unixfds {
-						return nil, InvalidMessageError("invalid index for unix fd")
-					}
-					fdArray[k] = UnixFD(fds[j])
-				}
-				msg.Body[i] = fdArray
+			for _, fd := range fds {
+				syscall.Close(fd)
 			}
+			return nil, err
 		}
 		return msg, nil
 	}
@@ -179,21 +243,16 @@ func (t *unixTransport) ReadMessage() (*Message, error) {
 }
 
 func (t *unixTransport) SendMessage(msg *Message) error {
-	fds := make([]int, 0)
-	for i, v := range msg.Body {
-		if fd, ok := v.(UnixFD); ok {
-			msg.Body[i] = UnixFDIndex(len(fds))
-			fds = append(fds, int(fd))
-		}
+	buf := new(bytes.Buffer)
+	fds, err := msg.encodeWithFDs(buf, nativeEndian)
+	if err != nil {
+		return err
 	}
 	if len(fds) != 0 {
 		if !t.hasUnixFDs {
 			return errors.New("dbus: unix fd passing not enabled")
 		}
-		msg.Headers[FieldUnixFDs] = MakeVariant(uint32(len(fds)))
 		oob := syscall.UnixRights(fds...)
-		buf := new(bytes.Buffer)
-		msg.EncodeTo(buf, nativeEndian)
 		n, oobn, err := t.UnixConn.WriteMsgUnix(buf.Bytes(), oob, nil)
 		if err != nil {
 			return err
@@ -202,7 +261,7 @@ func (t *unixTransport) SendMessage(msg *Message) error {
 			return io.ErrShortWrite
 		}
 	} else {
-		if err := msg.EncodeTo(t, nativeEndian); err != nil {
+		if _, err := buf.WriteTo(t); err != nil {
 			return err
 		}
 	}
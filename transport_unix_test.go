@@ -1,8 +1,13 @@
 package dbus
 
 import (
+	"context"
+	"io/ioutil"
 	"os"
+	"runtime"
+	"sync"
 	"testing"
+	"time"
 )
 
 const testString = `This is a test!
@@ -48,3 +53,289 @@ func TestUnixFDs(t *testing.T) {
 		t.Fatal("got", s, "wanted", testString)
 	}
 }
+
+type unixFDStruct struct {
+	Name string
+	FD   UnixFD
+}
+
+type unixFDNestedTest struct{}
+
+func readFD(fd UnixFD) string {
+	var b [4096]byte
+	file := os.NewFile(uintptr(fd), "testfile")
+	defer file.Close()
+	n, _ := file.Read(b[:])
+	return string(b[:n])
+}
+
+func (t unixFDNestedTest) Map(m map[string]UnixFD) (map[string]string, *Error) {
+	r := make(map[string]string)
+	for k, fd := range m {
+		r[k] = readFD(fd)
+	}
+	return r, nil
+}
+
+func (t unixFDNestedTest) Struct(s unixFDStruct) (string, *Error) {
+	return s.Name + ": " + readFD(s.FD), nil
+}
+
+func (t unixFDNestedTest) Variant(v Variant) (string, *Error) {
+	fd, ok := v.Value().(UnixFD)
+	if !ok {
+		return "", &Error{"com.github.guelfey.test.Error", nil}
+	}
+	return readFD(fd), nil
+}
+
+func testPipe(t *testing.T, s string) *os.File {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestUnixFDsNested(t *testing.T) {
+	conn, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Export(unixFDNestedTest{}, "/com/github/guelfey/test", "com.github.guelfey.test")
+	obj := conn.Object(conn.Names()[0], "/com/github/guelfey/test")
+
+	a, b := testPipe(t, "a"), testPipe(t, "b")
+	defer a.Close()
+	defer b.Close()
+	var m map[string]string
+	err = obj.Call("com.github.guelfey.test.Map", 0, map[string]UnixFD{
+		"a": UnixFD(a.Fd()),
+		"b": UnixFD(b.Fd()),
+	}).Store(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 2 || m["a"] != "a" || m["b"] != "b" {
+		t.Errorf("Map: got %v", m)
+	}
+
+	r := testPipe(t, testString)
+	defer r.Close()
+	var s string
+	err = obj.Call("com.github.guelfey.test.Struct", 0, unixFDStruct{"test", UnixFD(r.Fd())}).Store(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "test: "+testString {
+		t.Errorf("Struct: got %q", s)
+	}
+
+	r = testPipe(t, testString)
+	defer r.Close()
+	err = obj.Call("com.github.guelfey.test.Variant", 0, MakeVariant(UnixFD(r.Fd()))).Store(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != testString {
+		t.Errorf("Variant: got %q", s)
+	}
+}
+
+// unixFDReturnTest returns the fd of the file that was set last. The fd is
+// taken in the test goroutine, so that the handlers don't race with closing
+// the file.
+type unixFDReturnTest struct {
+	mu   sync.Mutex
+	unfd UnixFD
+}
+
+func (t *unixFDReturnTest) set(r *os.File) {
+	t.mu.Lock()
+	t.unfd = UnixFD(r.Fd())
+	t.mu.Unlock()
+}
+
+func (t *unixFDReturnTest) fd() UnixFD {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.unfd
+}
+
+func (t *unixFDReturnTest) Get() (UnixFD, *Error) {
+	return t.fd(), nil
+}
+
+func (t *unixFDReturnTest) Two() (UnixFD, UnixFD, *Error) {
+	fd := t.fd()
+	return fd, fd, nil
+}
+
+func (t *unixFDReturnTest) Slow() (UnixFD, *Error) {
+	fd := t.fd()
+	time.Sleep(200 * time.Millisecond)
+	return fd, nil
+}
+
+// pipeClosed reports whether all read ends of the pipe of w are closed
+// within a second.
+func pipeClosed(w *os.File) bool {
+	for i := 0; i < 100; i++ {
+		if _, err := w.Write([]byte{0}); err != nil {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestUnixFDOwnership(t *testing.T) {
+	conn, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := testPipe(t, testString)
+	test := new(unixFDReturnTest)
+	test.set(r)
+	conn.Export(test, "/com/github/guelfey/test", "com.github.guelfey.test")
+	obj := conn.Object(conn.Names()[0], "/com/github/guelfey/test")
+
+	var fd *FD
+	if err := obj.Call("com.github.guelfey.test.Get", 0).Store(&fd); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	dup, err := fd.Dup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fd.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fd.Close(); err == nil {
+		t.Error("closing an FD twice succeeded")
+	}
+	f, err := dup.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if b, err := ioutil.ReadAll(f); err != nil || string(b) != testString {
+		t.Errorf("got %q, %v, want %q", b, err, testString)
+	}
+	if dup.Fd() != -1 {
+		t.Errorf("FD still valid after File")
+	}
+
+	// The received fds are closed if Store fails.
+	var w *os.File
+	r, w, err = os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	test.set(r)
+	var s []string
+	if err := obj.Call("com.github.guelfey.test.Get", 0).Store(&s); err == nil {
+		t.Error("storing a unix fd into a slice succeeded")
+	}
+	r.Close()
+	if !pipeClosed(w) {
+		t.Error("fd not closed after Store failed")
+	}
+
+	// Only the fds that weren't stored into an FD are closed if Store fails.
+	r, w, err = os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	test.set(r)
+	fd = nil
+	if err := obj.Call("com.github.guelfey.test.Two", 0).Store(&fd, &s); err == nil {
+		t.Error("storing a unix fd into a slice succeeded")
+	}
+	r.Close()
+	if _, err := w.Write([]byte{0}); err != nil {
+		t.Errorf("fd stored into FD was closed: %v", err)
+	}
+	if err := fd.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !pipeClosed(w) {
+		t.Error("unclaimed fd not closed after Store failed")
+	}
+
+	// Storing into an FD closes the descriptor that it owned before.
+	r, w, err = os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	test.set(r)
+	fd = new(FD)
+	if err := obj.Call("com.github.guelfey.test.Get", 0).Store(fd); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	r2 := testPipe(t, testString)
+	defer r2.Close()
+	test.set(r2)
+	if err := obj.Call("com.github.guelfey.test.Get", 0).Store(fd); err != nil {
+		t.Fatal(err)
+	}
+	if !pipeClosed(w) {
+		t.Error("fd not closed after it was replaced")
+	}
+	if err := fd.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fds in the body of a reply that is never stored are left to the
+	// caller.
+	r, w, err = os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	test.set(r)
+	call := obj.Call("com.github.guelfey.test.Get", 0)
+	if call.Err != nil {
+		t.Fatal(call.Err)
+	}
+	r.Close()
+	unfd := call.Body[0].(UnixFD)
+	call = nil
+	runtime.GC()
+	if _, err := w.Write([]byte{0}); err != nil {
+		t.Errorf("fd in the body was closed: %v", err)
+	}
+	closeFD(int(unfd))
+	if !pipeClosed(w) {
+		t.Error("fd not closed")
+	}
+
+	// The received fds are closed if the reply arrives after a timeout.
+	r, w, err = os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	test.set(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := obj.CallWithContext(ctx, "com.github.guelfey.test.Slow", 0).Err; err == nil {
+		t.Error("call didn't time out")
+	}
+	time.Sleep(300 * time.Millisecond)
+	r.Close()
+	if !pipeClosed(w) {
+		t.Error("fd not closed after timeout")
+	}
+}
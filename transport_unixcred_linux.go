@@ -23,3 +23,22 @@ func (t *unixTransport) SendNullByte() error {
 	}
 	return nil
 }
+
+func (t *unixTransport) peerCredentials() (pid, uid uint32, err error) {
+	raw, err := t.UnixConn.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+	var ucred *syscall.Ucred
+	var ucredErr error
+	err = raw.Control(func(fd uintptr) {
+		ucred, ucredErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if ucredErr != nil {
+		return 0, 0, ucredErr
+	}
+	return uint32(ucred.Pid), ucred.Uid, nil
+}
@@ -0,0 +1,123 @@
+package dbus
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	transports["unixexec"] = newUnixExecTransport
+}
+
+// newUnixExecTransport starts the program given by the path key with the
+// arguments argv0, argv1 and so on, and speaks D-Bus over its standard input
+// and output.
+func newUnixExecTransport(keys string) (transport, error) {
+	path, err := unescapeAddressValue(getKey(keys, "path"))
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, errors.New("dbus: invalid address (path not set)")
+	}
+	argv0, err := unescapeAddressValue(getKey(keys, "argv0"))
+	if err != nil {
+		return nil, err
+	}
+	if argv0 == "" {
+		argv0 = path
+	}
+	args := []string{argv0}
+	for i := 1; ; i++ {
+		key := "argv" + strconv.Itoa(i)
+		if !hasKey(keys, key) {
+			break
+		}
+		arg, err := unescapeAddressValue(getKey(keys, key))
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	cmd := &exec.Cmd{Path: path, Args: args, Stderr: os.Stderr}
+	if lp, err := exec.LookPath(path); err == nil {
+		cmd.Path = lp
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return genericTransport{&execConn{cmd: cmd, r: stdout, w: stdin}}, nil
+}
+
+// execConn is the connection to a process started for a unixexec address.
+type execConn struct {
+	cmd *exec.Cmd
+	r   io.ReadCloser
+	w   io.WriteCloser
+}
+
+func (c *execConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *execConn) Write(b []byte) (int, error) {
+	return c.w.Write(b)
+}
+
+// Close closes the pipes to the process and terminates it.
+func (c *execConn) Close() error {
+	err := c.w.Close()
+	c.cmd.Process.Kill()
+	// Wait closes the standard output and fails because the process was
+	// killed, which is expected.
+	c.cmd.Wait()
+	return err
+}
+
+// hasKey reports whether the list of keys contains key.
+func hasKey(s, key string) bool {
+	for _, keyEqualsValue := range strings.Split(s, ",") {
+		if strings.HasPrefix(keyEqualsValue, key+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeAddressValue decodes the percent-encoded bytes in the value of a key
+// of an address.
+func unescapeAddressValue(s string) (string, error) {
+	if !strings.Contains(s, "%") {
+		return s, nil
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b = append(b, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", errors.New("dbus: invalid address (truncated escape sequence)")
+		}
+		v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", errors.New("dbus: invalid address (invalid escape sequence)")
+		}
+		b = append(b, byte(v))
+		i += 2
+	}
+	return string(b), nil
+}
@@ -0,0 +1,85 @@
+package dbus
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+)
+
+// TestUnixExecHelper is started by TestUnixExecTransport. Like
+// systemd-stdio-bridge, it connects its standard input and output to the
+// session bus.
+func TestUnixExecHelper(t *testing.T) {
+	if os.Getenv("GO_WANT_UNIXEXEC_HELPER") != "1" {
+		return
+	}
+	address := os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+	name := getKey(address, "unix:path")
+	if name == "" {
+		name = "@" + getKey(address, "unix:abstract")
+	}
+	c, err := net.Dial("unix", name)
+	if err != nil {
+		os.Exit(1)
+	}
+	go io.Copy(c, os.Stdin)
+	io.Copy(os.Stdout, c)
+	os.Exit(0)
+}
+
+func TestUnixExecTransport(t *testing.T) {
+	if _, err := getSessionBusAddress(); err != nil {
+		t.Skip(err)
+	}
+	// Make sure that the helper is given a session bus address.
+	conn, err := ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	os.Setenv("GO_WANT_UNIXEXEC_HELPER", "1")
+	defer os.Unsetenv("GO_WANT_UNIXEXEC_HELPER")
+	address := "unixexec:path=" + os.Args[0] + ",argv0=helper,argv1=-test.run%3dTestUnixExecHelper"
+	conn, err = Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id string
+	if err := conn.BusObject().Call("org.freedesktop.DBus.GetId", 0).Store(&id); err != nil {
+		t.Error(err)
+	}
+	ec := conn.transport.(genericTransport).ReadWriteCloser.(*execConn)
+	if got := ec.cmd.Args[1]; got != "-test.run=TestUnixExecHelper" {
+		t.Errorf("got argv1 %q", got)
+	}
+	conn.Close()
+	if ec.cmd.ProcessState == nil {
+		t.Error("process wasn't terminated by Close")
+	}
+
+	if _, err := Connect("unixexec:argv0=foo"); err == nil {
+		t.Error("Connect succeeded without path")
+	}
+	if _, err := Connect("unixexec:path=/nonexistent/program"); err == nil {
+		t.Error("Connect succeeded with nonexistent program")
+	}
+}
+
+func TestUnescapeAddressValue(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+		ok      bool
+	}{
+		{"foo", "foo", true},
+		{"a%3db%2C", "a=b,", true},
+		{"%2", "", false},
+		{"%zz", "", false},
+	} {
+		out, err := unescapeAddressValue(tc.in)
+		if (err == nil) != tc.ok || out != tc.out {
+			t.Errorf("unescapeAddressValue(%q) = %q, %v", tc.in, out, err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package dbus
+
+import (
+	"errors"
+	"os"
+	"reflect"
+)
+
+// An FD is a Unix file descriptor that was received in a message and is owned
+// by whoever holds the FD, who is responsible for closing it. Storing a UNIX_FD
+// value into an FD or *FD (e.g. with Call.Store) transfers the ownership of the
+// descriptor to it. An FD can also be sent in a message, in which case it is
+// passed like a UnixFD and is still owned by the sender.
+//
+// An FD must not be copied after first use, as the copies would own the same
+// descriptor; use *FD to pass it around, and Dup to get a second descriptor.
+type FD struct {
+	noCopy noCopy
+
+	// fd is the file descriptor plus one, so that the zero value of FD is
+	// closed instead of referring to the standard input.
+	fd int
+}
+
+// noCopy makes go vet report copies of the structs that contain it.
+type noCopy struct{}
+
+func (*noCopy) Lock()   {}
+func (*noCopy) Unlock() {}
+
+// NewFD returns an FD that owns the given file descriptor.
+func NewFD(fd int) *FD {
+	return &FD{fd: fd + 1}
+}
+
+// Fd returns the file descriptor, or -1 if fd has been closed.
+func (fd *FD) Fd() int {
+	return fd.fd - 1
+}
+
+// Close closes the file descriptor. Closing an FD that is already closed
+// returns an error.
+func (fd *FD) Close() error {
+	n := fd.Fd()
+	if n < 0 {
+		return errFDClosed
+	}
+	fd.fd = 0
+	return closeFD(n)
+}
+
+// Dup returns a new FD for a duplicate of the file descriptor, which stays
+// valid after fd is closed.
+func (fd *FD) Dup() (*FD, error) {
+	n := fd.Fd()
+	if n < 0 {
+		return nil, errFDClosed
+	}
+	d, err := dupFD(n)
+	if err != nil {
+		return nil, err
+	}
+	return NewFD(d), nil
+}
+
+// File returns an *os.File for the file descriptor and transfers the ownership
+// of the descriptor to it, so that fd is closed afterwards and the descriptor
+// is closed by closing the returned file. Use Dup first to keep fd valid.
+func (fd *FD) File() (*os.File, error) {
+	n := fd.Fd()
+	if n < 0 {
+		return nil, errFDClosed
+	}
+	fd.fd = 0
+	return os.NewFile(uintptr(n), "dbus-fd"), nil
+}
+
+var errFDClosed = errors.New("dbus: file descriptor already closed")
+
+// fdValue returns the file descriptor of the FD v without copying it, or -1 if
+// it is closed.
+func fdValue(v reflect.Value) int {
+	return int(v.FieldByName("fd").Int()) - 1
+}
+
+// heldFDs adds the file descriptors held by the FDs in v, wherever they are
+// nested, to fds. seen holds the pointers that were already visited.
+func heldFDs(v reflect.Value, fds map[int]bool, seen map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		heldFDs(v.Elem(), fds, seen)
+	case reflect.Interface:
+		if !v.IsNil() {
+			heldFDs(v.Elem(), fds, seen)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			heldFDs(v.Index(i), fds, seen)
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			heldFDs(v.MapIndex(k), fds, seen)
+		}
+	case reflect.Struct:
+		if v.Type() == fdType {
+			fds[fdValue(v)] = true
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			heldFDs(v.Field(i), fds, seen)
+		}
+	}
+}
+
+// closeFDsExcept closes the fds, except for those in held, which are owned by
+// their receiver.
+func closeFDsExcept(fds []int, held map[int]bool) {
+	for _, fd := range fds {
+		if !held[fd] {
+			closeFD(fd)
+		}
+	}
+}
+
+// closeFDs closes the unix fds that were received with msg and not handed out
+// to their receiver.
+func (msg *Message) closeFDs() {
+	for _, fd := range msg.fds {
+		closeFD(fd)
+	}
+	msg.fds = nil
+}
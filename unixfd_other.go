@@ -0,0 +1,17 @@
+//+build windows solaris
+
+package dbus
+
+import "errors"
+
+// Unix fds are never received on these platforms.
+
+var errNoUnixFDs = errors.New("dbus: unix fd passing not supported")
+
+func closeFD(fd int) error {
+	return errNoUnixFDs
+}
+
+func dupFD(fd int) (int, error) {
+	return -1, errNoUnixFDs
+}